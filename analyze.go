@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+
+	"code.cloudfoundry.org/dontpanic/analyze"
+	"code.cloudfoundry.org/dontpanic/report"
+)
+
+type AnalyzeCommand struct {
+	Key        string   `long:"key" description:"PEM encoded X25519 private key to decrypt an encrypted report with"`
+	Signatures []string `long:"signatures" description:"YAML file with known issue signatures extending or overriding the built-in ones (can be repeated)"`
+	Args       struct {
+		Report string `positional-arg-name:"REPORT" description:"Report archive or uncompressed report directory" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *AnalyzeCommand) Execute([]string) error {
+	signatures, err := analyze.LoadSignatures(c.Signatures...)
+	if err != nil {
+		return err
+	}
+	checks := append(analyze.DefaultChecks(), signatures.Checks()...)
+
+	files, err := report.Read(c.Args.Report, c.Key, analyze.Patterns(checks))
+	if err != nil {
+		return err
+	}
+
+	findings := analyze.Run(analyze.NewReport(files), checks)
+	if len(findings) == 0 {
+		fmt.Println(aurora.Green("No known issues found"))
+		return nil
+	}
+
+	counts := map[analyze.Severity]int{}
+	for _, finding := range findings {
+		counts[finding.Severity]++
+
+		evidence := []string{}
+		for _, e := range finding.Evidence {
+			evidence = append(evidence, e.String())
+		}
+
+		fmt.Printf("%s %s: %s\n", severityLabel(finding.Severity), finding.Check, finding.Summary)
+		if len(evidence) > 0 {
+			fmt.Printf("    see %s\n", strings.Join(evidence, ", "))
+		}
+		if finding.Link != "" {
+			fmt.Printf("    more at %s\n", finding.Link)
+		}
+	}
+
+	fmt.Printf("\n%d finding(s): %d critical, %d warning, %d info\n", len(findings), counts[analyze.Critical], counts[analyze.Warning], counts[analyze.Info])
+	return nil
+}
+
+func severityLabel(severity analyze.Severity) aurora.Value {
+	label := fmt.Sprintf("%-10s", "["+strings.ToUpper(severity.String())+"]")
+	switch severity {
+	case analyze.Critical:
+		return aurora.Red(label)
+	case analyze.Warning:
+		return aurora.Yellow(label)
+	default:
+		return aurora.Cyan(label)
+	}
+}
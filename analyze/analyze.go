@@ -0,0 +1,141 @@
+// Package analyze looks for the symptoms of known problems in a finished
+// report, so that they need not be grepped for by hand.
+package analyze
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/report"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Critical:
+		return "critical"
+	case Warning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// Evidence points at the file, and the line in it if known, that a finding
+// is based on.
+type Evidence struct {
+	File string
+	Line int
+}
+
+func (e Evidence) String() string {
+	if e.Line == 0 {
+		return e.File
+	}
+	return fmt.Sprintf("%s:%d", e.File, e.Line)
+}
+
+type Finding struct {
+	Severity Severity
+	Check    string
+	Summary  string
+	Evidence []Evidence
+	// Link points at more information about the problem, if any.
+	Link string
+}
+
+// Check looks for one kind of problem in a report.
+type Check struct {
+	Name string
+	// Files lists the patterns, as understood by path.Match, of the files
+	// the check reads. Only those files are loaded from the report.
+	Files []string
+	Run   func(*Report) []Finding
+}
+
+// Report holds the files of a report that checks are interested in.
+type Report struct {
+	files map[string][]byte
+}
+
+// NewReport returns a report made up of the given files, keyed by their
+// path relative to the report directory.
+func NewReport(files map[string][]byte) *Report {
+	return &Report{files: files}
+}
+
+// Patterns returns the patterns of the files the checks read.
+func Patterns(checks []Check) []string {
+	patterns := []string{}
+	for _, check := range checks {
+		patterns = append(patterns, check.Files...)
+	}
+	return patterns
+}
+
+// File returns the contents of the named file.
+func (r *Report) File(name string) ([]byte, bool) {
+	contents, found := r.files[name]
+	return contents, found
+}
+
+// Glob returns the sorted names of the files matching any of the patterns.
+func (r *Report) Glob(patterns ...string) []string {
+	names := []string{}
+	for name := range r.files {
+		if report.Matches(patterns, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Match is a line matching an expression, with its submatches.
+type Match struct {
+	Evidence
+	Groups []string
+}
+
+// Grep returns the lines of the files matching any of the patterns that
+// match the expression.
+func (r *Report) Grep(expression *regexp.Regexp, patterns ...string) []Match {
+	matches := []Match{}
+	for _, name := range r.Glob(patterns...) {
+		for i, line := range strings.Split(string(r.files[name]), "\n") {
+			if groups := expression.FindStringSubmatch(line); groups != nil {
+				matches = append(matches, Match{Evidence: Evidence{File: name, Line: i + 1}, Groups: groups})
+			}
+		}
+	}
+	return matches
+}
+
+// Run runs the checks against the report and returns their findings, most
+// severe first.
+func Run(r *Report, checks []Check) []Finding {
+	findings := []Finding{}
+	for _, check := range checks {
+		for _, finding := range check.Run(r) {
+			if finding.Check == "" {
+				finding.Check = check.Name
+			}
+			findings = append(findings, finding)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
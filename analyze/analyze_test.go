@@ -0,0 +1,48 @@
+package analyze_test
+
+import (
+	"regexp"
+
+	"code.cloudfoundry.org/dontpanic/analyze"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Analyze", func() {
+	Describe("Grep", func() {
+		It("points at the matching lines", func() {
+			report := analyze.NewReport(map[string][]byte{
+				"a.log": []byte("fine\nbroken: disk\n"),
+				"b.log": []byte("broken: network\n"),
+			})
+
+			matches := report.Grep(regexp.MustCompile(`broken: (\w+)`), "*.log")
+			Expect(matches).To(HaveLen(2))
+			Expect(matches[0].String()).To(Equal("a.log:2"))
+			Expect(matches[0].Groups[1]).To(Equal("disk"))
+			Expect(matches[1].String()).To(Equal("b.log:1"))
+		})
+	})
+
+	Describe("Run", func() {
+		It("lists the findings most severe first and names their check", func() {
+			finding := func(severity analyze.Severity, summary string) func(*analyze.Report) []analyze.Finding {
+				return func(*analyze.Report) []analyze.Finding {
+					return []analyze.Finding{{Severity: severity, Summary: summary}}
+				}
+			}
+			checks := []analyze.Check{
+				{Name: "info", Run: finding(analyze.Info, "first")},
+				{Name: "critical", Run: finding(analyze.Critical, "second")},
+				{Name: "warning", Run: finding(analyze.Warning, "third")},
+			}
+
+			findings := analyze.Run(analyze.NewReport(nil), checks)
+			Expect(findings).To(Equal([]analyze.Finding{
+				{Severity: analyze.Critical, Check: "critical", Summary: "second"},
+				{Severity: analyze.Warning, Check: "warning", Summary: "third"},
+				{Severity: analyze.Info, Check: "info", Summary: "first"},
+			}))
+		})
+	})
+})
@@ -0,0 +1,320 @@
+package analyze
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/osreporter"
+)
+
+// maxEvidence caps the number of lines a finding points at.
+const maxEvidence = 5
+
+var kernelLogs = []string{"dmesg.log", "kernel-logs/*", "syslogs/*"}
+
+// DefaultChecks returns the built-in checks.
+func DefaultChecks() []Check {
+	return []Check{
+		{Name: "disk-space", Files: []string{"df.log"}, Run: checkDiskSpace},
+		{Name: "inodes", Files: []string{"inode-usage.log"}, Run: checkInodes},
+		{Name: "oom-kill", Files: kernelLogs, Run: checkOOMKills},
+		{Name: "hung-task", Files: kernelLogs, Run: checkHungTasks},
+		{Name: "d-state", Files: []string{"ps-info.log"}, Run: checkDState},
+		{Name: "file-max", Files: []string{"file-max.log", "file-nr.log"}, Run: checkFileMax},
+		{Name: "grootfs-store", Files: []string{"grootfs/*-usage.txt"}, Run: checkGrootFSStore},
+		{Name: "failed-collector", Files: []string{"manifest.json"}, Run: checkFailedCollectors},
+	}
+}
+
+// usageSeverity grades how full something is, returning false if it is
+// not full enough to report.
+func usageSeverity(percent, warning, critical float64) (Severity, bool) {
+	switch {
+	case percent >= critical:
+		return Critical, true
+	case percent >= warning:
+		return Warning, true
+	default:
+		return Info, false
+	}
+}
+
+func checkDiskSpace(r *Report) []Finding {
+	return checkDF(r, "df.log", "Use%", "full")
+}
+
+func checkInodes(r *Report) []Finding {
+	return checkDF(r, "inode-usage.log", "IUse%", "of its inodes used")
+}
+
+// checkDF reports the filesystems in the output of df whose usage column
+// is above the thresholds.
+func checkDF(r *Report, file, column, what string) []Finding {
+	contents, found := r.File(file)
+	if !found {
+		return nil
+	}
+
+	findings := []Finding{}
+	usage := -1
+	for i, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if usage < 0 {
+			usage = indexOf(fields, column)
+			continue
+		}
+		if len(fields) <= usage {
+			continue
+		}
+
+		percent, err := strconv.Atoi(strings.TrimSuffix(fields[usage], "%"))
+		if err != nil {
+			continue
+		}
+
+		if severity, ok := usageSeverity(float64(percent), 85, 95); ok {
+			findings = append(findings, Finding{
+				Severity: severity,
+				Summary:  fmt.Sprintf("%s (%s) is %d%% %s", fields[len(fields)-1], fields[0], percent, what),
+				Evidence: []Evidence{{File: file, Line: i + 1}},
+			})
+		}
+	}
+	return findings
+}
+
+func indexOf(fields []string, name string) int {
+	for i, field := range fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+var oomKill = regexp.MustCompile(`[Oo]ut of memory: Kill(?:ed)? process (\d+) \(([^)]*)\)`)
+
+func checkOOMKills(r *Report) []Finding {
+	victims := uniqueMatches(r.Grep(oomKill, kernelLogs...), func(groups []string) string {
+		return fmt.Sprintf("%s (pid %s)", groups[2], groups[1])
+	})
+	if len(victims.keys) == 0 {
+		return nil
+	}
+
+	return []Finding{{
+		Severity: Critical,
+		Summary:  fmt.Sprintf("the OOM killer killed %d process(es): %s", len(victims.keys), strings.Join(victims.keys, ", ")),
+		Evidence: victims.evidence,
+	}}
+}
+
+var hungTask = regexp.MustCompile(`task (\S+):(\d+) blocked for more than (\d+) seconds`)
+
+func checkHungTasks(r *Report) []Finding {
+	tasks := uniqueMatches(r.Grep(hungTask, kernelLogs...), func(groups []string) string {
+		return fmt.Sprintf("%s (pid %s)", groups[1], groups[2])
+	})
+	if len(tasks.keys) == 0 {
+		return nil
+	}
+
+	return []Finding{{
+		Severity: Critical,
+		Summary:  fmt.Sprintf("the kernel reported %d hung task(s): %s", len(tasks.keys), strings.Join(tasks.keys, ", ")),
+		Evidence: tasks.evidence,
+	}}
+}
+
+type unique struct {
+	keys     []string
+	evidence []Evidence
+}
+
+// uniqueMatches collapses matches describing the same event, as the kernel
+// log is collected both from dmesg and from the log files.
+func uniqueMatches(matches []Match, key func(groups []string) string) unique {
+	var result unique
+	seen := map[string]bool{}
+	for _, match := range matches {
+		k := key(match.Groups)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		result.keys = append(result.keys, k)
+		if len(result.evidence) < maxEvidence {
+			result.evidence = append(result.evidence, match.Evidence)
+		}
+	}
+	return result
+}
+
+func checkDState(r *Report) []Finding {
+	contents, found := r.File("ps-info.log")
+	if !found {
+		return nil
+	}
+
+	var (
+		evidence []Evidence
+		threads  int
+		commands = map[string]int{}
+		order    []string
+	)
+	state, command := -1, -1
+	for i, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if state < 0 {
+			state, command = indexOf(fields, "S"), indexOf(fields, "COMMAND")
+			continue
+		}
+		if len(fields) <= state || fields[state] != "D" {
+			continue
+		}
+
+		threads++
+		if len(evidence) < maxEvidence {
+			evidence = append(evidence, Evidence{File: "ps-info.log", Line: i + 1})
+		}
+		if command >= 0 {
+			if commands[fields[command]] == 0 {
+				order = append(order, fields[command])
+			}
+			commands[fields[command]]++
+		}
+	}
+
+	if threads == 0 {
+		return nil
+	}
+
+	described := []string{}
+	for _, name := range order {
+		described = append(described, fmt.Sprintf("%s (%d)", name, commands[name]))
+	}
+
+	return []Finding{{
+		Severity: Warning,
+		Summary:  fmt.Sprintf("%d thread(s) in uninterruptible sleep (D state): %s", threads, strings.Join(described, ", ")),
+		Evidence: evidence,
+	}}
+}
+
+func checkFileMax(r *Report) []Finding {
+	max, maxFound := readNumber(r, "file-max.log")
+	// The first field of file-nr is the number of allocated file handles
+	allocated, allocatedFound := readNumber(r, "file-nr.log")
+	if !maxFound || !allocatedFound || max == 0 {
+		return nil
+	}
+
+	percent := float64(allocated) * 100 / float64(max)
+	severity, ok := usageSeverity(percent, 75, 90)
+	if !ok {
+		return nil
+	}
+
+	return []Finding{{
+		Severity: severity,
+		Summary:  fmt.Sprintf("%d allocated file handles are %.0f%% of the system-wide limit of %d (fs.file-max)", allocated, percent, max),
+		Evidence: []Evidence{{File: "file-nr.log"}, {File: "file-max.log"}},
+	}}
+}
+
+// readNumber reads the number a file starts with.
+func readNumber(r *Report, file string) (int64, bool) {
+	contents, found := r.File(file)
+	if !found {
+		return 0, false
+	}
+
+	fields := strings.Fields(string(contents))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	number, err := strconv.ParseInt(fields[0], 10, 64)
+	return number, err == nil
+}
+
+var usageLine = regexp.MustCompile(`^([a-z-]+):\s+(\d+) bytes`)
+
+func checkGrootFSStore(r *Report) []Finding {
+	findings := []Finding{}
+	for _, file := range r.Glob("grootfs/*-usage.txt") {
+		contents, _ := r.File(file)
+
+		sizes := map[string]int64{}
+		for _, line := range strings.Split(string(contents), "\n") {
+			if groups := usageLine.FindStringSubmatch(line); groups != nil {
+				sizes[groups[1]], _ = strconv.ParseInt(groups[2], 10, 64)
+			}
+		}
+
+		actual, max := sizes["backing-store-actual-size"], sizes["backing-store-max-size"]
+		if max == 0 {
+			continue
+		}
+
+		percent := float64(actual) * 100 / float64(max)
+		if severity, ok := usageSeverity(percent, 80, 90); ok {
+			store := strings.TrimSuffix(path.Base(file), "-usage.txt")
+			findings = append(findings, Finding{
+				Severity: severity,
+				Summary:  fmt.Sprintf("the %s GrootFS store uses %.0f%% of its backing store", store, percent),
+				Evidence: []Evidence{{File: file}},
+			})
+		}
+	}
+	return findings
+}
+
+func checkFailedCollectors(r *Report) []Finding {
+	contents, found := r.File("manifest.json")
+	if !found {
+		return nil
+	}
+
+	var manifest osreporter.Manifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return []Finding{{
+			Severity: Warning,
+			Summary:  fmt.Sprintf("the manifest cannot be read: %s", err),
+			Evidence: []Evidence{{File: "manifest.json"}},
+		}}
+	}
+
+	findings := []Finding{}
+	if manifest.Cancelled != "" {
+		findings = append(findings, Finding{
+			Severity: Warning,
+			Summary:  fmt.Sprintf("the report was cancelled before all collectors finished: %s", manifest.Cancelled),
+			Evidence: []Evidence{{File: "manifest.json"}},
+		})
+	}
+
+	for _, result := range manifest.Collectors {
+		var summary string
+		switch result.Outcome {
+		case osreporter.OutcomeFailed:
+			summary = fmt.Sprintf("collector %q failed, its data is missing or incomplete: %s", result.Name, strings.TrimSpace(result.Error))
+		case osreporter.OutcomeTimedOut:
+			summary = fmt.Sprintf("collector %q timed out, its data is missing or incomplete", result.Name)
+		case osreporter.OutcomeCancelled:
+			summary = fmt.Sprintf("collector %q was cancelled with the report, its data is missing or incomplete", result.Name)
+		default:
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Severity: Info,
+			Summary:  summary,
+			Evidence: []Evidence{{File: "manifest.json"}},
+		})
+	}
+	return findings
+}
@@ -0,0 +1,150 @@
+package analyze_test
+
+import (
+	"code.cloudfoundry.org/dontpanic/analyze"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DefaultChecks", func() {
+	var files map[string]string
+
+	BeforeEach(func() {
+		files = map[string]string{}
+	})
+
+	run := func() []analyze.Finding {
+		report := map[string][]byte{}
+		for name, contents := range files {
+			report[name] = []byte(contents)
+		}
+		return analyze.Run(analyze.NewReport(report), analyze.DefaultChecks())
+	}
+
+	It("finds nothing in a healthy report", func() {
+		files["df.log"] = "Filesystem      Size  Used Avail Use% Mounted on\n/dev/sda1       9.7G  4.1G  5.1G  45% /\n"
+		files["file-max.log"] = "9223372036854775807\n"
+		files["file-nr.log"] = "12345\t0\t9223372036854775807\n"
+		files["manifest.json"] = `{"collectors": [{"name": "Date", "outcome": "ok"}]}`
+
+		Expect(run()).To(BeEmpty())
+	})
+
+	It("reports full filesystems", func() {
+		files["df.log"] = `Filesystem      Size  Used Avail Use% Mounted on
+/dev/sda1       9.7G  4.1G  5.1G  45% /
+/dev/sdb2        99G   88G   11G  89% /var/vcap/store
+/dev/sda3        95G   93G  2.0G  98% /var/vcap/data
+`
+
+		Expect(run()).To(Equal([]analyze.Finding{
+			{Severity: analyze.Critical, Check: "disk-space", Summary: "/var/vcap/data (/dev/sda3) is 98% full", Evidence: []analyze.Evidence{{File: "df.log", Line: 4}}},
+			{Severity: analyze.Warning, Check: "disk-space", Summary: "/var/vcap/store (/dev/sdb2) is 89% full", Evidence: []analyze.Evidence{{File: "df.log", Line: 3}}},
+		}))
+	})
+
+	It("reports inode exhaustion", func() {
+		files["inode-usage.log"] = `Filesystem      Inodes  IUsed   IFree IUse% Mounted on
+/dev/sda3      6225920 6225900     20  100% /var/vcap/data
+tmpfs                0       0      0     - /dev/shm
+`
+
+		Expect(run()).To(ConsistOf(analyze.Finding{
+			Severity: analyze.Critical,
+			Check:    "inodes",
+			Summary:  "/var/vcap/data (/dev/sda3) is 100% of its inodes used",
+			Evidence: []analyze.Evidence{{File: "inode-usage.log", Line: 2}},
+		}))
+	})
+
+	It("reports OOM kills once even if they are in several logs", func() {
+		oomKill := "[Thu Oct  1 10:00:00 2026] Out of memory: Killed process 1234 (java) total-vm:1024kB\n"
+		files["dmesg.log"] = "[Thu Oct  1 09:59:59 2026] java invoked oom-killer\n" + oomKill
+		files["kernel-logs/kern.log"] = oomKill + "Memory cgroup out of memory: Killed process 99 (ruby)\n"
+
+		Expect(run()).To(ConsistOf(analyze.Finding{
+			Severity: analyze.Critical,
+			Check:    "oom-kill",
+			Summary:  "the OOM killer killed 2 process(es): java (pid 1234), ruby (pid 99)",
+			Evidence: []analyze.Evidence{{File: "dmesg.log", Line: 2}, {File: "kernel-logs/kern.log", Line: 2}},
+		}))
+	})
+
+	It("reports hung tasks", func() {
+		files["syslogs/syslog"] = "kernel: INFO: task gdn:4321 blocked for more than 120 seconds.\n"
+
+		Expect(run()).To(ConsistOf(analyze.Finding{
+			Severity: analyze.Critical,
+			Check:    "hung-task",
+			Summary:  "the kernel reported 1 hung task(s): gdn (pid 4321)",
+			Evidence: []analyze.Evidence{{File: "syslogs/syslog", Line: 1}},
+		}))
+	})
+
+	It("reports threads in uninterruptible sleep", func() {
+		files["ps-info.log"] = `    PID     TID    PPID USER        COMMAND         S WCHAN                               STARTED
+      1       1       0 root        systemd         S ep_poll                             Thu Oct  1 09:00:00 2026
+   4321    4321       1 root        gdn             D rwsem_down_write_slowpath           Thu Oct  1 09:00:00 2026
+   4321    4322       1 root        gdn             D rwsem_down_write_slowpath           Thu Oct  1 09:00:00 2026
+   5555    5555       1 vcap        xfs_db          D xfs_buf_lock                        Thu Oct  1 09:00:00 2026
+`
+
+		Expect(run()).To(ConsistOf(analyze.Finding{
+			Severity: analyze.Warning,
+			Check:    "d-state",
+			Summary:  "3 thread(s) in uninterruptible sleep (D state): gdn (2), xfs_db (1)",
+			Evidence: []analyze.Evidence{{File: "ps-info.log", Line: 3}, {File: "ps-info.log", Line: 4}, {File: "ps-info.log", Line: 5}},
+		}))
+	})
+
+	It("reports allocated file handles approaching fs.file-max", func() {
+		files["file-max.log"] = "100000\n"
+		files["file-nr.log"] = "95000\t0\t100000\n"
+
+		Expect(run()).To(ConsistOf(analyze.Finding{
+			Severity: analyze.Critical,
+			Check:    "file-max",
+			Summary:  "95000 allocated file handles are 95% of the system-wide limit of 100000 (fs.file-max)",
+			Evidence: []analyze.Evidence{{File: "file-nr.log"}, {File: "file-max.log"}},
+		}))
+	})
+
+	It("reports GrootFS stores close to the size of their backing store", func() {
+		files["grootfs/unprivileged-usage.txt"] = "backing-store-actual-size:      85000000 bytes\nbacking-store-max-size:        100000000 bytes\n"
+		files["grootfs/privileged-usage.txt"] = "backing-store-actual-size:      10000000 bytes\nbacking-store-max-size:        100000000 bytes\n"
+
+		Expect(run()).To(ConsistOf(analyze.Finding{
+			Severity: analyze.Warning,
+			Check:    "grootfs-store",
+			Summary:  "the unprivileged GrootFS store uses 85% of its backing store",
+			Evidence: []analyze.Evidence{{File: "grootfs/unprivileged-usage.txt"}},
+		}))
+	})
+
+	It("reports collectors that failed or timed out", func() {
+		files["manifest.json"] = `{"collectors": [
+			{"name": "Date", "outcome": "ok"},
+			{"name": "Monit Summary", "outcome": "failed", "error": "exit status 1"},
+			{"name": "Process Tree", "outcome": "timed_out"},
+			{"name": "Sysstat", "outcome": "skipped"}
+		]}`
+
+		Expect(run()).To(Equal([]analyze.Finding{
+			{Severity: analyze.Info, Check: "failed-collector", Summary: `collector "Monit Summary" failed, its data is missing or incomplete: exit status 1`, Evidence: []analyze.Evidence{{File: "manifest.json"}}},
+			{Severity: analyze.Info, Check: "failed-collector", Summary: `collector "Process Tree" timed out, its data is missing or incomplete`, Evidence: []analyze.Evidence{{File: "manifest.json"}}},
+		}))
+	})
+
+	It("reports reports that were cancelled", func() {
+		files["manifest.json"] = `{"cancelled": "interrupted", "collectors": [
+			{"name": "Date", "outcome": "ok"},
+			{"name": "Process Tree", "outcome": "cancelled"},
+			{"name": "Sysstat", "outcome": "skipped"}
+		]}`
+
+		Expect(run()).To(Equal([]analyze.Finding{
+			{Severity: analyze.Warning, Check: "failed-collector", Summary: "the report was cancelled before all collectors finished: interrupted", Evidence: []analyze.Evidence{{File: "manifest.json"}}},
+			{Severity: analyze.Info, Check: "failed-collector", Summary: `collector "Process Tree" was cancelled with the report, its data is missing or incomplete`, Evidence: []analyze.Evidence{{File: "manifest.json"}}},
+		}))
+	})
+})
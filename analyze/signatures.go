@@ -0,0 +1,161 @@
+package analyze
+
+import (
+	_ "embed"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+
+	"code.cloudfoundry.org/dontpanic/overlay"
+)
+
+//go:embed signatures.yml
+var defaultSignatures []byte
+
+// Database is a set of signatures of known issues.
+type Database struct {
+	Signatures []Signature `yaml:"signatures"`
+}
+
+// Signature describes how a known issue shows up in the files of a report.
+// It matches when lines of the files match the pattern, subject to the
+// optional thresholds.
+type Signature struct {
+	Name     string   `yaml:"name"`
+	Title    string   `yaml:"title"`
+	Severity string   `yaml:"severity"`
+	Link     string   `yaml:"link"`
+	Files    []string `yaml:"files"`
+	Pattern  string   `yaml:"pattern"`
+	// CountAbove is the number of matching lines that must be exceeded.
+	CountAbove int `yaml:"count_above"`
+	// ValueAbove, if set, only counts lines where the number captured by
+	// the group of the pattern named value exceeds it.
+	ValueAbove *float64 `yaml:"value_above"`
+	Disabled   bool     `yaml:"disabled"`
+}
+
+// DefaultSignatures returns the signatures shipped with dontpanic.
+func DefaultSignatures() (Database, error) {
+	return ParseSignatures(defaultSignatures)
+}
+
+// LoadSignatures returns the default signatures, extended or overridden by
+// the signatures defined in each of the given files.
+func LoadSignatures(paths ...string) (Database, error) {
+	return overlay.Load("signatures", defaultSignatures, paths, ParseSignatures, Database.Merge)
+}
+
+func ParseSignatures(contents []byte) (Database, error) {
+	return overlay.Parse(contents, func(d Database) []Signature { return d.Signatures }, Signature.Validate)
+}
+
+// Merge returns a database where signatures in override replace the
+// signatures with the same name, and any other signatures are appended.
+func (d Database) Merge(override Database) Database {
+	return Database{Signatures: overlay.Merge(d.Signatures, override.Signatures, func(s Signature) string { return s.Name })}
+}
+
+// Checks returns a check for each signature that is not disabled.
+func (d Database) Checks() []Check {
+	checks := []Check{}
+	for _, signature := range d.Signatures {
+		if !signature.Disabled {
+			checks = append(checks, signature.Check())
+		}
+	}
+	return checks
+}
+
+func (s Signature) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("signature has no name")
+	}
+
+	if s.Disabled {
+		return nil
+	}
+
+	if s.Title == "" {
+		return fmt.Errorf("signature %q has no title", s.Name)
+	}
+
+	if _, err := ParseSeverity(s.Severity); err != nil {
+		return fmt.Errorf("signature %q: %v", s.Name, err)
+	}
+
+	if len(s.Files) == 0 {
+		return fmt.Errorf("signature %q has no files", s.Name)
+	}
+	for _, pattern := range s.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("signature %q has invalid file pattern %q", s.Name, pattern)
+		}
+	}
+
+	if s.Pattern == "" {
+		return fmt.Errorf("signature %q has no pattern", s.Name)
+	}
+	expression, err := regexp.Compile(s.Pattern)
+	if err != nil {
+		return fmt.Errorf("signature %q has invalid pattern: %v", s.Name, err)
+	}
+
+	if s.ValueAbove != nil && expression.SubexpIndex("value") < 0 {
+		return fmt.Errorf("signature %q sets value_above but its pattern has no group named value", s.Name)
+	}
+
+	return nil
+}
+
+// Check returns a check that reports the known issue when the signature
+// matches. The signature must be valid.
+func (s Signature) Check() Check {
+	expression := regexp.MustCompile(s.Pattern)
+	severity, _ := ParseSeverity(s.Severity)
+
+	return Check{
+		Name:  s.Name,
+		Files: s.Files,
+		Run: func(r *Report) []Finding {
+			matches := []Match{}
+			for _, match := range r.Grep(expression, s.Files...) {
+				if s.ValueAbove == nil || s.valueExceeded(expression, match) {
+					matches = append(matches, match)
+				}
+			}
+
+			if len(matches) == 0 || len(matches) <= s.CountAbove {
+				return nil
+			}
+
+			evidence := []Evidence{}
+			for _, match := range matches[:min(len(matches), maxEvidence)] {
+				evidence = append(evidence, match.Evidence)
+			}
+
+			return []Finding{{
+				Severity: severity,
+				Summary:  fmt.Sprintf("%s (%d matching line(s))", s.Title, len(matches)),
+				Evidence: evidence,
+				Link:     s.Link,
+			}}
+		},
+	}
+}
+
+func (s Signature) valueExceeded(expression *regexp.Regexp, match Match) bool {
+	value, err := strconv.ParseFloat(match.Groups[expression.SubexpIndex("value")], 64)
+	return err == nil && value > *s.ValueAbove
+}
+
+// ParseSeverity parses the name of a severity.
+func ParseSeverity(name string) (Severity, error) {
+	for _, severity := range []Severity{Info, Warning, Critical} {
+		if severity.String() == name {
+			return severity, nil
+		}
+	}
+	return Info, fmt.Errorf("unknown severity %q, must be one of info, warning or critical", name)
+}
@@ -0,0 +1,171 @@
+package analyze_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/analyze"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signatures", func() {
+	parse := func(yaml string) (analyze.Database, error) {
+		return analyze.ParseSignatures([]byte(yaml))
+	}
+
+	run := func(database analyze.Database, files map[string]string) []analyze.Finding {
+		report := map[string][]byte{}
+		for name, contents := range files {
+			report[name] = []byte(contents)
+		}
+		return analyze.Run(analyze.NewReport(report), database.Checks())
+	}
+
+	Describe("the default signatures", func() {
+		var database analyze.Database
+
+		BeforeEach(func() {
+			var err error
+			database, err = analyze.DefaultSignatures()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("contains the known Garden issues", func() {
+			names := []string{}
+			for _, signature := range database.Signatures {
+				names = append(names, signature.Name)
+			}
+			Expect(names).To(ContainElements("keyring-exhaustion", "xfs-quota-corruption", "overlay-mount-leak", "iptables-lock-contention"))
+		})
+
+		It("recognises keyring exhaustion in the Garden logs", func() {
+			findings := run(database, map[string]string{
+				"garden/garden.log": `{"message":"guardian.create.containerizer-create.runtime-create.runc","data":{"error":"could not create session key: disk quota exceeded"}}`,
+			})
+
+			Expect(findings).To(HaveLen(1))
+			Expect(findings[0].Check).To(Equal("keyring-exhaustion"))
+			Expect(findings[0].Severity).To(Equal(analyze.Critical))
+			Expect(findings[0].Evidence).To(Equal([]analyze.Evidence{{File: "garden/garden.log", Line: 1}}))
+			Expect(findings[0].Link).NotTo(BeEmpty())
+		})
+
+		It("only reports overlay mount leaks past the threshold", func() {
+			mount := "1234 25 0:123 / /var/vcap/data/grootfs/store/unprivileged/images/abc/rootfs rw - overlay overlay rw\n"
+			few, many := "", ""
+			for i := 0; i < 1001; i++ {
+				many += mount
+				if i < 10 {
+					few += mount
+				}
+			}
+
+			Expect(run(database, map[string]string{"mountinfo.log": few})).To(BeEmpty())
+			Expect(run(database, map[string]string{"mountinfo.log": many})).To(ConsistOf(HaveField("Check", "overlay-mount-leak")))
+		})
+	})
+
+	Describe("a signature", func() {
+		It("reports the matching lines with the title and link", func() {
+			database, err := parse(`
+signatures:
+- name: segfault
+  title: A process crashed
+  severity: warning
+  link: https://example.com/segfault
+  files: [dmesg.log]
+  pattern: segfault at
+`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(run(database, map[string]string{"dmesg.log": "fine\ngdn[123]: segfault at 0\nrunc[4]: segfault at 8\n"})).To(ConsistOf(analyze.Finding{
+				Severity: analyze.Warning,
+				Check:    "segfault",
+				Summary:  "A process crashed (2 matching line(s))",
+				Evidence: []analyze.Evidence{{File: "dmesg.log", Line: 2}, {File: "dmesg.log", Line: 3}},
+				Link:     "https://example.com/segfault",
+			}))
+		})
+
+		It("only matches when more lines than count_above match", func() {
+			database, err := parse(`
+signatures:
+- {name: retries, title: Retries, severity: info, files: ["*.log"], pattern: retrying, count_above: 2}
+`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(run(database, map[string]string{"a.log": "retrying\n", "b.log": "retrying\n"})).To(BeEmpty())
+			Expect(run(database, map[string]string{"a.log": "retrying\nretrying\n", "b.log": "retrying\n"})).To(HaveLen(1))
+		})
+
+		It("only counts lines whose value exceeds value_above", func() {
+			database, err := parse(`
+signatures:
+- name: load
+  title: High load
+  severity: warning
+  files: [uptime.log]
+  pattern: 'load average: (?P<value>[0-9.]+)'
+  value_above: 50
+`)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(run(database, map[string]string{"uptime.log": " 10:00:00 up 1 day,  load average: 12.50, 10.00, 9.00\n"})).To(BeEmpty())
+			Expect(run(database, map[string]string{"uptime.log": " 10:00:00 up 1 day,  load average: 72.50, 60.00, 40.00\n"})).To(HaveLen(1))
+		})
+	})
+
+	Describe("ParseSignatures", func() {
+		It("rejects unknown severities", func() {
+			_, err := parse(`{signatures: [{name: a, title: A, severity: fatal, files: [a.log], pattern: a}]}`)
+			Expect(err).To(MatchError(ContainSubstring(`unknown severity "fatal"`)))
+		})
+
+		It("rejects invalid patterns", func() {
+			_, err := parse(`{signatures: [{name: a, title: A, severity: info, files: [a.log], pattern: "a("}]}`)
+			Expect(err).To(MatchError(ContainSubstring(`signature "a" has invalid pattern`)))
+		})
+
+		It("rejects signatures without files", func() {
+			_, err := parse(`{signatures: [{name: a, title: A, severity: info, pattern: a}]}`)
+			Expect(err).To(MatchError(ContainSubstring(`signature "a" has no files`)))
+		})
+
+		It("rejects value_above without a value group", func() {
+			_, err := parse(`{signatures: [{name: a, title: A, severity: info, files: [a.log], pattern: "(\\d+)", value_above: 1}]}`)
+			Expect(err).To(MatchError(ContainSubstring("has no group named value")))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := parse(`{signatures: [{name: a, title: A, severity: info, files: [a.log], pattern: a, regex: b}]}`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("LoadSignatures", func() {
+		It("extends and overrides the default signatures", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "signatures.yml")
+			Expect(os.WriteFile(path, []byte(`
+signatures:
+- {name: iptables-lock-contention, disabled: true}
+- {name: custom, title: Custom, severity: info, files: [a.log], pattern: a}
+`), 0644)).To(Succeed())
+
+			database, err := analyze.LoadSignatures(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := []string{}
+			for _, check := range database.Checks() {
+				names = append(names, check.Name)
+			}
+			Expect(names).To(ContainElements("keyring-exhaustion", "custom"))
+			Expect(names).NotTo(ContainElement("iptables-lock-contention"))
+		})
+
+		It("fails when the file does not exist", func() {
+			_, err := analyze.LoadSignatures("/does/not/exist")
+			Expect(err).To(MatchError(ContainSubstring("failed to read signatures")))
+		})
+	})
+})
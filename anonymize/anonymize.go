@@ -0,0 +1,254 @@
+// Package anonymize replaces IP addresses, host names, container handles and
+// GUIDs in collected artifacts with stable pseudonyms, keeping a mapping that
+// allows the operator to translate findings back.
+package anonymize
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/dontpanic/linewriter"
+)
+
+// Kinds of values that are pseudonymized. The kind is the prefix of the
+// pseudonyms it is given, e.g. ipv4-1.
+const (
+	KindIPv4      = "ipv4"
+	KindIPv6      = "ipv6"
+	KindHost      = "host"
+	KindContainer = "container"
+	KindGUID      = "guid"
+)
+
+var (
+	guidPattern = regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`)
+	ipv4Pattern = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b`)
+	// ipv6Pattern finds candidates only, they are validated by parsing
+	ipv6Pattern      = regexp.MustCompile(`[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7}(?:%[0-9A-Za-z]+)?`)
+	pseudonymPattern = regexp.MustCompile(`^(` + strings.Join([]string{KindIPv4, KindIPv6, KindHost, KindContainer, KindGUID}, "|") + `)-([0-9]+)$`)
+)
+
+// Anonymizer rewrites artifacts. It is safe for concurrent use, and a value
+// gets the same pseudonym wherever it appears.
+type Anonymizer struct {
+	mu         sync.Mutex
+	terms      []term
+	pseudonyms map[string]string
+	originals  map[string]string
+	counts     map[string]int
+}
+
+// term is a literal value, such as the host name, that is replaced
+// wherever it appears rather than only where it looks like an address.
+type term struct {
+	value string
+	kind  string
+}
+
+func New() *Anonymizer {
+	return &Anonymizer{
+		pseudonyms: map[string]string{},
+		originals:  map[string]string{},
+		counts:     map[string]int{},
+	}
+}
+
+// AddHostname makes the anonymizer replace the given host name. Both the
+// name and its first label are replaced, as tools differ in which one they
+// print.
+func (a *Anonymizer) AddHostname(hostname string) {
+	a.addTerm(hostname, KindHost)
+	if short, _, found := strings.Cut(hostname, "."); found {
+		a.addTerm(short, KindHost)
+	}
+}
+
+// AddContainerHandle makes the anonymizer replace the given container
+// handle.
+func (a *Anonymizer) AddContainerHandle(handle string) {
+	a.addTerm(handle, KindContainer)
+}
+
+func (a *Anonymizer) addTerm(value, kind string) {
+	if value == "" {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, existing := range a.terms {
+		if existing.value == value {
+			return
+		}
+	}
+
+	a.terms = append(a.terms, term{value: value, kind: kind})
+	// Longer terms first, so that a short host name never replaces part of
+	// the fully qualified one
+	sort.SliceStable(a.terms, func(i, j int) bool { return len(a.terms[i].value) > len(a.terms[j].value) })
+}
+
+// Pseudonym returns the pseudonym for a value of the given kind, assigning
+// the next free one if the value has not been seen before.
+func (a *Anonymizer) Pseudonym(kind, value string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if pseudonym, ok := a.pseudonyms[value]; ok {
+		return pseudonym
+	}
+
+	a.counts[kind]++
+	pseudonym := fmt.Sprintf("%s-%d", kind, a.counts[kind])
+	a.pseudonyms[value] = pseudonym
+	a.originals[pseudonym] = value
+	return pseudonym
+}
+
+// Anonymize returns s with every value replaced by its pseudonym.
+func (a *Anonymizer) Anonymize(s string) string {
+	return string(a.AnonymizeBytes([]byte(s)))
+}
+
+func (a *Anonymizer) AnonymizeBytes(line []byte) []byte {
+	a.mu.Lock()
+	terms := a.terms
+	a.mu.Unlock()
+
+	for _, term := range terms {
+		if bytes.Contains(line, []byte(term.value)) {
+			line = bytes.ReplaceAll(line, []byte(term.value), []byte(a.Pseudonym(term.kind, term.value)))
+		}
+	}
+
+	line = guidPattern.ReplaceAllFunc(line, func(guid []byte) []byte {
+		return []byte(a.Pseudonym(KindGUID, strings.ToLower(string(guid))))
+	})
+
+	line = ipv4Pattern.ReplaceAllFunc(line, func(candidate []byte) []byte {
+		addr, err := netip.ParseAddr(string(candidate))
+		if err != nil || !sensitive(addr) {
+			return candidate
+		}
+		return []byte(a.Pseudonym(KindIPv4, addr.String()))
+	})
+
+	return ipv6Pattern.ReplaceAllFunc(line, func(candidate []byte) []byte {
+		// The pattern also picks up the colon separating an address from
+		// a preceding label, as in "addr:fe80::1"
+		prefix := ""
+		if bytes.HasPrefix(candidate, []byte(":")) && !bytes.HasPrefix(candidate, []byte("::")) {
+			prefix, candidate = ":", candidate[1:]
+		}
+
+		addr, err := netip.ParseAddr(string(candidate))
+		if err != nil || !addr.Is6() || !sensitive(addr) {
+			return append([]byte(prefix), candidate...)
+		}
+		return []byte(prefix + a.Pseudonym(KindIPv6, addr.WithZone("").String()))
+	})
+}
+
+// sensitive reports whether an address could identify a host. Loopback
+// and unspecified addresses, and netmasks, are the same everywhere.
+func sensitive(addr netip.Addr) bool {
+	if addr.IsLoopback() || addr.IsUnspecified() {
+		return false
+	}
+
+	if addr.Is4() {
+		bits := uint32(0)
+		for _, b := range addr.As4() {
+			bits = bits<<8 | uint32(b)
+		}
+		if isNetmask(bits) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNetmask(bits uint32) bool {
+	inverted := ^bits
+	return inverted&(inverted+1) == 0
+}
+
+// Mapping returns every pseudonym handed out so far with the value it
+// replaces.
+func (a *Anonymizer) Mapping() map[string]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	mapping := make(map[string]string, len(a.originals))
+	for pseudonym, original := range a.originals {
+		mapping[pseudonym] = original
+	}
+	return mapping
+}
+
+// LoadMapping reads a mapping written by SaveMapping, so that values keep
+// the pseudonyms they were given in earlier reports. A missing file is not
+// an error.
+func (a *Anonymizer) LoadMapping(path string) error {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var mapping map[string]string
+	if err := json.Unmarshal(contents, &mapping); err != nil {
+		return fmt.Errorf("failed to parse anonymization mapping %s: %w", path, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for pseudonym, original := range mapping {
+		matches := pseudonymPattern.FindStringSubmatch(pseudonym)
+		if matches == nil {
+			return fmt.Errorf("invalid pseudonym %q in anonymization mapping %s", pseudonym, path)
+		}
+
+		kind := matches[1]
+		n, _ := strconv.Atoi(matches[2])
+		a.pseudonyms[original] = pseudonym
+		a.originals[pseudonym] = original
+		a.counts[kind] = max(a.counts[kind], n)
+	}
+
+	return nil
+}
+
+// SaveMapping writes the mapping to path, readable by its owner only.
+func (a *Anonymizer) SaveMapping(path string) error {
+	contents, err := json.MarshalIndent(a.Mapping(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(contents, '\n'), 0600)
+}
+
+// NewWriter returns a writer that anonymizes everything written to it
+// before passing it on to w. Like redaction, anonymization is line based,
+// and gzip compressed content is anonymized decompressed. Other binary
+// content cannot be anonymized, so it is dropped.
+func (a *Anonymizer) NewWriter(w io.WriteCloser) *linewriter.Writer {
+	writer := linewriter.New(w, a.AnonymizeBytes)
+	writer.DropBinary()
+	return writer
+}
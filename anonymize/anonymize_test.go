@@ -0,0 +1,157 @@
+package anonymize_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/anonymize"
+	"code.cloudfoundry.org/dontpanic/linewriter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Anonymizer", func() {
+	var anonymizer *anonymize.Anonymizer
+
+	BeforeEach(func() {
+		anonymizer = anonymize.New()
+	})
+
+	DescribeTable("replacing identifiers",
+		func(line, expected string) {
+			Expect(anonymizer.Anonymize(line)).To(Equal(expected))
+		},
+		Entry("IPv4 addresses", "inet 10.0.16.5  netmask 255.255.255.0", "inet ipv4-1  netmask 255.255.255.0"),
+		Entry("IPv4 networks", "-A w--instance -s 10.255.0.0/22 -j ACCEPT", "-A w--instance -s ipv4-1/22 -j ACCEPT"),
+		Entry("IPv6 addresses", "inet6 fe80::fc:ff:fe00:1  prefixlen 64", "inet6 ipv6-1  prefixlen 64"),
+		Entry("IPv6 addresses with zones", "fe80::1%eth0 reachable", "ipv6-1 reachable"),
+		Entry("IPv6 addresses after a label", "inet6 addr:2001:db8::7/64 Scope:Global", "inet6 addr:ipv6-1/64 Scope:Global"),
+		Entry("GUIDs", "app 6F1B2C3D-1A2B-4C5D-8E9F-0A1B2C3D4E5F crashed", "app guid-1 crashed"),
+	)
+
+	DescribeTable("leaving alone",
+		func(line string) {
+			Expect(anonymizer.Anonymize(line)).To(Equal(line))
+		},
+		Entry("loopback addresses", "listening on 127.0.0.1:7777 and [::1]:7777"),
+		Entry("unspecified addresses", "0.0.0.0/0 and ::/0"),
+		Entry("netmasks", "Mask:255.255.240.0"),
+		Entry("times", "Oct 17 12:34:56 kernel: eth0 up"),
+		Entry("MAC addresses", "ether 02:42:ac:11:00:02  txqueuelen 0"),
+		Entry("invalid addresses", "version 999.1.2.3"),
+	)
+
+	It("gives a value the same pseudonym everywhere", func() {
+		Expect(anonymizer.Anonymize("10.0.0.1 -> 10.0.0.2")).To(Equal("ipv4-1 -> ipv4-2"))
+		Expect(anonymizer.Anonymize("from 10.0.0.2")).To(Equal("from ipv4-2"))
+	})
+
+	It("replaces the host name and its first label", func() {
+		anonymizer.AddHostname("cell-3.example.internal")
+		Expect(anonymizer.Anonymize("cell-3.example.internal and cell-3 are the same")).To(Equal("host-1 and host-2 are the same"))
+	})
+
+	It("replaces container handles", func() {
+		anonymizer.AddContainerHandle("my-app-handle")
+		Expect(anonymizer.Anonymize("/var/vcap/data/garden/depot/my-app-handle/config.json")).To(Equal("/var/vcap/data/garden/depot/container-1/config.json"))
+	})
+
+	It("lists the pseudonyms with the values they replace", func() {
+		anonymizer.Anonymize("10.0.0.1 fe80::1")
+		Expect(anonymizer.Mapping()).To(Equal(map[string]string{"ipv4-1": "10.0.0.1", "ipv6-1": "fe80::1"}))
+	})
+
+	Describe("the mapping file", func() {
+		var mappingFile string
+
+		BeforeEach(func() {
+			tmpDir := GinkgoT().TempDir()
+			mappingFile = filepath.Join(tmpDir, "mapping.json")
+		})
+
+		It("is readable by its owner only", func() {
+			Expect(anonymizer.SaveMapping(mappingFile)).To(Succeed())
+
+			info, err := os.Stat(mappingFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+
+		It("keeps pseudonyms stable across reports", func() {
+			anonymizer.Anonymize("10.0.0.1 10.0.0.2")
+			Expect(anonymizer.SaveMapping(mappingFile)).To(Succeed())
+
+			next := anonymize.New()
+			Expect(next.LoadMapping(mappingFile)).To(Succeed())
+			Expect(next.Anonymize("10.0.0.3 10.0.0.2")).To(Equal("ipv4-3 ipv4-2"))
+		})
+
+		It("is optional", func() {
+			Expect(anonymizer.LoadMapping(mappingFile)).To(Succeed())
+		})
+
+		It("rejects invalid pseudonyms", func() {
+			Expect(os.WriteFile(mappingFile, []byte(`{"bogus": "10.0.0.1"}`), 0600)).To(Succeed())
+			Expect(anonymizer.LoadMapping(mappingFile)).To(MatchError(ContainSubstring(`invalid pseudonym "bogus"`)))
+		})
+	})
+
+	Describe("NewWriter", func() {
+		It("anonymizes lines split across writes", func() {
+			var out bytes.Buffer
+			writer := anonymizer.NewWriter(nopCloser{&out})
+
+			_, err := io.WriteString(writer, "addr 10.0.")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.WriteString(writer, "0.1\nlast 10.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(out.String()).To(Equal("addr ipv4-1\nlast ipv4-1"))
+		})
+
+		It("drops binary content", func() {
+			var out bytes.Buffer
+			writer := anonymizer.NewWriter(nopCloser{&out})
+
+			_, err := io.WriteString(writer, "\x00 10.0.0.1\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(out.String()).To(Equal(linewriter.DroppedMarker))
+			Expect(writer.Binary()).To(BeTrue())
+		})
+
+		It("anonymizes gzip compressed content", func() {
+			anonymizer.AddHostname("cell-host")
+
+			var compressed bytes.Buffer
+			gz := gzip.NewWriter(&compressed)
+			_, err := io.WriteString(gz, "connection from 10.1.2.3 to cell-host\n")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(gz.Close()).To(Succeed())
+
+			var out bytes.Buffer
+			writer := anonymizer.NewWriter(nopCloser{&out})
+			_, err = writer.Write(compressed.Bytes())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			reader, err := gzip.NewReader(&out)
+			Expect(err).NotTo(HaveOccurred())
+			anonymized, err := io.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(anonymized)).To(Equal("connection from ipv4-1 to host-1\n"))
+			Expect(writer.Binary()).To(BeFalse())
+		})
+	})
+})
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
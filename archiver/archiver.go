@@ -0,0 +1,271 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Writer writes a gzip compressed tarball whose entries all live under a
+// single top-level directory. It is safe for concurrent use.
+type Writer struct {
+	root     string
+	spoolDir string
+	mu       sync.Mutex
+	gz       *gzip.Writer
+	tw       *tar.Writer
+}
+
+func NewWriter(w io.Writer, root string) *Writer {
+	gz := gzip.NewWriter(w)
+	return &Writer{
+		root:     root,
+		spoolDir: os.TempDir(),
+		gz:       gz,
+		tw:       tar.NewWriter(gz),
+	}
+}
+
+// SetSpoolDir sets the directory used to hold large entries created with
+// Create until they are complete. It is created when first needed.
+func (w *Writer) SetSpoolDir(dir string) {
+	w.spoolDir = dir
+}
+
+// MaxBufferedEntry is how much of an entry created with Create is held in
+// memory. Larger entries are spooled to a file in the spool directory.
+const MaxBufferedEntry = 1 << 20
+
+// Create returns a writer for a new regular file entry. As the size of a tar
+// entry must be known up front, the contents are held back, in memory or in
+// a spool file once they outgrow MaxBufferedEntry, and only added to the
+// archive when the returned writer is closed.
+func (w *Writer) Create(name string) (io.WriteCloser, error) {
+	return &pendingEntry{name: name, writer: w}, nil
+}
+
+// AddDir adds a directory entry. name is relative to the top-level directory.
+func (w *Writer) AddDir(name string, info fs.FileInfo) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeHeader(name, info, "")
+}
+
+// AddFile adds a regular file entry with the given contents. The reader must
+// provide exactly info.Size() bytes.
+func (w *Writer) AddFile(name string, info fs.FileInfo, contents io.Reader) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.writeHeader(name, info, ""); err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(w.tw, contents); err != nil {
+		return fmt.Errorf("failed to write %q to archive: %w", name, err)
+	}
+
+	return nil
+}
+
+// AddSymlink adds a symbolic link entry pointing to target.
+func (w *Writer) AddSymlink(name string, info fs.FileInfo, target string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writeHeader(name, info, target)
+}
+
+func (w *Writer) writeHeader(name string, info fs.FileInfo, link string) error {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("failed to create archive header for %q: %w", name, err)
+	}
+
+	header.Name = filepath.ToSlash(filepath.Join(w.root, name))
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.Format = tar.FormatPAX
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "root", "root"
+	header.Mode = int64(sanitizeMode(info))
+
+	if err := w.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive header for %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gz.Close()
+}
+
+// ArchiveDir writes every file under dir into the archive, rooted at the
+// archive's top-level directory.
+func (w *Writer) ArchiveDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			name = ""
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			return w.AddDir(name, info)
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return w.AddSymlink(name, info, target)
+		case info.Mode().IsRegular():
+			return w.addRegularFile(name, path, info)
+		}
+
+		// devices, sockets and pipes cannot be meaningfully archived
+		return nil
+	})
+}
+
+func (w *Writer) addRegularFile(name, path string, info fs.FileInfo) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Files may grow or shrink while being archived, so always write exactly
+	// the size recorded in the header.
+	return w.AddFile(name, info, io.LimitReader(io.MultiReader(file, zeros{}), info.Size()))
+}
+
+type pendingEntry struct {
+	name   string
+	writer *Writer
+	buffer bytes.Buffer
+	spool  *os.File
+}
+
+func (e *pendingEntry) Write(p []byte) (int, error) {
+	if e.spool == nil && e.buffer.Len()+len(p) > MaxBufferedEntry {
+		if err := e.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	if e.spool != nil {
+		return e.spool.Write(p)
+	}
+	return e.buffer.Write(p)
+}
+
+// spill moves the buffered contents to a spool file, where the rest of the
+// entry is written.
+func (e *pendingEntry) spill() error {
+	if err := os.MkdirAll(e.writer.spoolDir, 0700); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	spool, err := os.CreateTemp(e.writer.spoolDir, "entry-")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file for %q: %w", e.name, err)
+	}
+
+	if _, err := spool.Write(e.buffer.Bytes()); err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return fmt.Errorf("failed to spool %q: %w", e.name, err)
+	}
+
+	e.buffer = bytes.Buffer{}
+	e.spool = spool
+	return nil
+}
+
+func (e *pendingEntry) Close() error {
+	if e.spool == nil {
+		return e.writer.AddFile(e.name, e.info(int64(e.buffer.Len())), &e.buffer)
+	}
+
+	defer os.Remove(e.spool.Name())
+	defer e.spool.Close()
+
+	info, err := e.spool.Stat()
+	if err != nil {
+		return err
+	}
+
+	if _, err := e.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return e.writer.AddFile(e.name, e.info(info.Size()), e.spool)
+}
+
+func (e *pendingEntry) info(size int64) entryInfo {
+	return entryInfo{name: path.Base(e.name), size: size, modTime: time.Now()}
+}
+
+// entryInfo describes a regular file entry that does not exist on disk under
+// its archive name.
+type entryInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i entryInfo) Name() string       { return i.name }
+func (i entryInfo) Size() int64        { return i.size }
+func (i entryInfo) Mode() fs.FileMode  { return 0644 }
+func (i entryInfo) ModTime() time.Time { return i.modTime }
+func (i entryInfo) IsDir() bool        { return false }
+func (i entryInfo) Sys() any           { return nil }
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func sanitizeMode(info fs.FileInfo) fs.FileMode {
+	if info.IsDir() {
+		return 0755
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return 0777
+	}
+	if info.Mode().Perm()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
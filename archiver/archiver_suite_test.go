@@ -0,0 +1,13 @@
+package archiver_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestArchiver(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Archiver Suite")
+}
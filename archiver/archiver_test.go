@@ -0,0 +1,201 @@
+package archiver_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/archiver"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		workDir     string
+		tarballPath string
+		writer      *archiver.Writer
+		file        *os.File
+	)
+
+	BeforeEach(func() {
+		var err error
+		workDir, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		tarballPath = filepath.Join(workDir, "report.tar.gz")
+		file, err = os.Create(tarballPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer = archiver.NewWriter(file, "report")
+		writer.SetSpoolDir(workDir)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(workDir)).To(Succeed())
+	})
+
+	closeArchive := func() {
+		Expect(writer.Close()).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+	}
+
+	Describe("ArchiveDir", func() {
+		var (
+			reportDir string
+			modTime   time.Time
+		)
+
+		BeforeEach(func() {
+			reportDir = filepath.Join(workDir, "os-report")
+			modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+			Expect(os.MkdirAll(filepath.Join(reportDir, "sub"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(reportDir, "hello"), []byte("hello"), 0600)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(reportDir, "sub", "script"), []byte("#!/bin/sh"), 0700)).To(Succeed())
+			Expect(os.Symlink("../hello", filepath.Join(reportDir, "sub", "link"))).To(Succeed())
+			Expect(os.Chtimes(filepath.Join(reportDir, "hello"), modTime, modTime)).To(Succeed())
+		})
+
+		It("archives all files under the top-level directory", func() {
+			Expect(writer.ArchiveDir(reportDir)).To(Succeed())
+			closeArchive()
+
+			entries := readTarball(tarballPath)
+			Expect(entries).To(HaveKey("report/"))
+			Expect(entries).To(HaveKey("report/sub/"))
+			Expect(entries["report/hello"].contents).To(Equal("hello"))
+			Expect(entries["report/sub/script"].contents).To(Equal("#!/bin/sh"))
+			Expect(entries["report/sub/link"].header.Linkname).To(Equal("../hello"))
+		})
+
+		It("normalises file modes and ownership", func() {
+			Expect(writer.ArchiveDir(reportDir)).To(Succeed())
+			closeArchive()
+
+			entries := readTarball(tarballPath)
+			Expect(entries["report/"].header.Mode).To(BeEquivalentTo(0755))
+			Expect(entries["report/hello"].header.Mode).To(BeEquivalentTo(0644))
+			Expect(entries["report/sub/script"].header.Mode).To(BeEquivalentTo(0755))
+			Expect(entries["report/hello"].header.Uid).To(BeZero())
+			Expect(entries["report/hello"].header.Uname).To(Equal("root"))
+		})
+
+		It("preserves modification times", func() {
+			Expect(writer.ArchiveDir(reportDir)).To(Succeed())
+			closeArchive()
+
+			Expect(readTarball(tarballPath)["report/hello"].header.ModTime).To(BeTemporally("==", modTime))
+		})
+
+		It("fails when the directory cannot be read", func() {
+			Expect(writer.ArchiveDir(filepath.Join(workDir, "does-not-exist"))).NotTo(Succeed())
+		})
+	})
+
+	Describe("Create", func() {
+		It("adds the entry once it is closed", func() {
+			entry, err := writer.Create("sub/entry.log")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.WriteString(entry, "streamed")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entry.Close()).To(Succeed())
+			closeArchive()
+
+			entries := readTarball(tarballPath)
+			Expect(entries["report/sub/entry.log"].contents).To(Equal("streamed"))
+			Expect(entries["report/sub/entry.log"].header.Mode).To(BeEquivalentTo(0644))
+		})
+
+		It("supports entries being written concurrently", func() {
+			first, err := writer.Create("first")
+			Expect(err).NotTo(HaveOccurred())
+			second, err := writer.Create("second")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = io.WriteString(first, "one")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.WriteString(second, "two")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(second.Close()).To(Succeed())
+			Expect(first.Close()).To(Succeed())
+			closeArchive()
+
+			entries := readTarball(tarballPath)
+			Expect(entries["report/first"].contents).To(Equal("one"))
+			Expect(entries["report/second"].contents).To(Equal("two"))
+		})
+
+		It("keeps small entries in memory", func() {
+			entry, err := writer.Create("entry")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.WriteString(entry, "small")
+			Expect(err).NotTo(HaveOccurred())
+
+			spooled, err := filepath.Glob(filepath.Join(workDir, "entry-*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spooled).To(BeEmpty())
+
+			Expect(entry.Close()).To(Succeed())
+			closeArchive()
+			Expect(readTarball(tarballPath)["report/entry"].contents).To(Equal("small"))
+		})
+
+		It("spools large entries and removes the spool files", func() {
+			contents := strings.Repeat("x", archiver.MaxBufferedEntry+10)
+			entry, err := writer.Create("entry")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.WriteString(entry, contents[:100])
+			Expect(err).NotTo(HaveOccurred())
+			_, err = io.WriteString(entry, contents[100:])
+			Expect(err).NotTo(HaveOccurred())
+
+			spooled, err := filepath.Glob(filepath.Join(workDir, "entry-*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spooled).To(HaveLen(1))
+
+			Expect(entry.Close()).To(Succeed())
+			closeArchive()
+			Expect(readTarball(tarballPath)["report/entry"].contents).To(Equal(contents))
+
+			spooled, err = filepath.Glob(filepath.Join(workDir, "entry-*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(spooled).To(BeEmpty())
+		})
+	})
+})
+
+type tarEntry struct {
+	header   *tar.Header
+	contents string
+}
+
+func readTarball(path string) map[string]tarEntry {
+	file, err := os.Open(path)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+	entries := map[string]tarEntry{}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+
+		contents, err := io.ReadAll(reader)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		entries[header.Name] = tarEntry{header: header, contents: string(contents)}
+	}
+
+	return entries
+}
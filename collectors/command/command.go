@@ -2,72 +2,128 @@ package command
 
 import (
 	"context"
+	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 
 	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 )
 
-type createOutputStream func(dir, filepath string) (io.WriteCloser, error)
+type createOutputStream func(sink osreporter.Sink, filename string) (io.WriteCloser, error)
 
 type Collector struct {
-	cmd                 string
+	pipeline            commandrunner.Pipeline
 	filename            string
+	maxBytes            int64
 	runner              commandrunner.CommandRunner
 	outputStreamFactory createOutputStream
 }
 
-func NewCollector(cmd, filename string) Collector {
+func NewCollector(pipeline commandrunner.Pipeline, filename string) Collector {
 	return Collector{
-		cmd:                 cmd,
+		pipeline:            pipeline,
 		filename:            filename,
 		runner:              commandrunner.CommandRunner{},
 		outputStreamFactory: newFileOutputStream,
 	}
 }
 
-func NewDiscardCollector(cmd string) Collector {
+func NewDiscardCollector(pipeline commandrunner.Pipeline) Collector {
 	return Collector{
-		cmd:                 cmd,
+		pipeline:            pipeline,
 		runner:              commandrunner.CommandRunner{},
 		outputStreamFactory: newDiscardStream,
 	}
 }
 
-func newDiscardStream(_, _ string) (io.WriteCloser, error) {
+func newDiscardStream(_ osreporter.Sink, _ string) (io.WriteCloser, error) {
 	return discardWriter{}, nil
 }
 
-func newFileOutputStream(destPath, filePath string) (io.WriteCloser, error) {
-	outPath := filepath.Join(destPath, filePath)
+func newFileOutputStream(sink osreporter.Sink, filename string) (io.WriteCloser, error) {
+	return sink.Create(filename)
+}
 
-	err := os.MkdirAll(filepath.Dir(outPath), 0755)
-	if err != nil {
-		return nil, err
+// WithMaxBytes returns the collector truncating the output of its command
+// after the given number of bytes. Zero means no limit.
+func (c Collector) WithMaxBytes(maxBytes int64) Collector {
+	c.maxBytes = maxBytes
+	return c
+}
+
+// Source returns the script of shell commands, or the pipeline as it would
+// be written for a shell.
+func (c Collector) Source() string {
+	if script, ok := c.pipeline.Script(); ok {
+		return script
 	}
+	return c.pipeline.String()
+}
 
-	return os.Create(outPath)
+// Argv returns the argv of each stage of the pipeline, as run.
+func (c Collector) Argv() [][]string {
+	return c.pipeline
 }
 
-func (c Collector) Run(ctx context.Context, destPath string, stdout io.Writer) error {
-	out, err := c.runner.Run(ctx, "sh", "-c", c.cmd)
+// Run streams whatever the command writes to stdout to the output file, even
+// if it fails or times out, and writes what it wrote to stderr to a sibling
+// .stderr file.
+func (c Collector) Run(ctx context.Context, sink osreporter.Sink, stdout io.Writer) error {
+	output := &lazyStream{create: func() (io.WriteCloser, error) {
+		return c.outputStreamFactory(sink, c.filename)
+	}}
+	limited := &limitedWriter{writer: io.MultiWriter(output, stdout), maxBytes: c.maxBytes}
+
+	result, err := c.runner.Stream(ctx, limited, c.pipeline)
+
+	limited.finish()
+	// Commands that fail without any output leave no empty file behind
+	if err == nil {
+		output.open()
+	}
+	if closeErr := output.Close(); output.err == nil {
+		output.err = closeErr
+	}
+	if output.err != nil {
+		return output.err
+	}
+	if recorder, ok := sink.(osreporter.TruncationRecorder); ok && limited.dropped > 0 && output.stream != nil {
+		recorder.RecordTruncated(c.filename, limited.dropped)
+	}
+
+	if len(result.Stderr) > 0 {
+		if writeErr := c.write(sink, c.filename+".stderr", result.Stderr, io.Discard); writeErr != nil {
+			return writeErr
+		}
+	}
+
 	if err != nil {
-		return err
+		return &osreporter.CommandError{
+			Err: err,
+			Exit: osreporter.Exit{
+				Code:      result.ExitCode,
+				Signal:    result.Signal,
+				Truncated: ctx.Err() != nil || limited.dropped > 0,
+			},
+		}
 	}
 
-	outStream, err := c.outputStreamFactory(destPath, c.filename)
+	return nil
+}
+
+func (c Collector) write(sink osreporter.Sink, filename string, contents []byte, echo io.Writer) error {
+	outStream, err := c.outputStreamFactory(sink, filename)
 	if err != nil {
 		return err
 	}
-	defer outStream.Close()
 
-	_, err = io.MultiWriter(outStream, stdout).Write(out)
+	_, err = io.MultiWriter(outStream, echo).Write(contents)
 	if err != nil {
+		outStream.Close()
 		return err
 	}
 
-	return nil
+	return outStream.Close()
 }
 
 type discardWriter struct{}
@@ -79,3 +135,68 @@ func (dc discardWriter) Close() error {
 func (dc discardWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
+
+// lazyStream creates the output stream on the first write. Once creating or
+// writing to it fails, it discards the rest of the output so that the
+// command still runs to completion, and keeps the error.
+type lazyStream struct {
+	create func() (io.WriteCloser, error)
+	stream io.WriteCloser
+	err    error
+}
+
+func (l *lazyStream) open() {
+	if l.stream == nil && l.err == nil {
+		l.stream, l.err = l.create()
+	}
+}
+
+func (l *lazyStream) Write(p []byte) (int, error) {
+	l.open()
+	if l.err != nil {
+		return len(p), nil
+	}
+
+	if _, err := l.stream.Write(p); err != nil {
+		l.err = err
+	}
+	return len(p), nil
+}
+
+func (l *lazyStream) Close() error {
+	if l.stream == nil {
+		return nil
+	}
+	return l.stream.Close()
+}
+
+// limitedWriter writes up to maxBytes bytes and drops the rest, marking the
+// output as truncated when finished. Zero means no limit.
+type limitedWriter struct {
+	writer   io.Writer
+	maxBytes int64
+	written  int64
+	dropped  int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.maxBytes > 0 && l.written+int64(len(p)) > l.maxBytes {
+		keep := l.maxBytes - l.written
+		l.dropped += int64(len(p)) - keep
+		p = p[:keep]
+	}
+
+	written, err := l.writer.Write(p)
+	l.written += int64(written)
+	if err != nil {
+		return written, err
+	}
+	return n, nil
+}
+
+func (l *limitedWriter) finish() {
+	if l.dropped > 0 {
+		fmt.Fprintf(l.writer, "\n[dontpanic: output truncated after %d bytes, %d more bytes dropped]\n", l.maxBytes, l.dropped)
+	}
+}
@@ -2,12 +2,16 @@ package command_test
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/dontpanic/collectors/command"
+	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
@@ -34,15 +38,19 @@ var _ = Describe("Command Output Collector", func() {
 		var (
 			filename string
 			cmd      string
+			maxBytes int64
+			sink     *truncationRecordingSink
 		)
 
 		BeforeEach(func() {
 			filename = "hello"
+			maxBytes = 0
 		})
 
 		JustBeforeEach(func() {
-			collector = command.NewCollector(cmd, filename)
-			err = collector.Run(ctx, dstPath, stdout)
+			sink = &truncationRecordingSink{DirSink: osreporter.NewDirSink(dstPath)}
+			collector = command.NewCollector(commandrunner.Shell(cmd), filename).WithMaxBytes(maxBytes)
+			err = collector.Run(ctx, sink, stdout)
 		})
 
 		When("cmd is a simple executable", func() {
@@ -75,6 +83,47 @@ var _ = Describe("Command Output Collector", func() {
 			})
 		})
 
+		When("cmd writes a lot of output", func() {
+			BeforeEach(func() {
+				cmd = "seq 1 100000"
+			})
+
+			It("writes all of it", func() {
+				Expect(err).NotTo(HaveOccurred())
+				fileContents, err := os.ReadFile(filepath.Join(dstPath, filename))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(strings.Count(string(fileContents), "\n")).To(Equal(100000))
+				Expect(sink.dropped).To(BeEmpty())
+			})
+
+			When("the output is limited", func() {
+				BeforeEach(func() {
+					maxBytes = 10
+				})
+
+				It("truncates it with a marker", func() {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(os.ReadFile(filepath.Join(dstPath, filename))).To(Equal([]byte("1\n2\n3\n4\n5\n\n[dontpanic: output truncated after 10 bytes, 588885 more bytes dropped]\n")))
+				})
+
+				It("records the truncation", func() {
+					Expect(sink.dropped).To(Equal(map[string]int64{filename: 588885}))
+				})
+
+				When("the command also fails", func() {
+					BeforeEach(func() {
+						cmd = "seq 1 100000; exit 1"
+					})
+
+					It("records the output as truncated", func() {
+						var commandErr *osreporter.CommandError
+						Expect(errors.As(err, &commandErr)).To(BeTrue())
+						Expect(commandErr.Exit).To(Equal(osreporter.Exit{Code: 1, Truncated: true}))
+					})
+				})
+			})
+		})
+
 		When("command fails and has stdout and stderr", func() {
 			BeforeEach(func() {
 				cmd = "echo foo; echo bar >&2; exit 1"
@@ -82,16 +131,83 @@ var _ = Describe("Command Output Collector", func() {
 
 			It("returns error containing bar", func() {
 				Expect(err).To(MatchError(ContainSubstring("bar")))
-				Expect(filepath.Join(dstPath, filename)).NotTo(BeAnExistingFile())
-				Expect(stdout).NotTo(gbytes.Say("foo"))
+			})
+
+			It("still writes the output", func() {
+				Expect(os.ReadFile(filepath.Join(dstPath, filename))).To(Equal([]byte("foo\n")))
+				Expect(stdout).To(gbytes.Say("foo"))
+			})
+
+			It("writes stderr to a sibling file", func() {
+				Expect(os.ReadFile(filepath.Join(dstPath, filename+".stderr"))).To(Equal([]byte("bar\n")))
+			})
+
+			It("records the exit code", func() {
+				var commandErr *osreporter.CommandError
+				Expect(errors.As(err, &commandErr)).To(BeTrue())
+				Expect(commandErr.Exit).To(Equal(osreporter.Exit{Code: 1}))
+			})
+		})
+
+		When("command fails without any output", func() {
+			BeforeEach(func() {
+				cmd = "exit 3"
+			})
+
+			It("does not write any file", func() {
+				Expect(err).To(HaveOccurred())
+				Expect(os.ReadDir(dstPath)).To(BeEmpty())
 			})
 		})
+
+		When("command times out", func() {
+			var cancel context.CancelFunc
+
+			BeforeEach(func() {
+				ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+				cmd = "echo partial; sleep 30"
+			})
+
+			AfterEach(func() {
+				cancel()
+			})
+
+			It("keeps the partial output and records that it was killed", func() {
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+				Expect(os.ReadFile(filepath.Join(dstPath, filename))).To(Equal([]byte("partial\n")))
+
+				var commandErr *osreporter.CommandError
+				Expect(errors.As(err, &commandErr)).To(BeTrue())
+				Expect(commandErr.Exit).To(Equal(osreporter.Exit{Code: -1, Signal: "SIGTERM", Truncated: true}))
+			})
+		})
+	})
+
+	Describe("source", func() {
+		It("is the command", func() {
+			collector = command.NewCollector(commandrunner.Shell("echo hello"), "hello.log")
+			Expect(collector.Source()).To(Equal("echo hello"))
+		})
+
+		It("is the pipeline as written for a shell", func() {
+			collector = command.NewCollector(commandrunner.Pipeline{{"lsof"}, {"wc", "-l"}}, "hello.log")
+			Expect(collector.Source()).To(Equal("lsof | wc -l"))
+			Expect(collector.Argv()).To(Equal([][]string{{"lsof"}, {"wc", "-l"}}))
+		})
+	})
+
+	Describe("pipeline", func() {
+		It("runs without a shell", func() {
+			collector = command.NewCollector(commandrunner.Command("echo", "a b", "$HOME"), "hello")
+			Expect(collector.Run(ctx, osreporter.NewDirSink(dstPath), stdout)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(dstPath, "hello"))).To(Equal([]byte("a b $HOME\n")))
+		})
 	})
 
 	Describe("discard collector", func() {
 		JustBeforeEach(func() {
-			collector = command.NewDiscardCollector("echo hello world")
-			err = collector.Run(ctx, dstPath, stdout)
+			collector = command.NewDiscardCollector(commandrunner.Command("echo", "hello", "world"))
+			err = collector.Run(ctx, osreporter.NewDirSink(dstPath), stdout)
 		})
 
 		It("does not write to a file", func() {
@@ -101,3 +217,17 @@ var _ = Describe("Command Output Collector", func() {
 		})
 	})
 })
+
+// truncationRecordingSink records the truncations reported by collectors, as
+// the sink of a report does.
+type truncationRecordingSink struct {
+	osreporter.DirSink
+	dropped map[string]int64
+}
+
+func (s *truncationRecordingSink) RecordTruncated(name string, dropped int64) {
+	if s.dropped == nil {
+		s.dropped = map[string]int64{}
+	}
+	s.dropped[name] += dropped
+}
@@ -4,18 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-
 	"strings"
 
-	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 )
 
 type Collector struct {
 	sourcePath      string
 	destinationPath string
-	runner          commandrunner.CommandRunner
 	archive         bool
 }
 
@@ -23,7 +23,6 @@ func NewCollector(sourcePath, destinationPath string) Collector {
 	return Collector{
 		sourcePath:      sourcePath,
 		destinationPath: destinationPath,
-		runner:          commandrunner.CommandRunner{},
 	}
 }
 
@@ -31,26 +30,110 @@ func NewDirCollector(sourcePath, destinationPath string) Collector {
 	return Collector{
 		sourcePath:      sourcePath,
 		destinationPath: destinationPath,
-		runner:          commandrunner.CommandRunner{},
 		archive:         true,
 	}
 }
 
-func (c Collector) Run(ctx context.Context, reportDir string, stdout io.Writer) error {
-	fullDestinationPath := filepath.Join(reportDir, c.destinationPath)
-	toMake := fullDestinationPath
-	if !strings.HasSuffix(c.destinationPath, "/") {
-		toMake = filepath.Dir(toMake)
+func (c Collector) Source() string {
+	return c.sourcePath
+}
+
+// Run copies the files matching the source path into the report. When the
+// destination path ends with a slash, or when copying a directory, the
+// copies keep their base names under the destination.
+func (c Collector) Run(ctx context.Context, sink osreporter.Sink, stdout io.Writer) error {
+	matches, err := filepath.Glob(c.sourcePath)
+	if err != nil {
+		return err
+	}
+
+	if len(matches) == 0 {
+		_, err := os.Stat(c.sourcePath)
+		if err == nil {
+			err = fmt.Errorf("%s: no such file or directory", c.sourcePath)
+		}
+		return err
+	}
+
+	intoDir := c.archive || c.destinationPath == "" || strings.HasSuffix(c.destinationPath, "/") || len(matches) > 1
+
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		destination := c.destinationPath
+		if intoDir {
+			destination = path.Join(c.destinationPath, filepath.Base(match))
+		}
+
+		info, err := os.Stat(match)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if !c.archive {
+				return fmt.Errorf("%s is a directory", match)
+			}
+			err = copyDir(ctx, sink, match, destination)
+		} else {
+			err = copyFile(sink, match, destination)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyDir(ctx context.Context, sink osreporter.Sink, sourceDir, destination string) error {
+	return filepath.WalkDir(sourceDir, func(sourcePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(sourceDir, sourcePath)
+		if err != nil {
+			return err
+		}
+
+		info, err := os.Stat(sourcePath)
+		if err != nil || !info.Mode().IsRegular() {
+			// dangling symlinks, sockets and the like have no content to copy
+			return nil
+		}
+
+		return copyFile(sink, sourcePath, path.Join(destination, filepath.ToSlash(relPath)))
+	})
+}
+
+func copyFile(sink osreporter.Sink, sourcePath, destination string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return err
 	}
-	if err := os.MkdirAll(toMake, 0755); err != nil {
+	defer source.Close()
+
+	out, err := sink.Create(destination)
+	if err != nil {
 		return err
 	}
 
-	archive := ""
-	if c.archive {
-		archive = "-a"
+	if _, err := io.Copy(out, source); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", sourcePath, err)
 	}
-	cmd := fmt.Sprintf("cp %s %s %s", archive, c.sourcePath, fullDestinationPath)
-	_, err := c.runner.Run(ctx, "sh", "-c", cmd)
-	return err
+
+	return out.Close()
 }
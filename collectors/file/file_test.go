@@ -11,6 +11,7 @@ import (
 	"github.com/onsi/gomega/gbytes"
 
 	"code.cloudfoundry.org/dontpanic/collectors/file"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 )
 
 var _ = Describe("file.Collector", func() {
@@ -50,7 +51,7 @@ var _ = Describe("file.Collector", func() {
 		})
 
 		JustBeforeEach(func() {
-			collErr = file.NewCollector(sourcePath, "destination_file").Run(ctx, destinationDir, stdout)
+			collErr = file.NewCollector(sourcePath, "destination_file").Run(ctx, osreporter.NewDirSink(destinationDir), stdout)
 		})
 
 		It("copies the specified file to the destination directory", func() {
@@ -70,7 +71,7 @@ var _ = Describe("file.Collector", func() {
 			})
 
 			It("returns an error", func() {
-				Expect(collErr).To(MatchError(ContainSubstring("No such file or directory")))
+				Expect(collErr).To(MatchError(ContainSubstring("no such file or directory")))
 			})
 		})
 
@@ -106,7 +107,7 @@ var _ = Describe("file.Collector", func() {
 		})
 
 		JustBeforeEach(func() {
-			collErr = file.NewDirCollector(sourcePath, "").Run(ctx, destinationDir, stdout)
+			collErr = file.NewDirCollector(sourcePath, "").Run(ctx, osreporter.NewDirSink(destinationDir), stdout)
 		})
 
 		It("copies all source files to target", func() {
@@ -115,6 +116,7 @@ var _ = Describe("file.Collector", func() {
 				Expect(filepath.Join(destinationDir, "garden", f)).To(BeAnExistingFile())
 			}
 		})
+
 	})
 
 	Context("copying files with a glob pattern", func() {
@@ -135,7 +137,7 @@ var _ = Describe("file.Collector", func() {
 		})
 
 		JustBeforeEach(func() {
-			collErr = file.NewCollector(filepath.Join(sourcePath, "foo*"), "target/").Run(ctx, destinationDir, stdout)
+			collErr = file.NewCollector(filepath.Join(sourcePath, "foo*"), "target/").Run(ctx, osreporter.NewDirSink(destinationDir), stdout)
 		})
 
 		It("copies only foo and foobar to target", func() {
@@ -7,9 +7,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/dontpanic/collectors/grootfs"
 	"code.cloudfoundry.org/dontpanic/collectors/grootfs/grootfsfakes"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
@@ -81,7 +83,7 @@ tardis_bin: /var/vcap/packages/grootfs/bin/tardis
 	})
 
 	JustBeforeEach(func() {
-		runError = collector.Run(ctx, tmpDir, stdout)
+		runError = collector.Run(ctx, osreporter.NewDirSink(tmpDir), stdout)
 		Expect(runError).NotTo(HaveOccurred())
 	})
 
@@ -144,3 +146,48 @@ func contents(path string) string {
 	Expect(err).NotTo(HaveOccurred())
 	return string(b)
 }
+
+var _ = Describe("Grootfs cancellation", func() {
+	var (
+		collector  grootfs.UsageCollector
+		tmpDir     string
+		fakeRunner *grootfsfakes.FakeCommandRunner
+	)
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+		configFilePath := filepath.Join(tmpDir, "config.yml")
+		Expect(os.WriteFile(configFilePath, []byte("store: "+tmpDir+"/unprivileged\n"), 0644)).To(Succeed())
+
+		fakeRunner = new(grootfsfakes.FakeCommandRunner)
+		fakeRunner.RunStub = func(ctx context.Context, _ string, _ ...string) ([]byte, error) {
+			// Like a slow du on a big store, that only stops when cancelled
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		collector = grootfs.NewUsageCollector(configFilePath, fakeRunner)
+	})
+
+	It("runs the commands with the context of the collector", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := collector.Run(ctx, osreporter.NewDirSink(tmpDir), io.Discard)
+		Expect(err).To(MatchError(ContainSubstring(context.Canceled.Error())))
+
+		Expect(fakeRunner.RunCallCount()).To(Equal(1))
+		runCtx, _, _ := fakeRunner.RunArgsForCall(0)
+		Expect(runCtx.Err()).To(Equal(context.Canceled))
+	})
+
+	It("does not hold up a report past its maximum duration", func() {
+		reporter := osreporter.New(filepath.Join(tmpDir, "report"), io.Discard)
+		reporter.SetMaxDuration(200 * time.Millisecond)
+		reporter.RegisterCollector("GrootFS Usage", collector)
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "report"), 0755)).To(Succeed())
+
+		started := time.Now()
+		Expect(reporter.Run()).To(Succeed())
+		Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+	})
+})
@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v2"
+
+	"code.cloudfoundry.org/dontpanic/osreporter"
 )
 
 type UsageCollector struct {
@@ -60,29 +63,34 @@ func (c UsageCollector) parseGrootfsConfig() (grootfsConfig, error) {
 	return config, nil
 }
 
-func (c UsageCollector) Run(ctx context.Context, reportDir string, stdout io.Writer) error {
+func (c UsageCollector) Source() string {
+	return c.configPath
+}
+
+func (c UsageCollector) Run(ctx context.Context, sink osreporter.Sink, stdout io.Writer) error {
 	config, err := c.parseGrootfsConfig()
 	if err != nil {
 		return fmt.Errorf("failed to parse grootfs config file: %v", err)
 	}
 	c.config = config
 
-	grootfsDir := filepath.Join(reportDir, dirName)
-	err = os.MkdirAll(grootfsDir, 0755)
+	outputPath := path.Join(dirName, filepath.Base(c.config.Store)+"-usage.txt")
+	outputFile, err := sink.Create(outputPath)
 	if err != nil {
-		return fmt.Errorf("failed to create %q directory inside report: %v", grootfsDir, err)
+		return fmt.Errorf("failed to create output file %q: %v", outputPath, err)
 	}
 
-	storeType := filepath.Base(c.config.Store)
-	outputPath := filepath.Join(grootfsDir, storeType+"-usage.txt")
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file %q: %v", outputPath, err)
+	if err := c.writeUsage(ctx, outputFile); err != nil {
+		outputFile.Close()
+		return err
 	}
-	defer outputFile.Close()
 
+	return outputFile.Close()
+}
+
+func (c UsageCollector) writeUsage(ctx context.Context, outputFile io.Writer) error {
 	volumesPath := filepath.Join(c.config.Store, volumesDirectory)
-	totalVolumeSizeOnDisk, err := c.sizeOnDisk(volumesPath, false)
+	totalVolumeSizeOnDisk, err := c.sizeOnDisk(ctx, volumesPath, false)
 	if err != nil {
 		return fmt.Errorf("failed to calculate total volume size: %v", err)
 	}
@@ -92,12 +100,12 @@ func (c UsageCollector) Run(ctx context.Context, reportDir string, stdout io.Wri
 		return fmt.Errorf("failed to get volumes: %v", err)
 	}
 
-	usedVolumesSizeOnDisk, err := c.volumesSizeOnDisk(usedVolumes)
+	usedVolumesSizeOnDisk, err := c.volumesSizeOnDisk(ctx, usedVolumes)
 	if err != nil {
 		return fmt.Errorf("failed to get used volume size on disk: %v", err)
 	}
 
-	unusedVolumesSizeOnDisk, err := c.volumesSizeOnDisk(unusedVolumes)
+	unusedVolumesSizeOnDisk, err := c.volumesSizeOnDisk(ctx, unusedVolumes)
 	if err != nil {
 		return fmt.Errorf("failed to get unused volume size on disk: %v", err)
 	}
@@ -119,7 +127,7 @@ func (c UsageCollector) Run(ctx context.Context, reportDir string, stdout io.Wri
 	fmt.Fprintf(outputFile, "%-30s %12d bytes\n", "volumes-used-reported:", usedVolumesSize)
 	fmt.Fprintf(outputFile, "%-30s %12d bytes\n", "volumes-unused-reported:", unusedVolumesSize)
 
-	imagesSize, quotasSize, err := c.imagesStats()
+	imagesSize, quotasSize, err := c.imagesStats(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get images stats: %v", err)
 	}
@@ -127,13 +135,13 @@ func (c UsageCollector) Run(ctx context.Context, reportDir string, stdout io.Wri
 	fmt.Fprintf(outputFile, "%-30s %12d bytes\n", "images-exclusive:", imagesSize)
 	fmt.Fprintf(outputFile, "%-30s %12d bytes\n", "quotas-size:", quotasSize)
 
-	backingStoreSize, err := c.sizeOnDisk(c.config.Store+".backing-store", false)
+	backingStoreSize, err := c.sizeOnDisk(ctx, c.config.Store+".backing-store", false)
 	if err != nil {
 		return fmt.Errorf("failed to calculate backing store size: %v", err)
 	}
 	fmt.Fprintf(outputFile, "%-30s %12d bytes\n", "backing-store-actual-size:", backingStoreSize)
 
-	backingStoreMaxSize, err := c.sizeOnDisk(c.config.Store+".backing-store", true)
+	backingStoreMaxSize, err := c.sizeOnDisk(ctx, c.config.Store+".backing-store", true)
 	if err != nil {
 		return fmt.Errorf("failed to calculate backing store max size: %v", err)
 	}
@@ -142,7 +150,7 @@ func (c UsageCollector) Run(ctx context.Context, reportDir string, stdout io.Wri
 	return nil
 }
 
-func (c UsageCollector) imagesStats() (int64, int64, error) {
+func (c UsageCollector) imagesStats(ctx context.Context) (int64, int64, error) {
 	imageIDs, err := c.getImageIDs()
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to get image IDs: %v", err)
@@ -152,7 +160,7 @@ func (c UsageCollector) imagesStats() (int64, int64, error) {
 	var quotasSize int64
 
 	for _, id := range imageIDs {
-		imageStats, err := c.getImageStats(id)
+		imageStats, err := c.getImageStats(ctx, id)
 		if err != nil {
 			return 0, 0, fmt.Errorf("failed to get image size for %q: %v", id, err)
 		}
@@ -189,8 +197,8 @@ type stats struct {
 	} `json:"disk_usage"`
 }
 
-func (c UsageCollector) getImageStats(id string) (stats, error) {
-	output, err := c.runner.Run(context.Background(), c.config.GrootFSBin, "--config", c.configPath, "stats", id)
+func (c UsageCollector) getImageStats(ctx context.Context, id string) (stats, error) {
+	output, err := c.runner.Run(ctx, c.config.GrootFSBin, "--config", c.configPath, "stats", id)
 	if err != nil {
 		return stats{}, fmt.Errorf("failed to run `grootfs --config %s stat %s`: %v", c.configPath, id, err)
 	}
@@ -295,10 +303,10 @@ func (c UsageCollector) volumesSizeFromMeta(volumes []string) (int64, error) {
 	})
 }
 
-func (c UsageCollector) volumesSizeOnDisk(volumes []string) (int64, error) {
+func (c UsageCollector) volumesSizeOnDisk(ctx context.Context, volumes []string) (int64, error) {
 	return volumesSize(volumes, func(volumeID string) (int64, error) {
 		path := filepath.Join(c.config.Store, volumesDirectory, volumeID)
-		volSize, err := c.sizeOnDisk(path, false)
+		volSize, err := c.sizeOnDisk(ctx, path, false)
 		if err != nil {
 			return 0, fmt.Errorf("failed to get size of volume %q: %v", path, err)
 		}
@@ -306,14 +314,14 @@ func (c UsageCollector) volumesSizeOnDisk(volumes []string) (int64, error) {
 	})
 }
 
-func (c UsageCollector) sizeOnDisk(path string, apparentSize bool) (int64, error) {
+func (c UsageCollector) sizeOnDisk(ctx context.Context, path string, apparentSize bool) (int64, error) {
 	duArgs := []string{"-B1"}
 	if apparentSize {
 		duArgs = append(duArgs, "--apparent-size")
 	}
 	duArgs = append(duArgs, "-s", path)
 
-	output, err := c.runner.Run(context.Background(), "du", duArgs...)
+	output, err := c.runner.Run(ctx, "du", duArgs...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to run `du %s`: %v", strings.Join(duArgs, " "), err)
 	}
@@ -1,15 +1,14 @@
 package process
 
 import (
-	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
 	"context"
 
 	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 )
 
 type Collector struct {
@@ -24,8 +23,12 @@ func NewCollector(destinationPath string) Collector {
 	}
 }
 
-func (c Collector) Run(ctx context.Context, reportDir string, stdout io.Writer) error {
-	procs, err := c.runner.Run(ctx, "sh", "-c", "ps -eLo tid | tail -n +2")
+func (c Collector) Source() string {
+	return "/proc"
+}
+
+func (c Collector) Run(ctx context.Context, sink osreporter.Sink, stdout io.Writer) error {
+	procs, err := c.runner.RunPipeline(ctx, commandrunner.Pipeline{{"ps", "-eLo", "tid"}, {"tail", "-n", "+2"}})
 	if err != nil {
 		return err
 	}
@@ -33,28 +36,25 @@ func (c Collector) Run(ctx context.Context, reportDir string, stdout io.Writer)
 	for _, procLine := range strings.Split(string(procs), "\n") {
 		proc := strings.Trim(string(procLine), " ")
 
-		procDir := filepath.Join(reportDir, c.destinationPath, proc)
-		if err := os.MkdirAll(procDir, 0755); err != nil {
-			return err
-		}
+		procDir := path.Join(c.destinationPath, proc)
 
-		if err := c.collectProcData(ctx, fmt.Sprintf("ls -lah /proc/%s/fd", proc), filepath.Join(procDir, "fd")); err != nil {
+		if err := c.collectProcData(ctx, sink, commandrunner.Command("ls", "-lah", path.Join("/proc", proc, "fd")), path.Join(procDir, "fd")); err != nil {
 			continue
 		}
 
-		if err := c.collectProcData(ctx, fmt.Sprintf("ls -lah /proc/%s/ns", proc), filepath.Join(procDir, "ns")); err != nil {
+		if err := c.collectProcData(ctx, sink, commandrunner.Command("ls", "-lah", path.Join("/proc", proc, "ns")), path.Join(procDir, "ns")); err != nil {
 			continue
 		}
 
-		if err := c.collectProcData(ctx, fmt.Sprintf("cat /proc/%s/cgroup", proc), filepath.Join(procDir, "cgroup")); err != nil {
+		if err := c.collectProcData(ctx, sink, commandrunner.Command("cat", path.Join("/proc", proc, "cgroup")), path.Join(procDir, "cgroup")); err != nil {
 			continue
 		}
 
-		if err := c.collectProcData(ctx, fmt.Sprintf("cat /proc/%s/status", proc), filepath.Join(procDir, "status")); err != nil {
+		if err := c.collectProcData(ctx, sink, commandrunner.Command("cat", path.Join("/proc", proc, "status")), path.Join(procDir, "status")); err != nil {
 			continue
 		}
 
-		if err := c.collectProcData(ctx, fmt.Sprintf("cat /proc/%s/stack", proc), filepath.Join(procDir, "stack")); err != nil {
+		if err := c.collectProcData(ctx, sink, commandrunner.Command("cat", path.Join("/proc", proc, "stack")), path.Join(procDir, "stack")); err != nil {
 			continue
 		}
 	}
@@ -62,15 +62,21 @@ func (c Collector) Run(ctx context.Context, reportDir string, stdout io.Writer)
 	return nil
 }
 
-func (c *Collector) collectProcData(ctx context.Context, command, destFile string) error {
-	out, err := c.runner.Run(ctx, "sh", "-c", command)
+func (c *Collector) collectProcData(ctx context.Context, sink osreporter.Sink, command commandrunner.Pipeline, destFile string) error {
+	out, err := c.runner.RunPipeline(ctx, command)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(destFile, out, 0644)
+
+	writer, err := sink.Create(destFile)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if _, err := writer.Write(out); err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
 }
@@ -10,6 +10,7 @@ import (
 	"context"
 
 	"code.cloudfoundry.org/dontpanic/collectors/process"
+	"code.cloudfoundry.org/dontpanic/osreporter"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
@@ -35,7 +36,7 @@ var _ = Describe("Process", func() {
 	})
 
 	JustBeforeEach(func() {
-		runErr = processCollector.Run(ctx, destDir, stdout)
+		runErr = processCollector.Run(ctx, osreporter.NewDirSink(destDir), stdout)
 	})
 
 	It("collects info for every running process", func() {
@@ -0,0 +1,13 @@
+package collectorspec_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCollectorspec(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Collectorspec Suite")
+}
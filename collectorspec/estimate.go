@@ -0,0 +1,129 @@
+package collectorspec
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/archiver"
+)
+
+const (
+	commandOutputEstimate = 1 << 20
+	// truncationMarkerEstimate accounts for the marker appended to
+	// truncated command output.
+	truncationMarkerEstimate = 128
+	processFileEstimate      = 4 << 10
+	processFilesPerThread    = 5
+	grootfsUsageEstimate     = 64 << 10
+	// reportOverhead accounts for dontpanic.log and manifest.json.
+	reportOverhead = 1 << 20
+	// tarEntryOverhead accounts for the headers and padding of each archive
+	// entry.
+	tarEntryOverhead = 3 * 512
+)
+
+// Estimate is the disk space a report is expected to need.
+type Estimate struct {
+	Bytes uint64
+	Files uint64
+	// Largest is the size of the largest single artifact.
+	Largest uint64
+}
+
+func (e Estimate) add(other Estimate) Estimate {
+	return Estimate{Bytes: e.Bytes + other.Bytes, Files: e.Files + other.Files, Largest: max(e.Largest, other.Largest)}
+}
+
+// Layout is how a report is written, which decides how much space it needs
+// besides the collector output.
+type Layout struct {
+	// Streaming compresses the output into the archive as it is produced,
+	// spooling only large artifacts, instead of staging it in a directory.
+	Streaming bool
+	// ArchiveElsewhere is set when the archive is not written to the output
+	// directory, e.g. when it goes to stdout.
+	ArchiveElsewhere bool
+	// Parallelism is how many collectors run at the same time.
+	Parallelism int
+}
+
+// EstimateReport returns the space needed by a report produced by the
+// given collectors, including its archive and, when streaming, the spool.
+// Files and directories are measured, command output is guessed and the
+// output is assumed not to compress, so the estimate errs on the large side.
+func EstimateReport(specs []Spec, layout Layout) Estimate {
+	output := Estimate{Bytes: reportOverhead, Files: 2, Largest: reportOverhead}
+	for _, spec := range specs {
+		output = output.add(spec.Estimate())
+	}
+
+	var estimate Estimate
+	if !layout.ArchiveElsewhere {
+		estimate = Estimate{Bytes: output.Bytes + output.Files*tarEntryOverhead, Files: 1}
+	}
+
+	if !layout.Streaming {
+		// The staged report is only removed once the archive is complete
+		return estimate.add(Estimate{Bytes: output.Bytes, Files: output.Files})
+	}
+
+	// Each running collector may be spooling its largest artifact
+	if output.Largest > archiver.MaxBufferedEntry {
+		parallelism := uint64(max(layout.Parallelism, 1))
+		estimate = estimate.add(Estimate{Bytes: min(output.Largest*parallelism, output.Bytes), Files: parallelism})
+	}
+	return estimate
+}
+
+// Estimate returns the space the collector's output is expected to need.
+func (s Spec) Estimate() Estimate {
+	switch s.Type {
+	case TypeCommand:
+		if s.Output == "" {
+			return Estimate{}
+		}
+		if s.MaxBytes > 0 && s.MaxBytes < commandOutputEstimate {
+			bytes := uint64(s.MaxBytes) + truncationMarkerEstimate
+			return Estimate{Bytes: bytes, Files: 1, Largest: bytes}
+		}
+		return Estimate{Bytes: commandOutputEstimate, Files: 1, Largest: commandOutputEstimate}
+	case TypeFile, TypeDir:
+		return measure(s.Path)
+	case TypeProcess:
+		threads := countThreads()
+		return Estimate{
+			Bytes:   threads * processFilesPerThread * processFileEstimate,
+			Files:   threads * (processFilesPerThread + 1),
+			Largest: processFileEstimate,
+		}
+	case TypeGrootFS:
+		return Estimate{Bytes: grootfsUsageEstimate, Files: 2, Largest: grootfsUsageEstimate}
+	}
+	return Estimate{}
+}
+
+func measure(pattern string) Estimate {
+	matches, _ := filepath.Glob(pattern)
+
+	var estimate Estimate
+	for _, match := range matches {
+		filepath.WalkDir(match, func(_ string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			estimate.Files++
+			if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+				estimate.Bytes += uint64(info.Size())
+				estimate.Largest = max(estimate.Largest, uint64(info.Size()))
+			}
+			return nil
+		})
+	}
+	return estimate
+}
+
+func countThreads() uint64 {
+	tasks, _ := filepath.Glob("/proc/[0-9]*/task/[0-9]*")
+	return uint64(len(tasks))
+}
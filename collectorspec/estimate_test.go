@@ -0,0 +1,100 @@
+package collectorspec_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Estimates", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("measures the files a file collector copies", func() {
+		Expect(os.WriteFile(filepath.Join(tmpDir, "a.log"), make([]byte, 100), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, "b.log"), make([]byte, 50), 0644)).To(Succeed())
+
+		spec := collectorspec.Spec{Type: collectorspec.TypeFile, Path: filepath.Join(tmpDir, "*.log")}
+		Expect(spec.Estimate()).To(Equal(collectorspec.Estimate{Bytes: 150, Files: 2, Largest: 100}))
+	})
+
+	It("measures the tree a dir collector copies", func() {
+		Expect(os.MkdirAll(filepath.Join(tmpDir, "sub"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(tmpDir, "sub", "a"), make([]byte, 10), 0644)).To(Succeed())
+
+		spec := collectorspec.Spec{Type: collectorspec.TypeDir, Path: tmpDir}
+		Expect(spec.Estimate()).To(Equal(collectorspec.Estimate{Bytes: 10, Files: 3, Largest: 10}))
+	})
+
+	It("estimates nothing for missing paths", func() {
+		spec := collectorspec.Spec{Type: collectorspec.TypeFile, Path: filepath.Join(tmpDir, "missing")}
+		Expect(spec.Estimate()).To(BeZero())
+	})
+
+	It("estimates nothing for commands whose output is discarded", func() {
+		spec := collectorspec.Spec{Type: collectorspec.TypeCommand, Argv: []string{"true"}}
+		Expect(spec.Estimate()).To(BeZero())
+	})
+
+	It("estimates no more than the limit of commands whose output is limited", func() {
+		spec := collectorspec.Spec{Type: collectorspec.TypeCommand, Argv: []string{"date"}, Output: "date.log", MaxBytes: 1000}
+		Expect(spec.Estimate().Bytes).To(BeNumerically("<", 2000))
+	})
+
+	Describe("the report", func() {
+		var command collectorspec.Spec
+
+		BeforeEach(func() {
+			command = collectorspec.Spec{Type: collectorspec.TypeCommand, Argv: []string{"date"}, Output: "date.log"}
+		})
+
+		It("adds up the collectors, the report's own files and the archive", func() {
+			layout := collectorspec.Layout{ArchiveElsewhere: true}
+			single := collectorspec.EstimateReport([]collectorspec.Spec{command}, layout)
+			double := collectorspec.EstimateReport([]collectorspec.Spec{command, command}, layout)
+
+			Expect(single.Files).To(BeEquivalentTo(3))
+			Expect(double.Bytes - single.Bytes).To(Equal(command.Estimate().Bytes))
+		})
+
+		It("includes the archive written next to the staged report", func() {
+			staged := collectorspec.EstimateReport([]collectorspec.Spec{command}, collectorspec.Layout{ArchiveElsewhere: true})
+			archived := collectorspec.EstimateReport([]collectorspec.Spec{command}, collectorspec.Layout{})
+
+			Expect(archived.Files).To(Equal(staged.Files + 1))
+			Expect(archived.Bytes).To(BeNumerically(">", 2*staged.Bytes))
+		})
+
+		It("does not include a staged report when streaming", func() {
+			staged := collectorspec.EstimateReport([]collectorspec.Spec{command}, collectorspec.Layout{})
+			streamed := collectorspec.EstimateReport([]collectorspec.Spec{command}, collectorspec.Layout{Streaming: true})
+
+			Expect(streamed.Files).To(BeEquivalentTo(1))
+			Expect(streamed.Bytes).To(BeNumerically("<", staged.Bytes))
+		})
+
+		It("includes the spool of large artifacts when streaming", func() {
+			Expect(os.WriteFile(filepath.Join(tmpDir, "large.log"), make([]byte, 3<<20), 0644)).To(Succeed())
+			large := collectorspec.Spec{Type: collectorspec.TypeFile, Path: filepath.Join(tmpDir, "large.log")}
+
+			archive := collectorspec.EstimateReport([]collectorspec.Spec{large}, collectorspec.Layout{Streaming: true})
+			spool := collectorspec.EstimateReport([]collectorspec.Spec{large}, collectorspec.Layout{Streaming: true, ArchiveElsewhere: true, Parallelism: 4})
+
+			Expect(spool.Bytes).To(BeNumerically(">=", 3<<20))
+			Expect(spool.Files).To(BeEquivalentTo(4))
+			Expect(archive.Bytes).To(BeNumerically(">=", 3<<20))
+		})
+	})
+})
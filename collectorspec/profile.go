@@ -0,0 +1,75 @@
+package collectorspec
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Profile is a named bundle of collectors, selected by category.
+type Profile struct {
+	Name        string
+	Description string
+	// Include lists the categories a collector needs at least one of to be
+	// part of the profile. An empty list includes every collector.
+	Include []string
+	// Exclude lists categories that leave a collector out of the profile.
+	Exclude []string
+}
+
+var Profiles = []Profile{
+	{
+		Name:        "quick",
+		Description: "Everything that completes within a few seconds (no lsof, inode map or sampling)",
+		Exclude:     []string{"slow"},
+	},
+	{
+		Name:        "standard",
+		Description: "Everything except the exhaustive inode map and per-thread process data",
+		Exclude:     []string{"exhaustive"},
+	},
+	{
+		Name:        "full",
+		Description: "Every collector",
+	},
+	{
+		Name:        "network",
+		Description: "Basic host details plus network interfaces and IP tables",
+		Include:     []string{"basic", "network"},
+	},
+	{
+		Name:        "disk",
+		Description: "Basic host details plus disk usage, GrootFS usage, XFS and IO statistics",
+		Include:     []string{"basic", "disk"},
+	},
+	{
+		Name:        "containers",
+		Description: "Basic host details plus Garden and containerd container state",
+		Include:     []string{"basic", "containers"},
+	},
+}
+
+func FindProfile(name string) (Profile, error) {
+	for _, profile := range Profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q", name)
+}
+
+// Contains returns whether the collector belongs to the profile.
+func (p Profile) Contains(spec Spec) bool {
+	if len(p.Include) > 0 && !hasAnyCategory(spec, p.Include) {
+		return false
+	}
+	return !hasAnyCategory(spec, p.Exclude)
+}
+
+func hasAnyCategory(spec Spec, categories []string) bool {
+	for _, category := range categories {
+		if slices.Contains(spec.Categories, category) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package collectorspec_test
+
+import (
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profiles", func() {
+	var defaults []collectorspec.Spec
+
+	BeforeEach(func() {
+		config, err := collectorspec.Default()
+		Expect(err).NotTo(HaveOccurred())
+		defaults = config.Enabled(map[string]bool{"sigquit": true})
+	})
+
+	profileNames := func(name string) []string {
+		profile, err := collectorspec.FindProfile(name)
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, spec := range defaults {
+			if profile.Contains(spec) {
+				names = append(names, spec.Name)
+			}
+		}
+		return names
+	}
+
+	It("includes every collector in the full profile", func() {
+		Expect(profileNames("full")).To(HaveLen(len(defaults)))
+	})
+
+	It("leaves the slow collectors out of the quick profile", func() {
+		Expect(profileNames("quick")).To(ContainElements("Date", "Disk Usage", "IP Tables"))
+		Expect(profileNames("quick")).NotTo(ContainElements("List of Open Files", "Map of Inodes to Paths", "IOSTAT -xdm (slow)"))
+	})
+
+	It("leaves the exhaustive collectors out of the standard profile", func() {
+		Expect(profileNames("standard")).To(ContainElement("List of Open Files"))
+		Expect(profileNames("standard")).NotTo(ContainElements("Map of Inodes to Paths", "Mass Process Data"))
+	})
+
+	It("selects the network collectors in the network profile", func() {
+		Expect(profileNames("network")).To(ContainElements("Hostname", "Network Interfaces", "IP Tables", "NAT IP Tables"))
+		Expect(profileNames("network")).NotTo(ContainElement("Disk Usage"))
+	})
+
+	It("selects the disk collectors in the disk profile", func() {
+		Expect(profileNames("disk")).To(ContainElements("Disk Usage", "GrootFS Unprivileged Usage", "XFS Info", "IOSTAT -xdm (slow)"))
+		Expect(profileNames("disk")).NotTo(ContainElement("IP Tables"))
+	})
+
+	It("always keeps the goroutine dump", func() {
+		for _, profile := range collectorspec.Profiles {
+			Expect(profileNames(profile.Name)).To(ContainElement("Dump gdn goroutines"), profile.Name)
+		}
+	})
+
+	It("fails to find unknown profiles", func() {
+		_, err := collectorspec.FindProfile("everything")
+		Expect(err).To(MatchError(`unknown profile "everything"`))
+	})
+})
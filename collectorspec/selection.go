@@ -0,0 +1,57 @@
+package collectorspec
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Selection filters collectors by profile and by name. Name patterns are
+// matched case insensitively and may contain glob wildcards.
+type Selection struct {
+	// Profile selects the initial set of collectors. A zero profile
+	// selects every collector.
+	Profile Profile
+	// Include adds collectors that the profile leaves out.
+	Include []string
+	Only    []string
+	Skip    []string
+}
+
+func (s Selection) Validate() error {
+	for _, pattern := range slices.Concat(s.Include, s.Only, s.Skip) {
+		if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+			return fmt.Errorf("invalid collector pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// SkipReason returns why the selection leaves out the given collector, or
+// an empty string if the collector is selected.
+func (s Selection) SkipReason(spec Spec) string {
+	if !s.Profile.Contains(spec) && !matchesAny(spec.Name, s.Include) {
+		return fmt.Sprintf("not part of the %s profile", s.Profile.Name)
+	}
+
+	if len(s.Only) > 0 && !matchesAny(spec.Name, s.Only) {
+		return "not selected by --only"
+	}
+
+	if matchesAny(spec.Name, s.Skip) {
+		return "excluded by --skip"
+	}
+
+	return ""
+}
+
+func matchesAny(name string, patterns []string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ToLower(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
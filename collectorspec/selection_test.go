@@ -0,0 +1,90 @@
+package collectorspec_test
+
+import (
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Selection", func() {
+	var (
+		selection collectorspec.Selection
+		inodes    = collectorspec.Spec{Name: "Map of Inodes to Paths"}
+		iptables  = collectorspec.Spec{Name: "IP Tables"}
+		natTables = collectorspec.Spec{Name: "NAT IP Tables"}
+	)
+
+	BeforeEach(func() {
+		selection = collectorspec.Selection{}
+	})
+
+	It("selects everything by default", func() {
+		Expect(selection.SkipReason(inodes)).To(BeEmpty())
+		Expect(selection.SkipReason(iptables)).To(BeEmpty())
+	})
+
+	When("only is set", func() {
+		BeforeEach(func() {
+			selection.Only = []string{"*ip tables"}
+		})
+
+		It("skips collectors not matching any pattern", func() {
+			Expect(selection.SkipReason(inodes)).To(Equal("not selected by --only"))
+			Expect(selection.SkipReason(iptables)).To(BeEmpty())
+			Expect(selection.SkipReason(natTables)).To(BeEmpty())
+		})
+	})
+
+	When("skip is set", func() {
+		BeforeEach(func() {
+			selection.Skip = []string{"Map of Inodes to Paths", "NAT*"}
+		})
+
+		It("skips collectors matching any pattern", func() {
+			Expect(selection.SkipReason(inodes)).To(Equal("excluded by --skip"))
+			Expect(selection.SkipReason(natTables)).To(Equal("excluded by --skip"))
+			Expect(selection.SkipReason(iptables)).To(BeEmpty())
+		})
+	})
+
+	When("both are set", func() {
+		BeforeEach(func() {
+			selection.Only = []string{"*IP Tables"}
+			selection.Skip = []string{"NAT*"}
+		})
+
+		It("applies the skip patterns to the selected collectors", func() {
+			Expect(selection.SkipReason(iptables)).To(BeEmpty())
+			Expect(selection.SkipReason(natTables)).To(Equal("excluded by --skip"))
+		})
+	})
+
+	When("a profile is set", func() {
+		BeforeEach(func() {
+			selection.Profile = collectorspec.Profile{Name: "network", Include: []string{"network"}}
+			iptables.Categories = []string{"network"}
+		})
+
+		It("skips collectors outside the profile", func() {
+			Expect(selection.SkipReason(iptables)).To(BeEmpty())
+			Expect(selection.SkipReason(inodes)).To(Equal("not part of the network profile"))
+		})
+
+		It("lets include add collectors back", func() {
+			selection.Include = []string{"Map of Inodes*"}
+			Expect(selection.SkipReason(inodes)).To(BeEmpty())
+		})
+
+		It("still applies the skip patterns", func() {
+			selection.Skip = []string{"IP Tables"}
+			Expect(selection.SkipReason(iptables)).To(Equal("excluded by --skip"))
+		})
+	})
+
+	Describe("Validate", func() {
+		It("rejects malformed patterns", func() {
+			selection.Skip = []string{"["}
+			Expect(selection.Validate()).To(MatchError(ContainSubstring(`invalid collector pattern "["`)))
+		})
+	})
+})
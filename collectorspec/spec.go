@@ -0,0 +1,243 @@
+package collectorspec
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/collectors/command"
+	"code.cloudfoundry.org/dontpanic/collectors/file"
+	"code.cloudfoundry.org/dontpanic/collectors/grootfs"
+	"code.cloudfoundry.org/dontpanic/collectors/process"
+	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/osreporter"
+	"code.cloudfoundry.org/dontpanic/overlay"
+)
+
+//go:embed default.yml
+var defaultConfig []byte
+
+const (
+	TypeCommand = "command"
+	TypeFile    = "file"
+	TypeDir     = "dir"
+	TypeProcess = "process"
+	TypeGrootFS = "grootfs"
+)
+
+type Config struct {
+	Collectors []Spec `yaml:"collectors"`
+}
+
+type Spec struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Type        string   `yaml:"type"`
+	Categories  []string `yaml:"categories"`
+	// Argv is the command to run, without a shell.
+	Argv []string `yaml:"argv"`
+	// Pipeline is a list of commands to run without a shell, the output of
+	// each piped into the next.
+	Pipeline [][]string `yaml:"pipeline"`
+	// Command is a script run with sh -c, only when Shell is set.
+	Command string        `yaml:"command"`
+	Shell   bool          `yaml:"shell"`
+	Path    string        `yaml:"path"`
+	Output  string        `yaml:"output"`
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxBytes truncates the output of command collectors after this many
+	// bytes. Zero means no limit.
+	MaxBytes   int64      `yaml:"max_bytes"`
+	Noisy      bool       `yaml:"noisy"`
+	Exclusive  bool       `yaml:"exclusive"`
+	Disabled   bool       `yaml:"disabled"`
+	Conditions Conditions `yaml:"conditions"`
+}
+
+// Conditions restrict when a collector is registered. All of the conditions
+// that are set must hold.
+type Conditions struct {
+	PathExists string `yaml:"path_exists"`
+	Flag       string `yaml:"flag"`
+}
+
+// Default returns the collectors shipped with dontpanic.
+func Default() (Config, error) {
+	return Parse(defaultConfig)
+}
+
+// Load returns the default collectors, extended or overridden by the
+// collectors defined in each of the given files.
+func Load(paths ...string) (Config, error) {
+	return overlay.Load("collectors config", defaultConfig, paths, Parse, Config.Merge)
+}
+
+func Parse(contents []byte) (Config, error) {
+	return overlay.Parse(contents, func(c Config) []Spec { return c.Collectors }, Spec.Validate)
+}
+
+// Merge returns a config where collectors in override replace the
+// collectors with the same name, and any other collectors are appended.
+func (c Config) Merge(override Config) Config {
+	return Config{Collectors: overlay.Merge(c.Collectors, override.Collectors, func(s Spec) string { return s.Name })}
+}
+
+// Enabled returns the collectors that are not disabled and whose conditions
+// hold given the set of command line flags.
+func (c Config) Enabled(flags map[string]bool) []Spec {
+	specs := []Spec{}
+	for _, spec := range c.Collectors {
+		if spec.Disabled || !spec.Conditions.hold(flags) {
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+func (c Conditions) hold(flags map[string]bool) bool {
+	if c.Flag != "" && !flags[c.Flag] {
+		return false
+	}
+
+	if c.PathExists != "" {
+		if _, err := os.Stat(c.PathExists); os.IsNotExist(err) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s Spec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("collector has no name")
+	}
+
+	if s.Disabled {
+		return nil
+	}
+
+	if s.Noisy && s.Exclusive {
+		return fmt.Errorf("collector %q cannot be both noisy and exclusive", s.Name)
+	}
+
+	if s.MaxBytes < 0 {
+		return fmt.Errorf("collector %q has a negative max_bytes", s.Name)
+	}
+	if s.MaxBytes > 0 && s.Type != TypeCommand {
+		return fmt.Errorf("collector %q sets max_bytes, which only applies to command collectors", s.Name)
+	}
+
+	if s.Type != TypeCommand && (s.Command != "" || s.Argv != nil || s.Pipeline != nil || s.Shell) {
+		return fmt.Errorf("collector %q sets a command, which only applies to command collectors", s.Name)
+	}
+
+	switch s.Type {
+	case TypeCommand:
+		if err := s.validateCommand(); err != nil {
+			return err
+		}
+	case TypeFile, TypeDir, TypeGrootFS:
+		if s.Path == "" {
+			return fmt.Errorf("%s collector %q has no path", s.Type, s.Name)
+		}
+	case TypeProcess:
+		if s.Output == "" {
+			return fmt.Errorf("process collector %q has no output", s.Name)
+		}
+	default:
+		return fmt.Errorf("collector %q has unknown type %q", s.Name, s.Type)
+	}
+
+	return nil
+}
+
+func (s Spec) validateCommand() error {
+	set := 0
+	for _, isSet := range []bool{s.Command != "", s.Argv != nil, s.Pipeline != nil} {
+		if isSet {
+			set++
+		}
+	}
+
+	switch {
+	case set == 0:
+		return fmt.Errorf("command collector %q has no command", s.Name)
+	case set > 1:
+		return fmt.Errorf("command collector %q must set only one of command, argv and pipeline", s.Name)
+	case s.Command != "" && !s.Shell:
+		return fmt.Errorf("command collector %q runs its command with a shell: use argv or pipeline, or set shell: true", s.Name)
+	case s.Command == "" && s.Shell:
+		return fmt.Errorf("command collector %q sets shell, which only applies to command", s.Name)
+	}
+
+	if err := s.CommandPipeline().Validate(); err != nil {
+		return fmt.Errorf("command collector %q: %v", s.Name, err)
+	}
+	return nil
+}
+
+// CommandPipeline returns the pipeline a command collector runs.
+func (s Spec) CommandPipeline() commandrunner.Pipeline {
+	switch {
+	case s.Command != "":
+		return commandrunner.Shell(s.Command)
+	case s.Argv != nil:
+		return commandrunner.Pipeline{s.Argv}
+	}
+	return s.Pipeline
+}
+
+// EffectiveTimeout returns the timeout the collector runs with.
+func (s Spec) EffectiveTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return osreporter.DefaultTimeout
+}
+
+func (s Spec) Collector() (osreporter.Collector, error) {
+	switch s.Type {
+	case TypeCommand:
+		if s.Output == "" {
+			return command.NewDiscardCollector(s.CommandPipeline()), nil
+		}
+		return command.NewCollector(s.CommandPipeline(), s.Output).WithMaxBytes(s.MaxBytes), nil
+	case TypeFile:
+		return file.NewCollector(s.Path, s.Output), nil
+	case TypeDir:
+		return file.NewDirCollector(s.Path, s.Output), nil
+	case TypeProcess:
+		return process.NewCollector(s.Output), nil
+	case TypeGrootFS:
+		return grootfs.NewUsageCollector(s.Path, commandrunner.CommandRunner{}), nil
+	}
+
+	return nil, fmt.Errorf("collector %q has unknown type %q", s.Name, s.Type)
+}
+
+// Register adds the collector described by the spec to the reporter.
+func (s Spec) Register(reporter *osreporter.Reporter) error {
+	collector, err := s.Collector()
+	if err != nil {
+		return err
+	}
+
+	var timeout []time.Duration
+	if s.Timeout > 0 {
+		timeout = append(timeout, s.Timeout)
+	}
+
+	switch {
+	case s.Noisy:
+		reporter.RegisterNoisyCollector(s.Name, collector, timeout...)
+	case s.Exclusive:
+		reporter.RegisterExclusiveCollector(s.Name, collector, timeout...)
+	default:
+		reporter.RegisterCollector(s.Name, collector, timeout...)
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package collectorspec_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/collectors/command"
+	"code.cloudfoundry.org/dontpanic/collectors/file"
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	"code.cloudfoundry.org/dontpanic/commandrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collector specs", func() {
+	Describe("the default config", func() {
+		var config collectorspec.Config
+
+		BeforeEach(func() {
+			var err error
+			config, err = collectorspec.Default()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("contains the built-in collectors", func() {
+			date := findSpec(config.Collectors, "Date")
+			Expect(date.Type).To(Equal(collectorspec.TypeCommand))
+			Expect(date.Argv).To(Equal([]string{"date"}))
+			Expect(date.Output).To(Equal("date.log"))
+			Expect(date.Noisy).To(BeTrue())
+		})
+
+		It("preserves shell commands verbatim", func() {
+			inodes := findSpec(config.Collectors, "Map of Inodes to Paths")
+			Expect(inodes.Command).To(Equal(`find / -fprintf inodes '%i %p\n'; lsof -Fi | grep '^i' | cut -c2- | sort | uniq | xargs -i grep -w ^{} inodes; rm inodes`))
+			Expect(inodes.Shell).To(BeTrue())
+			Expect(inodes.Timeout).To(Equal(60 * time.Second))
+		})
+
+		It("runs pipelines without a shell", func() {
+			depot := findSpec(config.Collectors, "Garden Depot Contents")
+			Expect(depot.CommandPipeline()).To(Equal(commandrunner.Pipeline{{"find", "/var/vcap/data/garden/depot"}, {"sed", "s|[^/]*/|- |g"}}))
+		})
+
+		It("only enables the goroutine dump when the sigquit flag is set", func() {
+			Expect(specNames(config.Enabled(nil))).NotTo(ContainElement("Dump gdn goroutines"))
+			Expect(specNames(config.Enabled(map[string]bool{"sigquit": true}))).To(ContainElement("Dump gdn goroutines"))
+		})
+	})
+
+	Describe("Parse", func() {
+		It("rejects unknown types", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: bar}]"))
+			Expect(err).To(MatchError(ContainSubstring(`unknown type "bar"`)))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command, argv: [date], colour: red}]"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects command collectors without a command", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command}]"))
+			Expect(err).To(MatchError(ContainSubstring("has no command")))
+		})
+
+		It("rejects shell commands unless shell is set", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command, command: date}]"))
+			Expect(err).To(MatchError(ContainSubstring("use argv or pipeline, or set shell: true")))
+
+			_, err = collectorspec.Parse([]byte("collectors: [{name: foo, type: command, command: date, shell: true}]"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects shell without a shell command", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command, argv: [date], shell: true}]"))
+			Expect(err).To(MatchError(ContainSubstring("only applies to command")))
+		})
+
+		It("rejects command collectors setting more than one command", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command, argv: [date], pipeline: [[date]]}]"))
+			Expect(err).To(MatchError(ContainSubstring("only one of command, argv and pipeline")))
+		})
+
+		It("rejects pipelines with an empty stage", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command, pipeline: [[date], []]}]"))
+			Expect(err).To(MatchError(ContainSubstring("empty stage")))
+		})
+
+		It("rejects commands on collectors other than commands", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: file, path: /foo, argv: [date]}]"))
+			Expect(err).To(MatchError(ContainSubstring("only applies to command collectors")))
+		})
+
+		It("rejects max_bytes on collectors other than commands", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: file, path: /foo, max_bytes: 10}]"))
+			Expect(err).To(MatchError(ContainSubstring("only applies to command collectors")))
+		})
+
+		It("rejects a negative max_bytes", func() {
+			_, err := collectorspec.Parse([]byte("collectors: [{name: foo, type: command, argv: [date], max_bytes: -1}]"))
+			Expect(err).To(MatchError(ContainSubstring("negative max_bytes")))
+		})
+	})
+
+	Describe("Merge", func() {
+		var base collectorspec.Config
+
+		BeforeEach(func() {
+			base = collectorspec.Config{Collectors: []collectorspec.Spec{
+				{Name: "one", Type: collectorspec.TypeCommand, Command: "echo one"},
+				{Name: "two", Type: collectorspec.TypeCommand, Command: "echo two"},
+			}}
+		})
+
+		It("replaces collectors with the same name in place", func() {
+			merged := base.Merge(collectorspec.Config{Collectors: []collectorspec.Spec{
+				{Name: "one", Type: collectorspec.TypeCommand, Command: "echo uno"},
+			}})
+			Expect(specNames(merged.Collectors)).To(Equal([]string{"one", "two"}))
+			Expect(merged.Collectors[0].Command).To(Equal("echo uno"))
+		})
+
+		It("appends new collectors", func() {
+			merged := base.Merge(collectorspec.Config{Collectors: []collectorspec.Spec{
+				{Name: "three", Type: collectorspec.TypeCommand, Command: "echo three"},
+			}})
+			Expect(specNames(merged.Collectors)).To(Equal([]string{"one", "two", "three"}))
+		})
+
+		It("allows disabling collectors", func() {
+			merged := base.Merge(collectorspec.Config{Collectors: []collectorspec.Spec{
+				{Name: "two", Disabled: true},
+			}})
+			Expect(specNames(merged.Enabled(nil))).To(Equal([]string{"one"}))
+		})
+
+		It("does not modify the original config", func() {
+			base.Merge(collectorspec.Config{Collectors: []collectorspec.Spec{{Name: "one", Disabled: true}}})
+			Expect(base.Collectors[0].Disabled).To(BeFalse())
+		})
+	})
+
+	Describe("Load", func() {
+		var configPath string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+
+			configPath = filepath.Join(dir, "collectors.yml")
+			Expect(os.WriteFile(configPath, []byte(`
+collectors:
+  - name: Date
+    disabled: true
+  - name: Site Specific
+    type: file
+    path: /etc/site.conf
+    output: site/
+`), 0644)).To(Succeed())
+		})
+
+		It("extends and overrides the default collectors", func() {
+			config, err := collectorspec.Load(configPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			names := specNames(config.Enabled(nil))
+			Expect(names).NotTo(ContainElement("Date"))
+			Expect(names).To(ContainElement("Uptime"))
+			Expect(names[len(names)-1]).To(Equal("Site Specific"))
+		})
+
+		It("fails when the file does not exist", func() {
+			_, err := collectorspec.Load("/does/not/exist")
+			Expect(err).To(MatchError(ContainSubstring("failed to read collectors config")))
+		})
+	})
+
+	Describe("Conditions", func() {
+		It("requires the path to exist", func() {
+			config := collectorspec.Config{Collectors: []collectorspec.Spec{
+				{Name: "exists", Conditions: collectorspec.Conditions{PathExists: os.TempDir()}},
+				{Name: "missing", Conditions: collectorspec.Conditions{PathExists: "/does/not/exist"}},
+			}}
+			Expect(specNames(config.Enabled(nil))).To(Equal([]string{"exists"}))
+		})
+	})
+
+	Describe("Collector", func() {
+		It("builds a command collector", func() {
+			collector, err := collectorspec.Spec{Name: "date", Type: collectorspec.TypeCommand, Argv: []string{"date", "-u"}, Output: "date.log"}.Collector()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collector).To(BeAssignableToTypeOf(command.Collector{}))
+			Expect(collector.(command.Collector).Source()).To(Equal("date -u"))
+			Expect(collector.(command.Collector).Argv()).To(Equal([][]string{{"date", "-u"}}))
+		})
+
+		It("builds a command collector running a shell", func() {
+			collector, err := collectorspec.Spec{Name: "date", Type: collectorspec.TypeCommand, Command: "date; uptime", Shell: true, Output: "date.log"}.Collector()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collector.(command.Collector).Source()).To(Equal("date; uptime"))
+			Expect(collector.(command.Collector).Argv()).To(Equal([][]string{{"sh", "-c", "date; uptime"}}))
+		})
+
+		It("builds a directory collector", func() {
+			collector, err := collectorspec.Spec{Name: "logs", Type: collectorspec.TypeDir, Path: "/var/log/garden"}.Collector()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(collector).To(Equal(file.NewDirCollector("/var/log/garden", "")))
+		})
+	})
+})
+
+func findSpec(specs []collectorspec.Spec, name string) collectorspec.Spec {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	Fail("no collector named " + name)
+	return collectorspec.Spec{}
+}
+
+func specNames(specs []collectorspec.Spec) []string {
+	names := []string{}
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	return names
+}
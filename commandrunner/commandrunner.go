@@ -1,24 +1,261 @@
 package commandrunner
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
+// gracePeriod is how long the processes of a cancelled command have to exit
+// after SIGTERM before they are sent SIGKILL.
+const gracePeriod = 2 * time.Second
+
+// killTimeout is how long to wait for the processes of a cancelled command to
+// die after SIGKILL before reporting them as stray.
+const killTimeout = time.Second
+
+// StrayProcessesError is returned for cancelled commands whose processes
+// were still running after SIGKILL.
+type StrayProcessesError struct {
+	Err       error
+	Processes []string
+}
+
+func (e StrayProcessesError) Error() string {
+	return fmt.Sprintf("processes still running after SIGKILL: %s", strings.Join(e.Processes, ", "))
+}
+
+func (e StrayProcessesError) Unwrap() error {
+	return e.Err
+}
+
+// start starts the commands run. See SetStart.
+var start = (*exec.Cmd).Start
+
+// SetStart has the commands run from then on started by the function, such
+// as one starting them in a cgroup. It must be called before any command is
+// run.
+func SetStart(f func(*exec.Cmd) error) {
+	start = f
+}
+
 type CommandRunner struct {
 }
 
+// Result is what a command wrote and how it ended.
+type Result struct {
+	// Stdout is only set by Capture.
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is -1 if the command was killed by a signal or could not be
+	// started.
+	ExitCode int
+	// Signal is the name of the signal that killed the command, if any.
+	Signal string
+}
+
+// Run runs the command and returns its output. See Stream.
 func (c CommandRunner) Run(ctx context.Context, command string, args ...string) ([]byte, error) {
-	output, err := exec.CommandContext(ctx, command, args...).Output()
+	return c.RunPipeline(ctx, Command(command, args...))
+}
+
+// RunPipeline runs the pipeline and returns its output. See Stream.
+func (c CommandRunner) RunPipeline(ctx context.Context, pipeline Pipeline) ([]byte, error) {
+	result, err := c.Capture(ctx, pipeline)
+	return result.Stdout, err
+}
+
+// Capture runs the pipeline and returns what it wrote, even if it failed.
+// See Stream.
+func (c CommandRunner) Capture(ctx context.Context, pipeline Pipeline) (Result, error) {
+	var stdout bytes.Buffer
+	result, err := c.Stream(ctx, &stdout, pipeline)
+	result.Stdout = stdout.Bytes()
+	return result, err
+}
+
+// Stream runs the stages of the pipeline in their own process group,
+// writing the stdout of the last stage to the writer as it is produced. As
+// with a shell, the exit status is the last stage's, and the stderr of
+// every stage is kept. When ctx is done, the whole group is sent SIGTERM,
+// then SIGKILL after a grace period, so that the children of the commands
+// do not outlive them.
+func (c CommandRunner) Stream(ctx context.Context, stdout io.Writer, pipeline Pipeline) (Result, error) {
+	if err := pipeline.Validate(); err != nil {
+		return Result{ExitCode: -1}, err
+	}
 
-	if ctx.Err() == context.DeadlineExceeded {
-		return output, ctx.Err()
+	var (
+		mutex      sync.Mutex
+		pgid       int
+		terminated time.Time
+	)
+
+	cmds := make([]*exec.Cmd, len(pipeline))
+	stderrs := make([]bytes.Buffer, len(pipeline))
+	for i, argv := range pipeline {
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stderr = &stderrs[i]
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Cancel = func() error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if terminated.IsZero() {
+				terminated = time.Now()
+			}
+			if pgid == 0 {
+				return nil
+			}
+			return unix.Kill(-pgid, unix.SIGTERM)
+		}
+		cmd.WaitDelay = gracePeriod
+		cmds[i] = cmd
+	}
+	cmds[len(cmds)-1].Stdout = stdout
+
+	mutex.Lock()
+	started, err := startPipeline(cmds)
+	if len(started) > 0 {
+		pgid = started[0].Process.Pid
 	}
+	mutex.Unlock()
 
-	if exitErr, ok := err.(*exec.ExitError); ok {
-		return output, errors.New(string(exitErr.Stderr))
+	if err != nil && len(started) > 0 {
+		unix.Kill(-pgid, unix.SIGKILL)
+	}
+	var lastErr error
+	for _, cmd := range started {
+		lastErr = cmd.Wait()
+	}
+
+	result := Result{ExitCode: -1}
+	for i := range stderrs {
+		result.Stderr = append(result.Stderr, stderrs[i].Bytes()...)
+	}
+	if err != nil {
+		return result, err
 	}
 
-	return output, nil
+	last := cmds[len(cmds)-1]
+	result.ExitCode = last.ProcessState.ExitCode()
+	if status, ok := last.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = unix.SignalName(status.Signal())
+	}
+
+	if ctx.Err() != nil {
+		if stray := killGroup(pgid, terminated.Add(gracePeriod)); len(stray) > 0 {
+			return result, StrayProcessesError{Err: ctx.Err(), Processes: stray}
+		}
+		return result, ctx.Err()
+	}
+
+	if exitErr, ok := lastErr.(*exec.ExitError); ok {
+		if stderr := strings.TrimSpace(string(result.Stderr)); stderr != "" {
+			return result, fmt.Errorf("%w: %s", exitErr, stderr)
+		}
+		return result, exitErr
+	}
+
+	return result, nil
+}
+
+// startPipeline starts the commands in the process group of the first one,
+// piping the stdout of each into the stdin of the next. It returns the
+// commands started, which are all of them unless it fails.
+func startPipeline(cmds []*exec.Cmd) ([]*exec.Cmd, error) {
+	var pipes []*os.File
+	// The commands have their own copies of the pipes once started
+	defer func() {
+		for _, pipe := range pipes {
+			pipe.Close()
+		}
+	}()
+
+	for i := 0; i < len(cmds)-1; i++ {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		pipes = append(pipes, reader, writer)
+		cmds[i].Stdout = writer
+		cmds[i+1].Stdin = reader
+	}
+
+	for i, cmd := range cmds {
+		if i > 0 {
+			cmd.SysProcAttr.Pgid = cmds[0].Process.Pid
+		}
+		if err := start(cmd); err != nil {
+			return cmds[:i], err
+		}
+	}
+
+	return cmds, nil
+}
+
+// killGroup waits until the deadline for the processes of the group to
+// exit, sends the ones left SIGKILL and returns those still running after
+// that.
+func killGroup(pgid int, deadline time.Time) []string {
+	if waitForGroup(pgid, deadline) {
+		return nil
+	}
+
+	unix.Kill(-pgid, unix.SIGKILL)
+	if waitForGroup(pgid, time.Now().Add(killTimeout)) {
+		return nil
+	}
+	return groupProcesses(pgid)
+}
+
+func waitForGroup(pgid int, deadline time.Time) bool {
+	for len(groupProcesses(pgid)) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// groupProcesses returns the processes of the group that are not zombies,
+// as their PIDs and names.
+func groupProcesses(pgid int) []string {
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+
+	var processes []string
+	for _, path := range stats {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		// The name is in parentheses and may contain spaces, the fields
+		// after it are the state, the parent PID and the process group
+		stat := string(contents)
+		end := strings.LastIndexByte(stat, ')')
+		start := strings.IndexByte(stat, '(')
+		if start < 0 || end < start {
+			continue
+		}
+		fields := strings.Fields(stat[end+1:])
+		if len(fields) < 3 || fields[0] == "Z" || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+
+		pid := strings.TrimSpace(stat[:start])
+		processes = append(processes, fmt.Sprintf("%s (%s)", pid, stat[start+1:end]))
+	}
+	return processes
 }
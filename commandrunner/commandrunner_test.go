@@ -1,12 +1,19 @@
 package commandrunner_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/dontpanic/commandrunner"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("Commandrunner", func() {
@@ -44,6 +51,23 @@ var _ = Describe("Commandrunner", func() {
 			Expect(runErr.Error()).To(ContainSubstring("No such file or directory"))
 		})
 
+		It("includes the exit status before the stderr", func() {
+			Expect(runErr).To(MatchError(HavePrefix("exit status 1: ")))
+
+			var exitErr *exec.ExitError
+			Expect(errors.As(runErr, &exitErr)).To(BeTrue())
+		})
+	})
+
+	Context("when the command fails without writing to stderr", func() {
+		BeforeEach(func() {
+			command = "false"
+			args = nil
+		})
+
+		It("returns the exit status", func() {
+			Expect(runErr).To(MatchError("exit status 1"))
+		})
 	})
 
 	Context("when the command exceeds the deadline", func() {
@@ -61,4 +85,170 @@ var _ = Describe("Commandrunner", func() {
 		})
 	})
 
+	Context("when the command is cancelled while its children are running", func() {
+		var (
+			cancel  context.CancelFunc
+			pidFile string
+		)
+		BeforeEach(func() {
+			ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+			pidFile = filepath.Join(GinkgoT().TempDir(), "pid")
+			command = "sh"
+			args = []string{"-c", "sleep 30 & echo $! > " + pidFile + "; wait"}
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("terminates the whole process group", func() {
+			Expect(runErr).To(Equal(context.DeadlineExceeded))
+			Expect(running(pidFile)).To(BeFalse())
+		})
+
+		When("they ignore SIGTERM", func() {
+			BeforeEach(func() {
+				args = []string{"-c", "trap '' TERM; sleep 30 & echo $! > " + pidFile + "; wait"}
+			})
+
+			It("kills them after a grace period", func() {
+				Expect(runErr).To(Equal(context.DeadlineExceeded))
+				Expect(running(pidFile)).To(BeFalse())
+			})
+		})
+	})
+
+	Context("when the command is cancelled while its children hold its output open", func() {
+		var (
+			cancel  context.CancelFunc
+			started time.Time
+		)
+		BeforeEach(func() {
+			started = time.Now()
+			ctx, cancel = context.WithCancel(context.Background())
+			time.AfterFunc(100*time.Millisecond, cancel)
+			command = "sh"
+			args = []string{"-c", "sleep 30; echo done"}
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("returns promptly with the cancellation error", func() {
+			Expect(runErr).To(Equal(context.Canceled))
+			Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+		})
+	})
+
+})
+
+var _ = Describe("Pipelines", func() {
+	var cmdRunner commandrunner.CommandRunner
+
+	It("pipes the stdout of each stage into the next", func() {
+		output, err := cmdRunner.RunPipeline(context.Background(), commandrunner.Pipeline{{"seq", "1", "10"}, {"grep", "1"}, {"wc", "-l"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(output))).To(Equal("2"))
+	})
+
+	It("passes arguments as they are, without a shell", func() {
+		output, err := cmdRunner.Run(context.Background(), "echo", "$HOME; rm -rf /", "a  b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(Equal("$HOME; rm -rf / a  b\n"))
+	})
+
+	It("exits with the status of the last stage, keeping the stderr of every stage", func() {
+		result, err := cmdRunner.Capture(context.Background(), commandrunner.Pipeline{{"sh", "-c", "echo first >&2; exit 3"}, {"sh", "-c", "echo last >&2; exit 4"}})
+		Expect(err).To(MatchError("exit status 4: first\nlast"))
+		Expect(result.ExitCode).To(Equal(4))
+
+		_, err = cmdRunner.Capture(context.Background(), commandrunner.Pipeline{{"false"}, {"true"}})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("fails when a stage cannot be started", func() {
+		_, err := cmdRunner.RunPipeline(context.Background(), commandrunner.Pipeline{{"seq", "1", "10"}, {"/does/not/exist"}})
+		Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+	})
+
+	It("rejects empty stages", func() {
+		_, err := cmdRunner.RunPipeline(context.Background(), commandrunner.Pipeline{{"date"}, {}})
+		Expect(err).To(MatchError("the command has an empty stage"))
+	})
 })
+
+var _ = Describe("Stream", func() {
+	var cmdRunner commandrunner.CommandRunner
+
+	It("writes the output as it is produced", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		output := gbytes.NewBuffer()
+		done := make(chan error, 1)
+		go func() {
+			_, err := cmdRunner.Stream(ctx, output, commandrunner.Shell("echo first; sleep 30; echo last"))
+			done <- err
+		}()
+
+		Eventually(output).Should(gbytes.Say("first\n"))
+		Consistently(done, 100*time.Millisecond).ShouldNot(Receive())
+
+		cancel()
+		Eventually(done, 5*time.Second).Should(Receive(Equal(context.Canceled)))
+		Expect(output.Contents()).To(Equal([]byte("first\n")))
+	})
+
+	It("starts every stage with the start function set", func() {
+		var started []string
+		commandrunner.SetStart(func(cmd *exec.Cmd) error {
+			started = append(started, cmd.Args[0])
+			return cmd.Start()
+		})
+		DeferCleanup(commandrunner.SetStart, (*exec.Cmd).Start)
+
+		output, err := cmdRunner.RunPipeline(context.Background(), commandrunner.Pipeline{{"echo", "hello"}, {"cat"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(Equal("hello\n"))
+		Expect(started).To(Equal([]string{"echo", "cat"}))
+	})
+
+	It("runs the command to completion when the writer caps its output", func() {
+		output := &cappedWriter{max: 10}
+		result, err := cmdRunner.Stream(context.Background(), output, commandrunner.Command("seq", "1", "100000"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.ExitCode).To(Equal(0))
+		Expect(output.kept.String()).To(Equal("1\n2\n3\n4\n5\n"))
+		Expect(output.dropped).To(BeEquivalentTo(588885))
+	})
+})
+
+// cappedWriter keeps the first max bytes written to it and drops the rest,
+// as the command collector does with its output limit.
+type cappedWriter struct {
+	kept    bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	keep := min(len(p), w.max-w.kept.Len())
+	w.dropped += len(p) - keep
+	w.kept.Write(p[:keep])
+	return len(p), nil
+}
+
+// running returns whether the process whose PID is in the file is running,
+// zombies excluded.
+func running(pidFile string) bool {
+	pid, err := os.ReadFile(pidFile)
+	Expect(err).NotTo(HaveOccurred())
+
+	stat, err := os.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(pid)), "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return fields[0] != "Z"
+}
@@ -0,0 +1,66 @@
+package commandrunner
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Pipeline is a command run without a shell: one or more stages, each an
+// argv, with the stdout of each stage piped into the stdin of the next.
+type Pipeline [][]string
+
+// Command returns the pipeline of a single command.
+func Command(command string, args ...string) Pipeline {
+	return Pipeline{append([]string{command}, args...)}
+}
+
+// Shell returns the pipeline running the script with sh -c, for commands
+// that need a shell.
+func Shell(script string) Pipeline {
+	return Command("sh", "-c", script)
+}
+
+// Script returns the script of pipelines returned by Shell.
+func (p Pipeline) Script() (string, bool) {
+	if len(p) == 1 && len(p[0]) == 3 && p[0][0] == "sh" && p[0][1] == "-c" {
+		return p[0][2], true
+	}
+	return "", false
+}
+
+func (p Pipeline) Validate() error {
+	if len(p) == 0 {
+		return errors.New("the command is empty")
+	}
+
+	for _, stage := range p {
+		if len(stage) == 0 || stage[0] == "" {
+			return errors.New("the command has an empty stage")
+		}
+	}
+
+	return nil
+}
+
+var safeArgument = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// String returns the pipeline as it would be written for a shell.
+func (p Pipeline) String() string {
+	stages := make([]string, len(p))
+	for i, stage := range p {
+		args := make([]string, len(stage))
+		for j, arg := range stage {
+			args[j] = quote(arg)
+		}
+		stages[i] = strings.Join(args, " ")
+	}
+	return strings.Join(stages, " | ")
+}
+
+func quote(arg string) string {
+	if safeArgument.MatchString(arg) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
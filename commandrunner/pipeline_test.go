@@ -0,0 +1,24 @@
+package commandrunner_test
+
+import (
+	"code.cloudfoundry.org/dontpanic/commandrunner"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pipeline", func() {
+	It("is written as for a shell, quoting arguments that need it", func() {
+		pipeline := commandrunner.Pipeline{{"find", "/var/vcap/data/garden/depot"}, {"sed", "s|[^/]*/|- |g"}}
+		Expect(pipeline.String()).To(Equal(`find /var/vcap/data/garden/depot | sed 's|[^/]*/|- |g'`))
+		Expect(commandrunner.Command("echo", "it's").String()).To(Equal(`echo 'it'\''s'`))
+	})
+
+	It("knows the script of shell commands", func() {
+		script, ok := commandrunner.Shell("date; uptime").Script()
+		Expect(ok).To(BeTrue())
+		Expect(script).To(Equal("date; uptime"))
+
+		_, ok = commandrunner.Command("date").Script()
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/encrypt"
+)
+
+type DecryptCommand struct {
+	Key    string `long:"key" required:"true" description:"PEM encoded X25519 private key the report was encrypted to"`
+	Output string `short:"o" long:"output" description:"File to write the decrypted archive to, or - for stdout (defaults to the report name without the .enc extension)"`
+	Args   struct {
+		Report string `positional-arg-name:"REPORT" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *DecryptCommand) Execute([]string) error {
+	key, err := encrypt.LoadPrivateKey(c.Key)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(c.Args.Report)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	decrypted, err := encrypt.NewReader(in, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.Args.Report, err)
+	}
+
+	outputPath := c.Output
+	if outputPath == "" {
+		if !strings.HasSuffix(c.Args.Report, encrypt.Extension) {
+			return errors.New("the report has no .enc extension, please choose a name for the decrypted archive with --output")
+		}
+		outputPath = strings.TrimSuffix(c.Args.Report, encrypt.Extension)
+	}
+
+	if outputPath == "-" {
+		_, err := io.Copy(os.Stdout, decrypted)
+		return err
+	}
+
+	return writeFile(outputPath, decrypted)
+}
+
+// writeFile writes the contents of r to path, removing the file again if
+// reading fails part way.
+func writeFile(path string, r io.Reader) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
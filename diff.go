@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/diff"
+	"code.cloudfoundry.org/dontpanic/report"
+)
+
+type DiffCommand struct {
+	Key  string `long:"key" description:"PEM encoded X25519 private key to decrypt encrypted reports with"`
+	JSON bool   `long:"json" description:"Print the differences as JSON"`
+	Args struct {
+		Old string `positional-arg-name:"OLD" description:"Earlier report archive or uncompressed report directory" required:"yes"`
+		New string `positional-arg-name:"NEW" description:"Later report archive or uncompressed report directory" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *DiffCommand) Execute([]string) error {
+	old, err := c.snapshot(c.Args.Old)
+	if err != nil {
+		return err
+	}
+
+	new, err := c.snapshot(c.Args.New)
+	if err != nil {
+		return err
+	}
+
+	differences := diff.Compare(old, new)
+	if c.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(differences)
+	}
+	return differences.WriteText(os.Stdout)
+}
+
+func (c *DiffCommand) snapshot(path string) (diff.Snapshot, error) {
+	files, err := report.Read(path, c.Key, diff.Patterns())
+	if err != nil {
+		return diff.Snapshot{}, err
+	}
+	return diff.Snapshot{Name: filepath.Base(path), Files: files}, nil
+}
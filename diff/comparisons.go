@@ -0,0 +1,313 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// comparison compares the files of one collector.
+type comparison struct {
+	name string
+	// collector is the name of the built-in collector producing the files.
+	collector string
+	files     []string
+	compare   func(section *Section, old, new map[string][]byte)
+}
+
+var comparisons = []comparison{
+	{name: "Processes", collector: "Process Information", files: []string{"ps-info.log"}, compare: compareProcesses},
+	{name: "Containers", collector: "Garden Containers", files: []string{"garden-containers.log"}, compare: compareContainers},
+	{name: "Open files", collector: "Number of Open Files", files: []string{"num-open-files.log"}, compare: compareOpenFiles},
+	{name: "GrootFS usage", collector: "GrootFS Unprivileged Usage", files: []string{"grootfs/*-usage.txt"}, compare: compareGrootFS},
+	{name: "Slab caches", collector: "Slabinfo", files: []string{"slabinfo.log"}, compare: compareSlabs},
+	{name: "Memory", collector: "Meminfo", files: []string{"meminfo.log"}, compare: compareMeminfo},
+	{name: "IP tables rules", collector: "IP Tables", files: []string{"iptables-L.log"}, compare: compareIPTables},
+	{name: "NAT IP tables rules", collector: "NAT IP Tables", files: []string{"iptables-tnat.log"}, compare: compareIPTables},
+	{name: "Mounts", collector: "Mount Table", files: []string{"mountinfo.log"}, compare: compareMounts},
+	{name: "Kernel log", collector: "Kernel Messages", files: []string{"dmesg.log"}, compare: compareKernelLog},
+}
+
+// single returns the contents of the only file of a comparison.
+func single(files map[string][]byte) string {
+	for _, contents := range files {
+		return string(contents)
+	}
+	return ""
+}
+
+func lines(contents string) []string {
+	return strings.Split(strings.TrimRight(contents, "\n"), "\n")
+}
+
+// compareSets records the entries only in old as removed and the entries
+// only in new as added, keeping their order.
+func compareSets(section *Section, old, new []string) {
+	section.Added = difference(new, old)
+	section.Removed = difference(old, new)
+}
+
+// difference returns the entries of a that are not in b, once each.
+func difference(a, b []string) []string {
+	seen := map[string]bool{}
+	for _, entry := range b {
+		seen[entry] = true
+	}
+
+	entries := []string{}
+	for _, entry := range a {
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// compareValues records the values that differ, in the order of the keys
+// given. Keys missing on one side count as zero.
+func compareValues(section *Section, keys []string, old, new map[string]int64, unit string) {
+	for _, key := range keys {
+		if old[key] != new[key] {
+			section.Changes = append(section.Changes, Change{Key: key, Old: old[key], New: new[key], Unit: unit})
+		}
+	}
+}
+
+// unionKeys returns the keys of both maps, those of old first in the given
+// order.
+func unionKeys(order []string, new map[string]int64) []string {
+	keys := append([]string{}, order...)
+	extra := []string{}
+	for key := range new {
+		if !slices.Contains(keys, key) {
+			extra = append(extra, key)
+		}
+	}
+	slices.Sort(extra)
+	return append(keys, extra...)
+}
+
+// processes lists the processes in the output of ps -eLo, one entry per
+// process rather than per thread.
+func processes(contents string) []string {
+	entries := []string{}
+	pid, tid, command := -1, -1, -1
+	for _, line := range lines(contents) {
+		fields := strings.Fields(line)
+		if pid < 0 {
+			pid, tid, command = indexOf(fields, "PID"), indexOf(fields, "TID"), indexOf(fields, "COMMAND")
+			continue
+		}
+		if len(fields) <= max(pid, tid, command) || fields[pid] != fields[tid] {
+			continue
+		}
+		entries = append(entries, fields[pid]+" "+fields[command])
+	}
+	return entries
+}
+
+func compareProcesses(section *Section, old, new map[string][]byte) {
+	compareSets(section, processes(single(old)), processes(single(new)))
+}
+
+func containers(contents string) []string {
+	var list struct {
+		Handles []string `json:"handles"`
+	}
+	json.Unmarshal([]byte(contents), &list)
+	return list.Handles
+}
+
+func compareContainers(section *Section, old, new map[string][]byte) {
+	compareSets(section, containers(single(old)), containers(single(new)))
+}
+
+func compareOpenFiles(section *Section, old, new map[string][]byte) {
+	oldCount, _ := strconv.ParseInt(strings.TrimSpace(single(old)), 10, 64)
+	newCount, _ := strconv.ParseInt(strings.TrimSpace(single(new)), 10, 64)
+	compareValues(section, []string{"open files"}, map[string]int64{"open files": oldCount}, map[string]int64{"open files": newCount}, "")
+}
+
+var usageLine = regexp.MustCompile(`^([a-z-]+):\s+(\d+) bytes`)
+
+// grootFSUsage reads the sizes from the usage files of each store, keyed
+// by store and size.
+func grootFSUsage(files map[string][]byte) ([]string, map[string]int64) {
+	keys, sizes := []string{}, map[string]int64{}
+	for _, name := range sortedNames(files) {
+		store := strings.TrimSuffix(path.Base(name), "-usage.txt")
+		for _, line := range lines(string(files[name])) {
+			if groups := usageLine.FindStringSubmatch(line); groups != nil {
+				key := store + " " + groups[1]
+				keys = append(keys, key)
+				sizes[key], _ = strconv.ParseInt(groups[2], 10, 64)
+			}
+		}
+	}
+	return keys, sizes
+}
+
+func compareGrootFS(section *Section, old, new map[string][]byte) {
+	keys, oldSizes := grootFSUsage(old)
+	_, newSizes := grootFSUsage(new)
+	compareValues(section, unionKeys(keys, newSizes), oldSizes, newSizes, "bytes")
+}
+
+// slabs reads the memory used by each slab cache from /proc/slabinfo.
+func slabs(contents string) map[string]int64 {
+	sizes := map[string]int64{}
+	for _, line := range lines(contents) {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "slabinfo") {
+			continue
+		}
+		objects, err1 := strconv.ParseInt(fields[2], 10, 64)
+		size, err2 := strconv.ParseInt(fields[3], 10, 64)
+		if err1 == nil && err2 == nil {
+			sizes[fields[0]] = objects * size
+		}
+	}
+	return sizes
+}
+
+// compareSlabs lists the caches that changed the most first.
+func compareSlabs(section *Section, old, new map[string][]byte) {
+	oldSizes, newSizes := slabs(single(old)), slabs(single(new))
+	compareValues(section, unionKeys(sortedKeys(oldSizes), newSizes), oldSizes, newSizes, "bytes")
+
+	sort.SliceStable(section.Changes, func(i, j int) bool {
+		return abs(section.Changes[i].Delta()) > abs(section.Changes[j].Delta())
+	})
+}
+
+// meminfo reads the fields of /proc/meminfo that are sizes in kB, in
+// order.
+func meminfo(contents string) ([]string, map[string]int64) {
+	keys, values := []string{}, map[string]int64{}
+	for _, line := range lines(contents) {
+		key, value, found := strings.Cut(line, ":")
+		if !found || !strings.HasSuffix(value, " kB") {
+			continue
+		}
+		number, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(value, " kB")), 10, 64)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+		values[key] = number
+	}
+	return keys, values
+}
+
+func compareMeminfo(section *Section, old, new map[string][]byte) {
+	keys, oldValues := meminfo(single(old))
+	_, newValues := meminfo(single(new))
+	compareValues(section, unionKeys(keys, newValues), oldValues, newValues, "kB")
+}
+
+// ipTablesRules counts the rules of each chain in the output of
+// iptables -L.
+func ipTablesRules(contents string) ([]string, map[string]int64) {
+	chains, counts := []string{}, map[string]int64{}
+	chain := ""
+	for _, line := range lines(contents) {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "Chain":
+			chain = fields[1]
+			chains = append(chains, chain)
+			counts[chain] = 0
+		case len(fields) == 0 || chain == "" || fields[0] == "target":
+		default:
+			counts[chain]++
+		}
+	}
+	return chains, counts
+}
+
+// compareIPTables records added and removed chains, the change in the
+// total number of rules and in the rules of chains present in both.
+func compareIPTables(section *Section, old, new map[string][]byte) {
+	oldChains, oldCounts := ipTablesRules(single(old))
+	newChains, newCounts := ipTablesRules(single(new))
+	compareSets(section, oldChains, newChains)
+
+	compareValues(section, []string{"total rules"}, map[string]int64{"total rules": sum(oldCounts)}, map[string]int64{"total rules": sum(newCounts)}, "")
+	for _, chain := range oldChains {
+		if _, found := newCounts[chain]; found && oldCounts[chain] != newCounts[chain] {
+			section.Changes = append(section.Changes, Change{Key: "rules in " + chain, Old: oldCounts[chain], New: newCounts[chain]})
+		}
+	}
+}
+
+// mounts lists the mount points and file system types in a mountinfo file.
+func mounts(contents string) []string {
+	entries := []string{}
+	for _, line := range lines(contents) {
+		fields := strings.Fields(line)
+		separator := indexOf(fields, "-")
+		if separator < 5 || len(fields) <= separator+1 {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s (%s)", fields[4], fields[separator+1]))
+	}
+	return entries
+}
+
+func compareMounts(section *Section, old, new map[string][]byte) {
+	compareSets(section, mounts(single(old)), mounts(single(new)))
+}
+
+// compareKernelLog only records new lines, as old ones drop out of the ring
+// buffer.
+func compareKernelLog(section *Section, old, new map[string][]byte) {
+	section.Added = difference(lines(single(new)), lines(single(old)))
+}
+
+func indexOf(fields []string, name string) int {
+	for i, field := range fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func sortedKeys(values map[string]int64) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func sum(values map[string]int64) int64 {
+	var total int64
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,157 @@
+// Package diff compares two reports taken from the same cell, to show how
+// it changed in between.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/osreporter"
+	"code.cloudfoundry.org/dontpanic/report"
+)
+
+const manifestFilename = "manifest.json"
+
+// Snapshot is one of the reports being compared.
+type Snapshot struct {
+	Name  string
+	Files map[string][]byte
+}
+
+// Patterns returns the patterns, as understood by path.Match, of the files
+// a snapshot needs to hold to be compared.
+func Patterns() []string {
+	patterns := []string{manifestFilename}
+	for _, comparison := range comparisons {
+		patterns = append(patterns, comparison.files...)
+	}
+	return patterns
+}
+
+type Diff struct {
+	Old      Side      `json:"old"`
+	New      Side      `json:"new"`
+	Sections []Section `json:"sections"`
+}
+
+// Side describes one of the compared reports.
+type Side struct {
+	Name      string    `json:"name"`
+	StartTime time.Time `json:"start_time,omitzero"`
+}
+
+// Section holds the differences in the data of one collector.
+type Section struct {
+	Name      string `json:"name"`
+	Collector string `json:"collector"`
+	// Unavailable explains why the data could not be compared.
+	Unavailable string   `json:"unavailable,omitempty"`
+	Added       []string `json:"added,omitempty"`
+	Removed     []string `json:"removed,omitempty"`
+	Changes     []Change `json:"changes,omitempty"`
+}
+
+// Changed returns whether anything differs in the section.
+func (s Section) Changed() bool {
+	return len(s.Added) > 0 || len(s.Removed) > 0 || len(s.Changes) > 0
+}
+
+// Change is a value that differs between the reports.
+type Change struct {
+	Key  string `json:"key"`
+	Old  int64  `json:"old"`
+	New  int64  `json:"new"`
+	Unit string `json:"unit,omitempty"`
+}
+
+func (c Change) Delta() int64 {
+	return c.New - c.Old
+}
+
+// Compare returns the differences between the old and the new report.
+func Compare(old, new Snapshot) Diff {
+	oldManifest, newManifest := readManifest(old), readManifest(new)
+
+	diff := Diff{
+		Old:      Side{Name: old.Name, StartTime: oldManifest.StartTime},
+		New:      Side{Name: new.Name, StartTime: newManifest.StartTime},
+		Sections: []Section{},
+	}
+
+	for _, comparison := range comparisons {
+		section := Section{
+			Name:      comparison.name,
+			Collector: collectorName(comparison, oldManifest, newManifest),
+		}
+
+		oldFiles, newFiles := matching(old, comparison.files), matching(new, comparison.files)
+		switch {
+		case len(oldFiles) == 0:
+			section.Unavailable = unavailable("old", section.Collector, oldManifest)
+		case len(newFiles) == 0:
+			section.Unavailable = unavailable("new", section.Collector, newManifest)
+		default:
+			comparison.compare(&section, oldFiles, newFiles)
+		}
+
+		diff.Sections = append(diff.Sections, section)
+	}
+
+	return diff
+}
+
+func readManifest(snapshot Snapshot) osreporter.Manifest {
+	var manifest osreporter.Manifest
+	json.Unmarshal(snapshot.Files[manifestFilename], &manifest)
+	return manifest
+}
+
+func matching(snapshot Snapshot, patterns []string) map[string][]byte {
+	files := map[string][]byte{}
+	for name, contents := range snapshot.Files {
+		if report.Matches(patterns, name) {
+			files[name] = contents
+		}
+	}
+	return files
+}
+
+// collectorName aligns a comparison with the collector that produced its
+// files, falling back to the name of the built-in collector.
+func collectorName(c comparison, manifests ...osreporter.Manifest) string {
+	for _, manifest := range manifests {
+		for _, result := range manifest.Collectors {
+			for _, file := range result.Files {
+				if report.Matches(c.files, file.Path) {
+					return result.Name
+				}
+			}
+		}
+	}
+	return c.collector
+}
+
+func unavailable(side, collector string, manifest osreporter.Manifest) string {
+	reason := fmt.Sprintf("not collected in the %s report", side)
+
+	for _, result := range manifest.Collectors {
+		if result.Name != collector {
+			continue
+		}
+
+		switch result.Outcome {
+		case osreporter.OutcomeSkipped:
+			return fmt.Sprintf("%s, the collector was skipped: %s", reason, result.Reason)
+		case osreporter.OutcomeFailed:
+			return fmt.Sprintf("%s, the collector failed: %s", reason, strings.TrimSpace(result.Error))
+		case osreporter.OutcomeTimedOut:
+			return fmt.Sprintf("%s, the collector timed out", reason)
+		case osreporter.OutcomeCancelled:
+			return fmt.Sprintf("%s, the collector was cancelled with the report", reason)
+		}
+	}
+
+	return reason
+}
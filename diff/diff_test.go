@@ -0,0 +1,194 @@
+package diff_test
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"code.cloudfoundry.org/dontpanic/diff"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compare", func() {
+	var old, new map[string]string
+
+	BeforeEach(func() {
+		old = map[string]string{"manifest.json": `{"start_time": "2026-10-01T10:00:00Z", "collectors": []}`}
+		new = map[string]string{"manifest.json": `{"start_time": "2026-10-01T12:30:00Z", "collectors": []}`}
+	})
+
+	snapshot := func(name string, files map[string]string) diff.Snapshot {
+		snapshot := diff.Snapshot{Name: name, Files: map[string][]byte{}}
+		for file, contents := range files {
+			snapshot.Files[file] = []byte(contents)
+		}
+		return snapshot
+	}
+
+	compare := func() diff.Diff {
+		return diff.Compare(snapshot("old-report", old), snapshot("new-report", new))
+	}
+
+	section := func(name string) diff.Section {
+		for _, section := range compare().Sections {
+			if section.Name == name {
+				return section
+			}
+		}
+		Fail("no section " + name)
+		return diff.Section{}
+	}
+
+	It("lists new and removed processes, not threads", func() {
+		old["ps-info.log"] = `    PID     TID    PPID USER        COMMAND         S WCHAN     STARTED
+      1       1       0 root        systemd         S ep_poll   Thu Oct  1 09:00:00 2026
+     99      99       1 vcap        ruby            S ep_poll   Thu Oct  1 09:00:00 2026
+`
+		new["ps-info.log"] = `    PID     TID    PPID USER        COMMAND         S WCHAN     STARTED
+      1       1       0 root        systemd         S ep_poll   Thu Oct  1 09:00:00 2026
+   1234    1234       1 root        gdn             S ep_poll   Thu Oct  1 11:00:00 2026
+   1234    1235       1 root        gdn             S futex     Thu Oct  1 11:00:00 2026
+`
+
+		Expect(section("Processes")).To(Equal(diff.Section{
+			Name:      "Processes",
+			Collector: "Process Information",
+			Added:     []string{"1234 gdn"},
+			Removed:   []string{"99 ruby"},
+		}))
+	})
+
+	It("lists new and removed containers", func() {
+		old["garden-containers.log"] = `{"handles":["a","b"]}`
+		new["garden-containers.log"] = `{"handles":["b","c"]}`
+
+		Expect(section("Containers").Added).To(Equal([]string{"c"}))
+		Expect(section("Containers").Removed).To(Equal([]string{"a"}))
+	})
+
+	It("shows the growth in open files", func() {
+		old["num-open-files.log"] = "12000\n"
+		new["num-open-files.log"] = "15000\n"
+
+		Expect(section("Open files").Changes).To(Equal([]diff.Change{{Key: "open files", Old: 12000, New: 15000}}))
+	})
+
+	It("shows changes in GrootFS usage per store", func() {
+		old["grootfs/unprivileged-usage.txt"] = "volumes-total-on-disk:             1000 bytes\nquotas-size:                        10 bytes\n"
+		new["grootfs/unprivileged-usage.txt"] = "volumes-total-on-disk:             3000 bytes\nquotas-size:                        10 bytes\n"
+
+		Expect(section("GrootFS usage").Changes).To(Equal([]diff.Change{{Key: "unprivileged volumes-total-on-disk", Old: 1000, New: 3000, Unit: "bytes"}}))
+	})
+
+	It("lists the slab caches that grew or shrank the most first", func() {
+		header := "slabinfo - version: 2.1\n# name            <active_objs> <num_objs> <objsize> <objperslab> <pagesperslab> : tunables <limit> <batchcount> <sharedfactor> : slabdata <active_slabs> <num_slabs> <sharedavail>\n"
+		old["slabinfo.log"] = header + "dentry 100 100 192 21 1 : tunables 0 0 0 : slabdata 5 5 0\nkmalloc-64 10 10 64 64 1 : tunables 0 0 0 : slabdata 1 1 0\n"
+		new["slabinfo.log"] = header + "dentry 100 1000 192 21 1 : tunables 0 0 0 : slabdata 50 50 0\nkmalloc-64 20 20 64 64 1 : tunables 0 0 0 : slabdata 1 1 0\n"
+
+		Expect(section("Slab caches").Changes).To(Equal([]diff.Change{
+			{Key: "dentry", Old: 19200, New: 192000, Unit: "bytes"},
+			{Key: "kmalloc-64", Old: 640, New: 1280, Unit: "bytes"},
+		}))
+	})
+
+	It("shows the meminfo fields that changed", func() {
+		old["meminfo.log"] = "MemTotal:       16384000 kB\nMemFree:         8000000 kB\nHugePages_Total:       0\n"
+		new["meminfo.log"] = "MemTotal:       16384000 kB\nMemFree:         2000000 kB\nHugePages_Total:       4\n"
+
+		Expect(section("Memory").Changes).To(Equal([]diff.Change{{Key: "MemFree", Old: 8000000, New: 2000000, Unit: "kB"}}))
+	})
+
+	It("counts the IP tables rules per chain", func() {
+		old["iptables-L.log"] = `Chain INPUT (policy ACCEPT)
+target     prot opt source               destination
+ACCEPT     all  --  anywhere             anywhere
+
+Chain w--instance-abc (1 references)
+target     prot opt source               destination
+RETURN     all  --  anywhere             anywhere
+`
+		new["iptables-L.log"] = `Chain INPUT (policy ACCEPT)
+target     prot opt source               destination
+ACCEPT     all  --  anywhere             anywhere
+REJECT     all  --  anywhere             anywhere
+
+Chain w--instance-def (1 references)
+target     prot opt source               destination
+RETURN     all  --  anywhere             anywhere
+`
+
+		Expect(section("IP tables rules")).To(Equal(diff.Section{
+			Name:      "IP tables rules",
+			Collector: "IP Tables",
+			Added:     []string{"w--instance-def"},
+			Removed:   []string{"w--instance-abc"},
+			Changes: []diff.Change{
+				{Key: "total rules", Old: 2, New: 3},
+				{Key: "rules in INPUT", Old: 1, New: 2},
+			},
+		}))
+	})
+
+	It("lists new and removed mounts", func() {
+		old["mountinfo.log"] = "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n"
+		new["mountinfo.log"] = "22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n300 22 0:99 / /var/vcap/data/grootfs/store/unprivileged/images/abc/rootfs rw - overlay overlay rw\n"
+
+		Expect(section("Mounts").Added).To(Equal([]string{"/var/vcap/data/grootfs/store/unprivileged/images/abc/rootfs (overlay)"}))
+		Expect(section("Mounts").Removed).To(BeEmpty())
+	})
+
+	It("lists only the new kernel log lines", func() {
+		old["dmesg.log"] = "[Thu Oct  1 08:00:00 2026] booted\n[Thu Oct  1 09:00:00 2026] eth0 up\n"
+		new["dmesg.log"] = "[Thu Oct  1 09:00:00 2026] eth0 up\n[Thu Oct  1 11:00:00 2026] Out of memory: Killed process 1234 (java)\n"
+
+		Expect(section("Kernel log").Added).To(Equal([]string{"[Thu Oct  1 11:00:00 2026] Out of memory: Killed process 1234 (java)"}))
+		Expect(section("Kernel log").Removed).To(BeEmpty())
+	})
+
+	Describe("aligning by collector", func() {
+		It("names sections after the collector that produced the files", func() {
+			new["manifest.json"] = `{"collectors": [{"name": "Custom Processes", "outcome": "ok", "files": [{"path": "ps-info.log"}]}]}`
+
+			Expect(section("Processes").Collector).To(Equal("Custom Processes"))
+		})
+
+		It("explains why data is missing from a report", func() {
+			old["meminfo.log"] = "MemFree: 1 kB\n"
+			new["manifest.json"] = `{"collectors": [
+				{"name": "Meminfo", "outcome": "skipped", "reason": "not in profile network"},
+				{"name": "Slabinfo", "outcome": "failed", "error": "exit status 1\n"}
+			]}`
+
+			Expect(section("Memory").Unavailable).To(Equal("not collected in the new report, the collector was skipped: not in profile network"))
+			Expect(section("Slab caches").Unavailable).To(Equal("not collected in the old report"))
+		})
+	})
+
+	Describe("the output", func() {
+		BeforeEach(func() {
+			old["num-open-files.log"] = "12000\n"
+			new["num-open-files.log"] = "15000\n"
+			old["garden-containers.log"] = `{"handles":["a"]}`
+			new["garden-containers.log"] = `{"handles":["a"]}`
+		})
+
+		It("is human readable", func() {
+			var buffer bytes.Buffer
+			Expect(compare().WriteText(&buffer)).To(Succeed())
+
+			text := buffer.String()
+			Expect(text).To(HavePrefix("Comparing old-report (2026-10-01T10:00:00Z) to new-report (2026-10-01T12:30:00Z), 2h30m0s later\n"))
+			Expect(text).To(ContainSubstring("\n## Open files (Number of Open Files)\n  open files: 12000 -> 15000 (+3000)\n"))
+			Expect(text).To(ContainSubstring("\n## Containers (Garden Containers)\n  no changes\n"))
+			Expect(text).To(ContainSubstring("\n## Memory (Meminfo)\n  not collected in the old report\n"))
+		})
+
+		It("can be encoded as JSON", func() {
+			encoded, err := json.Marshal(compare())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(encoded).To(ContainSubstring(`"old":{"name":"old-report","start_time":"2026-10-01T10:00:00Z"}`))
+			Expect(encoded).To(ContainSubstring(`{"name":"Open files","collector":"Number of Open Files","changes":[{"key":"open files","old":12000,"new":15000}]}`))
+		})
+	})
+})
@@ -0,0 +1,80 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxLines caps the number of entries listed per section in the text
+// output.
+const maxLines = 20
+
+// WriteText writes the differences in a human readable form.
+func (d Diff) WriteText(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "Comparing %s to %s%s\n", describe(d.Old), describe(d.New), elapsed(d))
+	if err != nil {
+		return err
+	}
+
+	for _, section := range d.Sections {
+		fmt.Fprintf(w, "\n## %s (%s)\n", section.Name, section.Collector)
+
+		switch {
+		case section.Unavailable != "":
+			fmt.Fprintf(w, "  %s\n", section.Unavailable)
+			continue
+		case !section.Changed():
+			fmt.Fprintln(w, "  no changes")
+			continue
+		}
+
+		writeList(w, "+", section.Added)
+		writeList(w, "-", section.Removed)
+
+		for i, change := range section.Changes {
+			if i == maxLines {
+				fmt.Fprintf(w, "  ... and %d more\n", len(section.Changes)-maxLines)
+				break
+			}
+			fmt.Fprintf(w, "  %s: %s -> %s (%+d%s)\n", change.Key, withUnit(change.Old, change.Unit), withUnit(change.New, change.Unit), change.Delta(), unitSuffix(change.Unit))
+		}
+	}
+
+	return nil
+}
+
+func writeList(w io.Writer, marker string, entries []string) {
+	for i, entry := range entries {
+		if i == maxLines {
+			fmt.Fprintf(w, "  ... and %d more\n", len(entries)-maxLines)
+			return
+		}
+		fmt.Fprintf(w, "  %s %s\n", marker, entry)
+	}
+}
+
+func describe(side Side) string {
+	if side.StartTime.IsZero() {
+		return side.Name
+	}
+	return fmt.Sprintf("%s (%s)", side.Name, side.StartTime.UTC().Format(time.RFC3339))
+}
+
+func elapsed(d Diff) string {
+	if d.Old.StartTime.IsZero() || d.New.StartTime.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(", %s later", d.New.StartTime.Sub(d.Old.StartTime).Round(time.Second))
+}
+
+func withUnit(value int64, unit string) string {
+	return fmt.Sprintf("%d%s", value, unitSuffix(unit))
+}
+
+func unitSuffix(unit string) string {
+	if unit == "" {
+		return ""
+	}
+	return " " + unit
+}
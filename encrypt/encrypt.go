@@ -0,0 +1,255 @@
+// Package encrypt encrypts report archives to a recipient's X25519 public
+// key, so that only the holder of the private key can read them.
+//
+// An encrypted archive starts with a magic string and a single-use X25519
+// public key. The key agreed between it and the recipient's key is
+// stretched with HKDF-SHA256 into an AES-256-GCM key, which seals the
+// archive in chunks of 64KiB. Each chunk's nonce holds its index and
+// whether it is the last one, so that chunks cannot be reordered, dropped
+// or the archive truncated without detection.
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"code.cloudfoundry.org/dontpanic/keyfile"
+)
+
+// Extension is appended to the name of encrypted archives.
+const Extension = ".enc"
+
+const (
+	magic     = "dontpanic-encrypted-v1\n"
+	chunkSize = 64 << 10
+	info      = "dontpanic report encryption"
+)
+
+var (
+	ErrNotEncrypted = errors.New("not an encrypted dontpanic report")
+	errClosed       = errors.New("encrypted archive already closed")
+)
+
+// LoadPublicKey reads a PEM encoded X25519 public key, as written by
+// `openssl pkey -pubout`.
+func LoadPublicKey(path string) (*ecdh.PublicKey, error) {
+	key, err := keyfile.LoadPublicKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(*ecdh.PublicKey)
+	if !ok || publicKey.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("public key %s is not an X25519 key", path)
+	}
+
+	return publicKey, nil
+}
+
+// LoadPrivateKey reads a PEM encoded X25519 private key, as written by
+// `openssl genpkey -algorithm X25519`.
+func LoadPrivateKey(path string) (*ecdh.PrivateKey, error) {
+	key, err := keyfile.LoadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(*ecdh.PrivateKey)
+	if !ok || privateKey.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("private key %s is not an X25519 key", path)
+	}
+
+	return privateKey, nil
+}
+
+// NewWriter returns a writer that encrypts everything written to it to the
+// recipient and passes it on to w. Close must be called to complete the
+// encrypted archive, it does not close w.
+func NewWriter(w io.Writer, recipient *ecdh.PublicKey) (io.WriteCloser, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(ephemeral, recipient, ephemeral.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(magic), ephemeral.PublicKey().Bytes()...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &writer{out: w, aead: aead, buffer: make([]byte, 0, chunkSize)}, nil
+}
+
+// NewReader returns a reader that decrypts an archive encrypted to the
+// given private key. Reading fails if the archive was tampered with or is
+// incomplete.
+func NewReader(r io.Reader, key *ecdh.PrivateKey) (io.Reader, error) {
+	header := make([]byte, len(magic)+32)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(header[len(magic):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted report header: %w", err)
+	}
+
+	aead, err := newAEAD(key, ephemeral, ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reader{in: r, aead: aead, chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+// newAEAD derives the archive key from the key agreed between local and
+// remote. Both ends bind it to the ephemeral public key.
+func newAEAD(local *ecdh.PrivateKey, remote, ephemeral *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := local.ECDH(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hkdf.Key(sha256.New, shared, ephemeral.Bytes(), info, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func nonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce, index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+type writer struct {
+	out    io.Writer
+	aead   cipher.AEAD
+	buffer []byte
+	index  uint64
+	err    error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, as the last
+		// chunk must be sealed differently
+		if len(w.buffer) == chunkSize {
+			if w.err = w.seal(false); w.err != nil {
+				return written, w.err
+			}
+		}
+
+		n := copy(w.buffer[len(w.buffer):chunkSize], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals the last chunk. The last chunk is always shorter than a full
+// one, even if it has to be empty.
+func (w *writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if len(w.buffer) == chunkSize {
+		if w.err = w.seal(false); w.err != nil {
+			return w.err
+		}
+	}
+
+	if w.err = w.seal(true); w.err != nil {
+		return w.err
+	}
+
+	w.err = errClosed
+	return nil
+}
+
+func (w *writer) seal(last bool) error {
+	sealed := w.aead.Seal(nil, nonce(w.index, last), w.buffer, nil)
+	w.index++
+	w.buffer = w.buffer[:0]
+	_, err := w.out.Write(sealed)
+	return err
+}
+
+type reader struct {
+	in    io.Reader
+	aead  cipher.AEAD
+	chunk []byte
+	plain []byte
+	index uint64
+	done  bool
+	err   error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk. Only the last chunk is shorter than a full
+// one, so a short read marks the end of the archive.
+func (r *reader) open() error {
+	n, err := io.ReadFull(r.in, r.chunk)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	}
+
+	plain, err := r.aead.Open(r.chunk[:0], nonce(r.index, last), r.chunk[:n], nil)
+	if err != nil {
+		return errors.New("encrypted report is corrupt, truncated or not encrypted to this key")
+	}
+
+	r.index++
+	r.plain = plain
+	r.done = last
+	return nil
+}
@@ -0,0 +1,156 @@
+package encrypt_test
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/encrypt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encryption", func() {
+	var (
+		privateKey *ecdh.PrivateKey
+		plaintext  []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		privateKey, err = ecdh.X25519().GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		plaintext = make([]byte, 200<<10)
+		_, err = rand.Read(plaintext)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	encryptTo := func(recipient *ecdh.PublicKey, plaintext []byte) []byte {
+		var ciphertext bytes.Buffer
+		writer, err := encrypt.NewWriter(&ciphertext, recipient)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = writer.Write(plaintext)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		return ciphertext.Bytes()
+	}
+
+	decrypt := func(key *ecdh.PrivateKey, ciphertext []byte) ([]byte, error) {
+		reader, err := encrypt.NewReader(bytes.NewReader(ciphertext), key)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(reader)
+	}
+
+	It("round trips", func() {
+		ciphertext := encryptTo(privateKey.PublicKey(), plaintext)
+		Expect(ciphertext).NotTo(ContainSubstring(string(plaintext[:64])))
+
+		decrypted, err := decrypt(privateKey, ciphertext)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decrypted).To(Equal(plaintext))
+	})
+
+	DescribeTable("round trips at chunk boundaries",
+		func(size int) {
+			decrypted, err := decrypt(privateKey, encryptTo(privateKey.PublicKey(), plaintext[:size]))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decrypted).To(HaveLen(size))
+			Expect(decrypted).To(Equal(plaintext[:size]))
+		},
+		Entry("empty", 0),
+		Entry("one full chunk", 64<<10),
+		Entry("just over a chunk", 64<<10+1),
+		Entry("two full chunks", 128<<10),
+	)
+
+	It("uses a fresh key for every archive", func() {
+		Expect(encryptTo(privateKey.PublicKey(), plaintext)).NotTo(Equal(encryptTo(privateKey.PublicKey(), plaintext)))
+	})
+
+	It("cannot be decrypted with another key", func() {
+		otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = decrypt(otherKey, encryptTo(privateKey.PublicKey(), plaintext))
+		Expect(err).To(MatchError(ContainSubstring("not encrypted to this key")))
+	})
+
+	It("detects truncated archives", func() {
+		ciphertext := encryptTo(privateKey.PublicKey(), plaintext)
+		_, err := decrypt(privateKey, ciphertext[:len(ciphertext)-100])
+		Expect(err).To(MatchError(ContainSubstring("truncated")))
+	})
+
+	It("detects archives cut at a chunk boundary", func() {
+		ciphertext := encryptTo(privateKey.PublicKey(), plaintext)
+		headerSize := len(ciphertext) - len(plaintext) - 4*16
+		_, err := decrypt(privateKey, ciphertext[:headerSize+(64<<10+16)])
+		Expect(err).To(MatchError(ContainSubstring("truncated")))
+	})
+
+	It("detects tampering", func() {
+		ciphertext := encryptTo(privateKey.PublicKey(), plaintext)
+		ciphertext[len(ciphertext)/2] ^= 1
+		_, err := decrypt(privateKey, ciphertext)
+		Expect(err).To(MatchError(ContainSubstring("corrupt")))
+	})
+
+	It("rejects files that are not encrypted reports", func() {
+		_, err := decrypt(privateKey, []byte("\x1f\x8b plain old tarball, long enough for a header"))
+		Expect(err).To(MatchError(encrypt.ErrNotEncrypted))
+	})
+
+	Describe("loading keys", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			tmpDir = GinkgoT().TempDir()
+		})
+
+		writePEM := func(name, blockType string, der []byte) string {
+			path := filepath.Join(tmpDir, name)
+			Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)).To(Succeed())
+			return path
+		}
+
+		It("loads X25519 key pairs", func() {
+			publicDER, err := x509.MarshalPKIXPublicKey(privateKey.PublicKey())
+			Expect(err).NotTo(HaveOccurred())
+			privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			publicKey, err := encrypt.LoadPublicKey(writePEM("key.pub", "PUBLIC KEY", publicDER))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(publicKey.Equal(privateKey.PublicKey())).To(BeTrue())
+
+			loadedKey, err := encrypt.LoadPrivateKey(writePEM("key", "PRIVATE KEY", privateDER))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loadedKey.Equal(privateKey)).To(BeTrue())
+		})
+
+		It("rejects other kinds of keys", func() {
+			ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = encrypt.LoadPublicKey(writePEM("ecdsa.pub", "PUBLIC KEY", der))
+			Expect(err).To(MatchError(ContainSubstring("is not an X25519 key")))
+		})
+
+		It("rejects files without the expected PEM block", func() {
+			_, err := encrypt.LoadPrivateKey(writePEM("key.pub", "PUBLIC KEY", []byte("x")))
+			Expect(err).To(MatchError(ContainSubstring("does not contain a PEM encoded PRIVATE KEY")))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/logrusorgru/aurora"
+	"golang.org/x/sys/unix"
+)
+
+// interruptible returns a context cancelled on the first SIGINT or SIGTERM,
+// so that the report is created from what was collected so far, and a
+// function returning the signal received, if any. The process exits
+// immediately on the second signal.
+func interruptible(progress io.Writer) (context.Context, func() (syscall.Signal, bool)) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	received := make(chan syscall.Signal, 1)
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := (<-signals).(syscall.Signal)
+		received <- sig
+		fmt.Fprintln(progress, aurora.Yellow(fmt.Sprintf("Received %s, creating the report from what was collected so far, send it again to abort", unix.SignalName(sig))).Bold())
+		cancel(fmt.Errorf("interrupted by %s", unix.SignalName(sig)))
+
+		sig = (<-signals).(syscall.Signal)
+		fmt.Fprintln(os.Stderr, aurora.Red(fmt.Sprintf("Received %s again, aborting", unix.SignalName(sig))).Bold())
+		os.Exit(128 + int(sig))
+	}()
+
+	return ctx, func() (syscall.Signal, bool) {
+		select {
+		case sig := <-received:
+			return sig, true
+		default:
+			return 0, false
+		}
+	}
+}
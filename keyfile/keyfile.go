@@ -0,0 +1,54 @@
+// Package keyfile reads the PEM encoded keys used to encrypt and sign
+// reports.
+package keyfile
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// LoadPublicKey reads a PEM encoded PKIX public key, as written by
+// `openssl pkey -pubout`.
+func LoadPublicKey(path string) (any, error) {
+	block, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #8 private key, as written by
+// `openssl genpkey`.
+func LoadPrivateKey(path string) (any, error) {
+	block, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func readPEM(path, blockType string) (*pem.Block, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s does not contain a PEM encoded %s", path, blockType)
+	}
+
+	return block, nil
+}
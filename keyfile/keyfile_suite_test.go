@@ -0,0 +1,13 @@
+package keyfile_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestKeyfile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Keyfile Suite")
+}
@@ -0,0 +1,72 @@
+package keyfile_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/keyfile"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Key files", func() {
+	var (
+		dir        string
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+	)
+
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)).To(Succeed())
+		return path
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+
+		var err error
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("loads public keys", func() {
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		key, err := keyfile.LoadPublicKey(writePEM("public.pem", "PUBLIC KEY", der))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(publicKey))
+	})
+
+	It("loads private keys", func() {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		key, err := keyfile.LoadPrivateKey(writePEM("private.pem", "PRIVATE KEY", der))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(Equal(privateKey))
+	})
+
+	It("rejects files holding another kind of key", func() {
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = keyfile.LoadPublicKey(writePEM("private.pem", "PRIVATE KEY", der))
+		Expect(err).To(MatchError(ContainSubstring("does not contain a PEM encoded PUBLIC KEY")))
+	})
+
+	It("rejects keys that cannot be parsed", func() {
+		_, err := keyfile.LoadPrivateKey(writePEM("garbage.pem", "PRIVATE KEY", []byte("garbage")))
+		Expect(err).To(MatchError(ContainSubstring("failed to parse private key")))
+	})
+
+	It("fails when the file does not exist", func() {
+		_, err := keyfile.LoadPublicKey(filepath.Join(dir, "missing.pem"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/logrusorgru/aurora"
+
+	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/limits"
+)
+
+// cgroup is the cgroup the commands dontpanic runs are confined to, if their
+// resources are limited.
+var cgroup *limits.Cgroup
+
+// applyLimits lowers the priority of dontpanic, so that the commands it runs
+// inherit it, and confines those commands to a cgroup of their own as the
+// options say. It returns the limits applied, to record in reports.
+func applyLimits(opts Options) map[string]string {
+	priority := limits.Priority{Nice: opts.Nice, IOClass: opts.IOClass, IOPriority: opts.IOPriority}
+	resources := limits.Resources{CPUPercent: opts.CgroupCPU, MemoryMB: opts.CgroupMemory}
+	for _, err := range []error{priority.Validate(), resources.Validate()} {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	applied := map[string]string{"priority": priority.String()}
+
+	// A report created at full priority is still better than no report
+	if err := limits.SetPriority(priority); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Yellow("WARNING: cannot lower the priority of dontpanic: "+err.Error()).Bold())
+		applied["priority"] = "unchanged, " + err.Error()
+	}
+
+	if resources.Limited() {
+		var err error
+		cgroup, err = limits.CreateCgroup(limits.DefaultCgroupRoot, resources)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			os.Exit(1)
+		}
+		commandrunner.SetStart(cgroup.Start)
+		applied["cgroup"] = strings.Join(cgroup.Dirs(), ",")
+		applied["cgroup_limits"] = resources.String()
+	}
+
+	return applied
+}
+
+// removeCgroup removes the cgroup of the commands, if any, once they are
+// done.
+func removeCgroup() {
+	if cgroup == nil {
+		return
+	}
+
+	if err := cgroup.Remove(); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Yellow("WARNING: "+err.Error()).Bold())
+	}
+	cgroup = nil
+}
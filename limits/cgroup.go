@@ -0,0 +1,255 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DefaultCgroupRoot is where the cgroup filesystem is mounted.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// cgroupPrefix is the name of the cgroup the commands of a dontpanic run are
+// confined to, followed by the PID of the run. Each run has its own, so that
+// concurrent runs do not change each other's limits.
+const cgroupPrefix = "dontpanic-"
+
+// cpuPeriod is the period of the CPU quota, in microseconds.
+const cpuPeriod = 100000
+
+// Resources are the limits of the cgroup to run in. Zero means no limit.
+type Resources struct {
+	// CPUPercent is the share of one CPU, e.g. 50 for half a CPU or 200 for
+	// two CPUs.
+	CPUPercent int
+	MemoryMB   int
+}
+
+func (r Resources) Limited() bool {
+	return r.CPUPercent > 0 || r.MemoryMB > 0
+}
+
+func (r Resources) Validate() error {
+	if r.CPUPercent < 0 || r.MemoryMB < 0 {
+		return errors.New("cgroup limits cannot be negative")
+	}
+	return nil
+}
+
+// String describes the limits, to record in reports.
+func (r Resources) String() string {
+	var limits []string
+	if r.CPUPercent > 0 {
+		limits = append(limits, fmt.Sprintf("cpu %d%%", r.CPUPercent))
+	}
+	if r.MemoryMB > 0 {
+		limits = append(limits, fmt.Sprintf("memory %dMB", r.MemoryMB))
+	}
+	if len(limits) == 0 {
+		return "none"
+	}
+	return strings.Join(limits, ", ")
+}
+
+func (r Resources) cpuQuota() int {
+	return r.CPUPercent * cpuPeriod / 100
+}
+
+func (r Resources) memoryBytes() int64 {
+	return int64(r.MemoryMB) << 20
+}
+
+// Cgroup is the cgroup of a dontpanic run. Only the commands it runs are put
+// in it, so that dontpanic itself, which creates the archive, is not
+// limited.
+type Cgroup struct {
+	dirs []string
+	// dir is the cgroup v2 directory, open to start the commands in it. It
+	// is nil with cgroup v1.
+	dir *os.File
+}
+
+// CreateCgroup creates the cgroup of the current run and limits its
+// resources, first removing the cgroups left behind by earlier runs that
+// are gone. Both cgroup v2 and v1, with the cpu and memory controllers
+// mounted under the root, are supported.
+func CreateCgroup(root string, resources Resources) (*Cgroup, error) {
+	if err := resources.Validate(); err != nil {
+		return nil, err
+	}
+
+	name := cgroupPrefix + strconv.Itoa(os.Getpid())
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		removeStale(root)
+		return createV2(filepath.Join(root, name), resources)
+	}
+
+	removeStale(filepath.Join(root, "cpu"))
+	removeStale(filepath.Join(root, "memory"))
+	return createV1(root, name, resources)
+}
+
+func createV2(dir string, resources Resources) (*Cgroup, error) {
+	// The controllers must be enabled for the children of the root
+	root := filepath.Dir(dir)
+	if resources.CPUPercent > 0 {
+		if err := writeFile(filepath.Join(root, "cgroup.subtree_control"), "+cpu"); err != nil {
+			return nil, err
+		}
+	}
+	if resources.MemoryMB > 0 {
+		if err := writeFile(filepath.Join(root, "cgroup.subtree_control"), "+memory"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// The cgroup may have been left behind by an earlier run with the same
+	// PID, so the limits not set are lifted
+	cpuMax := fmt.Sprintf("max %d", cpuPeriod)
+	if resources.CPUPercent > 0 {
+		cpuMax = fmt.Sprintf("%d %d", resources.cpuQuota(), cpuPeriod)
+	}
+	if err := setLimit(filepath.Join(dir, "cpu.max"), cpuMax, resources.CPUPercent > 0); err != nil {
+		return nil, err
+	}
+
+	memoryMax := "max"
+	if resources.MemoryMB > 0 {
+		memoryMax = strconv.FormatInt(resources.memoryBytes(), 10)
+	}
+	if err := setLimit(filepath.Join(dir, "memory.max"), memoryMax, resources.MemoryMB > 0); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set up cgroup: %w", err)
+	}
+	return &Cgroup{dirs: []string{dir}, dir: file}, nil
+}
+
+func createV1(root, name string, resources Resources) (*Cgroup, error) {
+	cgroup := &Cgroup{}
+
+	if resources.CPUPercent > 0 {
+		dir := filepath.Join(root, "cpu", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		cgroup.dirs = append(cgroup.dirs, dir)
+		if err := writeFile(filepath.Join(dir, "cpu.cfs_period_us"), strconv.Itoa(cpuPeriod)); err != nil {
+			return nil, err
+		}
+		if err := writeFile(filepath.Join(dir, "cpu.cfs_quota_us"), strconv.Itoa(resources.cpuQuota())); err != nil {
+			return nil, err
+		}
+	}
+
+	if resources.MemoryMB > 0 {
+		dir := filepath.Join(root, "memory", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		cgroup.dirs = append(cgroup.dirs, dir)
+		if err := writeFile(filepath.Join(dir, "memory.limit_in_bytes"), strconv.FormatInt(resources.memoryBytes(), 10)); err != nil {
+			return nil, err
+		}
+	}
+
+	return cgroup, nil
+}
+
+// Dirs returns the directories of the cgroup.
+func (c *Cgroup) Dirs() []string {
+	return c.dirs
+}
+
+// Start starts the command in the cgroup. With cgroup v1 the command is
+// moved into it once started, so that the processes it starts before that
+// are not confined.
+func (c *Cgroup) Start(cmd *exec.Cmd) error {
+	if c.dir != nil {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+		return cmd.Start()
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	for _, dir := range c.dirs {
+		if err := writeFile(filepath.Join(dir, "cgroup.procs"), strconv.Itoa(cmd.Process.Pid)); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the cgroup, which only succeeds once the processes of the
+// commands run in it have exited.
+func (c *Cgroup) Remove() error {
+	if c.dir != nil {
+		c.dir.Close()
+	}
+
+	var errs []error
+	for _, dir := range c.dirs {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("cannot remove cgroup: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeStale removes the cgroups under the parent left behind by runs
+// whose process is gone. Those still in use cannot be removed and are kept.
+func removeStale(parent string) {
+	dirs, _ := filepath.Glob(filepath.Join(parent, cgroupPrefix+"*"))
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), cgroupPrefix))
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid))); os.IsNotExist(err) {
+			os.Remove(dir)
+		}
+	}
+}
+
+// setLimit writes the limit to the control file. The file only exists when
+// its controller is enabled, so it only has to when a limit is set.
+func setLimit(path, value string, required bool) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) && !required {
+		return nil
+	}
+	return writeFile(path, value)
+}
+
+// writeFile writes to an existing cgroup control file, without truncating
+// or creating it.
+func writeFile(path, value string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cannot set up cgroup: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(value); err != nil {
+		return fmt.Errorf("cannot write %q to %s: %w", value, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package limits lowers the CPU and IO priority of dontpanic, which the
+// commands it runs inherit, and confines those commands to a cgroup, so that
+// creating a report does not make an overloaded cell worse.
+package limits
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	IOClassNone       = "none"
+	IOClassIdle       = "idle"
+	IOClassBestEffort = "best-effort"
+)
+
+const (
+	ioprioWhoProcess    = 1
+	ioprioClassShift    = 13
+	ioprioClassBE       = 2
+	ioprioClassIdle     = 3
+	maxNice             = 19
+	maxBestEffortIOPrio = 7
+)
+
+// Priority is the niceness and IO scheduling class to run with. A nice of
+// zero and the none IO class leave the priority unchanged.
+type Priority struct {
+	Nice       int
+	IOClass    string
+	IOPriority int
+}
+
+func (p Priority) Validate() error {
+	if p.Nice < 0 || p.Nice > maxNice {
+		return fmt.Errorf("the nice value must be between 0 and %d", maxNice)
+	}
+
+	switch p.IOClass {
+	case IOClassNone, IOClassIdle:
+	case IOClassBestEffort:
+		if p.IOPriority < 0 || p.IOPriority > maxBestEffortIOPrio {
+			return fmt.Errorf("the best-effort IO priority must be between 0 and %d", maxBestEffortIOPrio)
+		}
+	default:
+		return fmt.Errorf("unknown IO class %q", p.IOClass)
+	}
+
+	return nil
+}
+
+// String describes the priority, to record in reports.
+func (p Priority) String() string {
+	description := "nice " + strconv.Itoa(p.Nice)
+	switch p.IOClass {
+	case IOClassIdle:
+		description += ", idle IO"
+	case IOClassBestEffort:
+		description += fmt.Sprintf(", best-effort IO priority %d", p.IOPriority)
+	}
+	return description
+}
+
+// SetPriority applies the priority to every thread of the current process,
+// as Linux keeps both per thread. Threads and processes started afterwards
+// inherit it.
+func SetPriority(priority Priority) error {
+	if err := priority.Validate(); err != nil {
+		return err
+	}
+
+	ioprio := 0
+	switch priority.IOClass {
+	case IOClassIdle:
+		ioprio = ioprioClassIdle << ioprioClassShift
+	case IOClassBestEffort:
+		ioprio = ioprioClassBE<<ioprioClassShift | priority.IOPriority
+	}
+
+	// Threads started while going through them are caught by going through
+	// them again, until there are no new ones
+	done := map[int]bool{}
+	for {
+		tids, err := threads()
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		for _, tid := range tids {
+			if done[tid] {
+				continue
+			}
+			if err := setThreadPriority(tid, priority.Nice, ioprio); err != nil {
+				return err
+			}
+			done[tid] = true
+			changed = true
+		}
+
+		if !changed {
+			return nil
+		}
+	}
+}
+
+func setThreadPriority(tid, nice, ioprio int) error {
+	if nice != 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, nice); err != nil {
+			return fmt.Errorf("cannot set the nice value: %w", err)
+		}
+	}
+
+	if ioprio != 0 {
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio)); errno != 0 {
+			return fmt.Errorf("cannot set the IO priority: %w", errno)
+		}
+	}
+
+	return nil
+}
+
+func threads() ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(os.Getpid()), "task"))
+	if err != nil {
+		return nil, err
+	}
+
+	var tids []int
+	for _, entry := range entries {
+		if tid, err := strconv.Atoi(entry.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
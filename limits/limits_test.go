@@ -0,0 +1,178 @@
+package limits_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/limits"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limits", func() {
+	Describe("SetPriority", func() {
+		It("lowers the priority of the commands started afterwards", func() {
+			Expect(limits.SetPriority(limits.Priority{Nice: 5, IOClass: limits.IOClassBestEffort, IOPriority: 6})).To(Succeed())
+
+			stat, err := exec.Command("cat", "/proc/self/stat").Output()
+			Expect(err).NotTo(HaveOccurred())
+			fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+			Expect(fields[16]).To(Equal("5"))
+		})
+
+		It("rejects invalid priorities", func() {
+			Expect(limits.SetPriority(limits.Priority{Nice: 20, IOClass: limits.IOClassNone})).To(MatchError(ContainSubstring("between 0 and 19")))
+			Expect(limits.SetPriority(limits.Priority{IOClass: limits.IOClassBestEffort, IOPriority: 8})).To(MatchError(ContainSubstring("between 0 and 7")))
+			Expect(limits.SetPriority(limits.Priority{IOClass: "realtime"})).To(MatchError(ContainSubstring(`unknown IO class "realtime"`)))
+		})
+
+		It("describes the priority", func() {
+			Expect(limits.Priority{Nice: 10, IOClass: limits.IOClassBestEffort, IOPriority: 7}.String()).To(Equal("nice 10, best-effort IO priority 7"))
+			Expect(limits.Priority{Nice: 19, IOClass: limits.IOClassIdle}.String()).To(Equal("nice 19, idle IO"))
+			Expect(limits.Priority{IOClass: limits.IOClassNone}.String()).To(Equal("nice 0"))
+		})
+	})
+
+	Describe("CreateCgroup", func() {
+		var (
+			root string
+			name string
+		)
+
+		// The cgroup filesystem creates the control files of new cgroups,
+		// here they have to be created upfront
+		createFiles := func(paths ...string) {
+			for _, path := range paths {
+				Expect(os.MkdirAll(filepath.Dir(filepath.Join(root, path)), 0755)).To(Succeed())
+				Expect(os.WriteFile(filepath.Join(root, path), nil, 0644)).To(Succeed())
+			}
+		}
+
+		contents := func(path string) string {
+			contents, err := os.ReadFile(filepath.Join(root, path))
+			Expect(err).NotTo(HaveOccurred())
+			return string(contents)
+		}
+
+		// removeFiles removes the control files of a cgroup, as the cgroup
+		// filesystem does when it is removed
+		removeFiles := func(dir string) {
+			entries, err := os.ReadDir(filepath.Join(root, dir))
+			Expect(err).NotTo(HaveOccurred())
+			for _, entry := range entries {
+				Expect(os.Remove(filepath.Join(root, dir, entry.Name()))).To(Succeed())
+			}
+		}
+
+		BeforeEach(func() {
+			root = GinkgoT().TempDir()
+			name = "dontpanic-" + strconv.Itoa(os.Getpid())
+		})
+
+		When("cgroup v2 is mounted", func() {
+			BeforeEach(func() {
+				createFiles("cgroup.controllers", "cgroup.subtree_control", name+"/cgroup.procs", name+"/cpu.max", name+"/memory.max")
+			})
+
+			It("creates a cgroup for the run with the resources limited", func() {
+				cgroup, err := limits.CreateCgroup(root, limits.Resources{CPUPercent: 50, MemoryMB: 512})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cgroup.Dirs()).To(Equal([]string{filepath.Join(root, name)}))
+
+				Expect(contents(name + "/cpu.max")).To(Equal("50000 100000"))
+				Expect(contents(name + "/memory.max")).To(Equal("536870912"))
+			})
+
+			It("does not put dontpanic in it", func() {
+				_, err := limits.CreateCgroup(root, limits.Resources{CPUPercent: 50})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents(name + "/cgroup.procs")).To(BeEmpty())
+			})
+
+			It("lifts the limits that are not set", func() {
+				_, err := limits.CreateCgroup(root, limits.Resources{MemoryMB: 512})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents(name + "/cpu.max")).To(Equal("max 100000"))
+			})
+
+			It("removes the cgroups of the runs that are gone", func() {
+				Expect(os.Mkdir(filepath.Join(root, "dontpanic-999999999"), 0755)).To(Succeed())
+				Expect(os.Mkdir(filepath.Join(root, "dontpanic-1"), 0755)).To(Succeed())
+
+				_, err := limits.CreateCgroup(root, limits.Resources{MemoryMB: 512})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(filepath.Join(root, "dontpanic-999999999")).NotTo(BeADirectory())
+				Expect(filepath.Join(root, "dontpanic-1")).To(BeADirectory())
+			})
+
+			It("removes the cgroup", func() {
+				cgroup, err := limits.CreateCgroup(root, limits.Resources{MemoryMB: 512})
+				Expect(err).NotTo(HaveOccurred())
+
+				removeFiles(name)
+				Expect(cgroup.Remove()).To(Succeed())
+				Expect(filepath.Join(root, name)).NotTo(BeADirectory())
+			})
+		})
+
+		When("cgroup v1 is mounted", func() {
+			BeforeEach(func() {
+				createFiles(
+					"cpu/"+name+"/cgroup.procs", "cpu/"+name+"/cpu.cfs_period_us", "cpu/"+name+"/cpu.cfs_quota_us",
+					"memory/"+name+"/cgroup.procs", "memory/"+name+"/memory.limit_in_bytes",
+				)
+			})
+
+			It("creates a cgroup for the run in the limited controllers", func() {
+				cgroup, err := limits.CreateCgroup(root, limits.Resources{CPUPercent: 150})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cgroup.Dirs()).To(Equal([]string{filepath.Join(root, "cpu", name)}))
+
+				Expect(contents("cpu/" + name + "/cpu.cfs_period_us")).To(Equal("100000"))
+				Expect(contents("cpu/" + name + "/cpu.cfs_quota_us")).To(Equal("150000"))
+			})
+
+			It("moves only the commands started into it", func() {
+				cgroup, err := limits.CreateCgroup(root, limits.Resources{CPUPercent: 150})
+				Expect(err).NotTo(HaveOccurred())
+
+				cmd := exec.Command("true")
+				Expect(cgroup.Start(cmd)).To(Succeed())
+				Expect(cmd.Wait()).To(Succeed())
+
+				Expect(contents("cpu/" + name + "/cgroup.procs")).To(Equal(strconv.Itoa(cmd.Process.Pid)))
+				Expect(contents("memory/" + name + "/cgroup.procs")).To(BeEmpty())
+			})
+
+			It("removes the cgroup", func() {
+				cgroup, err := limits.CreateCgroup(root, limits.Resources{CPUPercent: 150, MemoryMB: 512})
+				Expect(err).NotTo(HaveOccurred())
+
+				removeFiles("cpu/" + name)
+				removeFiles("memory/" + name)
+				Expect(cgroup.Remove()).To(Succeed())
+				Expect(filepath.Join(root, "cpu", name)).NotTo(BeADirectory())
+				Expect(filepath.Join(root, "memory", name)).NotTo(BeADirectory())
+			})
+
+			It("fails to remove the cgroup while it is in use", func() {
+				cgroup, err := limits.CreateCgroup(root, limits.Resources{CPUPercent: 150})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cgroup.Remove()).To(MatchError(ContainSubstring("cannot remove cgroup")))
+			})
+		})
+
+		It("fails when the cgroup cannot be set up", func() {
+			_, err := limits.CreateCgroup(root, limits.Resources{MemoryMB: 512})
+			Expect(err).To(MatchError(ContainSubstring("cannot set up cgroup")))
+		})
+
+		It("describes the resources", func() {
+			Expect(limits.Resources{CPUPercent: 50, MemoryMB: 512}.String()).To(Equal("cpu 50%, memory 512MB"))
+			Expect(limits.Resources{}.String()).To(Equal("none"))
+		})
+	})
+})
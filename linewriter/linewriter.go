@@ -0,0 +1,190 @@
+// Package linewriter passes text on a line at a time, so that line based
+// rewriting, such as redaction and anonymization, never sees half a line.
+package linewriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// MaxLineLength bounds how much of a line without a newline is buffered
+// before it is rewritten on its own.
+const MaxLineLength = 1 << 20
+
+// sniffLength is how much of the start of the content is looked at to tell
+// whether it is binary.
+const sniffLength = 8192
+
+// gzipMagic starts gzip compressed content.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// DroppedMarker replaces binary content dropped by writers that drop it.
+const DroppedMarker = "[dontpanic: binary content dropped]\n"
+
+// Writer rewrites every line written to it, including its newline, with a
+// function before passing it on. Output is held back until a line is
+// complete or the writer is closed. Gzip compressed content is rewritten
+// decompressed and compressed again. Other content that looks binary is
+// passed through untouched, or dropped.
+type Writer struct {
+	out        io.WriteCloser
+	rewrite    func(line []byte) []byte
+	dropBinary bool
+	pending    []byte
+	sniffed    bool
+	binary     bool
+	// compressed is where gzip compressed content is written, to be
+	// rewritten by the goroutine sending its result to rewritten.
+	compressed *io.PipeWriter
+	rewritten  chan gzipResult
+	err        error
+}
+
+type gzipResult struct {
+	binary bool
+	err    error
+}
+
+func New(w io.WriteCloser, rewrite func(line []byte) []byte) *Writer {
+	return &Writer{out: w, rewrite: rewrite}
+}
+
+// DropBinary makes the writer replace content that looks binary with
+// DroppedMarker instead of passing it through. It must be called before
+// anything is written.
+func (w *Writer) DropBinary() {
+	w.dropBinary = true
+}
+
+// Binary returns whether the content looked binary, and so was not
+// rewritten. It is only final once the writer is closed.
+func (w *Writer) Binary() bool {
+	return w.binary
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if !w.sniffed && len(p) > 0 {
+		w.sniffed = true
+		if bytes.HasPrefix(p, gzipMagic) {
+			w.startGzip()
+		} else if bytes.IndexByte(p[:min(len(p), sniffLength)], 0) >= 0 {
+			w.binary = true
+			if w.dropBinary {
+				if _, w.err = io.WriteString(w.out, DroppedMarker); w.err != nil {
+					return 0, w.err
+				}
+			}
+		}
+	}
+
+	if w.compressed != nil {
+		if _, w.err = w.compressed.Write(p); w.err != nil {
+			return 0, w.err
+		}
+		return len(p), nil
+	}
+
+	if w.binary {
+		if w.dropBinary {
+			return len(p), nil
+		}
+		return w.out.Write(p)
+	}
+
+	w.pending = append(w.pending, p...)
+	for {
+		end := bytes.IndexByte(w.pending, '\n')
+		if end < 0 {
+			break
+		}
+		if w.err = w.writeLine(w.pending[:end+1]); w.err != nil {
+			return 0, w.err
+		}
+		w.pending = w.pending[end+1:]
+	}
+
+	if len(w.pending) > MaxLineLength {
+		if w.err = w.writeLine(w.pending); w.err != nil {
+			return 0, w.err
+		}
+		w.pending = nil
+	}
+
+	return len(p), nil
+}
+
+// startGzip has the content written from then on decompressed, rewritten by
+// a writer of its own and compressed again on its way to the output.
+func (w *Writer) startGzip() {
+	reader, writer := io.Pipe()
+	w.compressed = writer
+	w.rewritten = make(chan gzipResult, 1)
+
+	go func() {
+		result := w.rewriteGzip(reader)
+		// Writes must fail rather than block once nothing reads them
+		reader.CloseWithError(result.err)
+		w.rewritten <- result
+	}()
+}
+
+func (w *Writer) rewriteGzip(compressed io.Reader) gzipResult {
+	decompressed, err := gzip.NewReader(compressed)
+	if err != nil {
+		return gzipResult{err: err}
+	}
+
+	recompressed := gzip.NewWriter(w.out)
+	recompressed.Header = decompressed.Header
+	lines := New(nopCloser{recompressed}, w.rewrite)
+	lines.dropBinary = w.dropBinary
+
+	_, err = io.Copy(lines, decompressed)
+	if closeErr := lines.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := recompressed.Close(); err == nil {
+		err = closeErr
+	}
+	return gzipResult{binary: lines.Binary(), err: err}
+}
+
+// Close rewrites and writes any incomplete last line, then closes the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.compressed != nil {
+		w.compressed.Close()
+		result := <-w.rewritten
+		w.compressed = nil
+		w.binary = result.binary
+		if w.err == nil {
+			w.err = result.err
+		}
+	}
+
+	if w.err == nil && len(w.pending) > 0 {
+		w.err = w.writeLine(w.pending)
+		w.pending = nil
+	}
+
+	if err := w.out.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+func (w *Writer) writeLine(line []byte) error {
+	_, err := w.out.Write(w.rewrite(line))
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
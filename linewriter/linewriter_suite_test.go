@@ -0,0 +1,13 @@
+package linewriter_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestLinewriter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Linewriter Suite")
+}
@@ -0,0 +1,179 @@
+package linewriter_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/linewriter"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		out    *closeRecorder
+		lines  []string
+		writer *linewriter.Writer
+	)
+
+	BeforeEach(func() {
+		out = &closeRecorder{}
+		lines = nil
+		writer = linewriter.New(out, func(line []byte) []byte {
+			lines = append(lines, string(line))
+			return bytes.ToUpper(line)
+		})
+	})
+
+	It("rewrites complete lines only", func() {
+		_, err := io.WriteString(writer, "one\ntw")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.WriteString(writer, "o\nthree")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal("ONE\nTWO\n"))
+		Expect(lines).To(Equal([]string{"one\n", "two\n"}))
+	})
+
+	It("rewrites the incomplete last line when closed", func() {
+		_, err := io.WriteString(writer, "one\ntwo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		Expect(out.String()).To(Equal("ONE\nTWO"))
+		Expect(out.closed).To(BeTrue())
+	})
+
+	It("rewrites overlong lines on their own", func() {
+		_, err := io.WriteString(writer, strings.Repeat("a", linewriter.MaxLineLength+1))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lines).To(HaveLen(1))
+		Expect(out.Len()).To(Equal(linewriter.MaxLineLength + 1))
+	})
+
+	It("passes binary content through untouched", func() {
+		_, err := writer.Write([]byte("bin\x00ary\nstuff"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal("bin\x00ary\nstuff"))
+		Expect(lines).To(BeEmpty())
+	})
+
+	It("does not report text as binary", func() {
+		_, err := io.WriteString(writer, "text\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		Expect(writer.Binary()).To(BeFalse())
+	})
+
+	It("reports binary content", func() {
+		_, err := writer.Write([]byte("bin\x00ary"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		Expect(writer.Binary()).To(BeTrue())
+	})
+
+	When("binary content is dropped", func() {
+		BeforeEach(func() {
+			writer.DropBinary()
+		})
+
+		It("replaces it with a marker", func() {
+			_, err := writer.Write([]byte("bin\x00ary\n"))
+			Expect(err).NotTo(HaveOccurred())
+			_, err = writer.Write([]byte("stuff"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(out.String()).To(Equal(linewriter.DroppedMarker))
+			Expect(writer.Binary()).To(BeTrue())
+		})
+	})
+
+	When("the content is gzip compressed", func() {
+		It("rewrites the decompressed lines and compresses them again", func() {
+			compressed := gzipped("one\ntwo\nthree")
+			// Written in small pieces, as collectors copying files may
+			for len(compressed) > 0 {
+				n, err := writer.Write(compressed[:min(len(compressed), 7)])
+				Expect(err).NotTo(HaveOccurred())
+				compressed = compressed[n:]
+			}
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(gunzipped(out.Bytes())).To(Equal("ONE\nTWO\nTHREE"))
+			Expect(lines).To(Equal([]string{"one\n", "two\n", "three"}))
+			Expect(writer.Binary()).To(BeFalse())
+			Expect(out.closed).To(BeTrue())
+		})
+
+		It("reports compressed binary content", func() {
+			_, err := writer.Write(gzipped("bin\x00ary"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(gunzipped(out.Bytes())).To(Equal("bin\x00ary"))
+			Expect(writer.Binary()).To(BeTrue())
+		})
+
+		It("drops compressed binary content when told to", func() {
+			writer.DropBinary()
+			_, err := writer.Write(gzipped("bin\x00ary"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+
+			Expect(gunzipped(out.Bytes())).To(Equal(linewriter.DroppedMarker))
+		})
+
+		It("fails when it is corrupt", func() {
+			compressed := gzipped(strings.Repeat("line\n", 1000))
+			_, err := writer.Write(compressed[:len(compressed)/2])
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).To(MatchError(io.ErrUnexpectedEOF))
+		})
+	})
+
+	It("returns errors from the underlying writer", func() {
+		out.err = errors.New("disk full")
+		_, err := io.WriteString(writer, "line\n")
+		Expect(err).To(MatchError("disk full"))
+
+		_, err = io.WriteString(writer, "more\n")
+		Expect(err).To(MatchError("disk full"))
+	})
+})
+
+func gzipped(contents string) []byte {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := io.WriteString(writer, contents)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+	return compressed.Bytes()
+}
+
+func gunzipped(compressed []byte) string {
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	Expect(err).NotTo(HaveOccurred())
+	contents, err := io.ReadAll(reader)
+	Expect(err).NotTo(HaveOccurred())
+	return string(contents)
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+	err    error
+}
+
+func (c *closeRecorder) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Buffer.Write(p)
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
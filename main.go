@@ -2,23 +2,32 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/logrusorgru/aurora"
 
-	"code.cloudfoundry.org/dontpanic/collectors/command"
-	"code.cloudfoundry.org/dontpanic/collectors/file"
-	"code.cloudfoundry.org/dontpanic/collectors/grootfs"
-	"code.cloudfoundry.org/dontpanic/collectors/process"
-	"code.cloudfoundry.org/dontpanic/commandrunner"
+	"code.cloudfoundry.org/dontpanic/anonymize"
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	"code.cloudfoundry.org/dontpanic/encrypt"
 	"code.cloudfoundry.org/dontpanic/osreporter"
+	"code.cloudfoundry.org/dontpanic/outputdir"
+	"code.cloudfoundry.org/dontpanic/redact"
+	"code.cloudfoundry.org/dontpanic/report"
 	flags "github.com/jessevdk/go-flags"
+	"golang.org/x/sys/unix"
 )
 
+const gardenDepotDir = "/var/vcap/data/garden/depot"
+
 type Server struct {
 	LogLevel string `long:"log-level" default:"info"`
 }
@@ -27,75 +36,340 @@ type Config struct {
 	Server Server `command:"server"`
 }
 
+type Options struct {
+	SigQUIT      bool          `long:"sigquit" description:"Send a SIGQUIT to the gdn process"`
+	Parallelism  int           `long:"parallelism" default:"4" description:"Maximum number of collectors to run at the same time"`
+	Config       []string      `long:"config" description:"YAML file with collectors extending or overriding the defaults (can be repeated)"`
+	List         bool          `long:"list" description:"List the available collectors and profiles and exit"`
+	Profile      string        `long:"profile" default:"full" description:"Collection profile to run (quick, standard, full, network, disk, containers)"`
+	Include      []string      `long:"include" description:"Also run collectors matching this name or glob pattern that the profile leaves out (can be repeated)"`
+	Only         []string      `long:"only" description:"Only run collectors matching this name or glob pattern (can be repeated)"`
+	Skip         []string      `long:"skip" description:"Skip collectors matching this name or glob pattern (can be repeated)"`
+	OutputDir    string        `long:"output-dir" default:"/var/vcap/data/tmp" description:"Directory to write the report to"`
+	FallbackDir  []string      `long:"fallback-dir" default:"/tmp" default:"/var/vcap/store/tmp" description:"Directory to write the report to when the output directory is read-only or too full (can be repeated)"`
+	Output       string        `long:"output" description:"File to write the archive to instead of the output directory, or - to write it to stdout"`
+	Redact       []string      `long:"redact" description:"Also redact text matching this regular expression, or only its group named secret if it has one (can be repeated)"`
+	NoRedact     bool          `long:"no-redact" description:"Do not remove private keys, passwords and tokens from the report"`
+	Anonymize    bool          `long:"anonymize" description:"Replace IP addresses, the host name, container handles and GUIDs in the report with pseudonyms"`
+	MappingFile  string        `long:"anonymize-mapping" description:"File to keep the pseudonyms and the values they replace in, reused if it exists (defaults to a file next to the report)"`
+	EncryptTo    string        `long:"encrypt-to" description:"PEM encoded X25519 public key to encrypt the archive to, see the decrypt command"`
+	SignKey      string        `long:"sign-key" description:"PEM encoded ed25519 private key to sign the report checksums with, see the verify command"`
+	Stream       bool          `long:"stream" description:"Compress collector output into the archive as it is produced instead of staging the report in a directory (output over 1MiB is spooled uncompressed to <report>.spool until its collector finishes)"`
+	MaxDuration  time.Duration `long:"max-duration" description:"Cancel the collectors still running after this long and create the report from what was collected (no limit by default)"`
+	Nice         int           `long:"nice" default:"0" description:"Niceness to run the collectors with, from 0 (unchanged) to 19"`
+	IOClass      string        `long:"io-class" default:"none" description:"IO scheduling class to run the collectors with (none to leave it unchanged, idle, best-effort)"`
+	IOPriority   int           `long:"io-priority" default:"7" description:"Priority within the best-effort IO class, from 0 (highest) to 7 (lowest)"`
+	CgroupCPU    int           `long:"cgroup-cpu" description:"Run the collector commands in a cgroup of their own limited to this percentage of one CPU"`
+	CgroupMemory int           `long:"cgroup-memory" description:"Run the collector commands in a cgroup of their own limited to this many MB of memory"`
+}
+
 func main() {
-	var opts struct {
-		SigQUIT bool `long:"sigquit" description:"Send a SIGQUIT to the gdn process"`
+	var opts Options
+
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.SubcommandsOptional = true
+	parser.AddCommand("decrypt", "Decrypt an encrypted report", "Decrypt a report created with --encrypt-to, using the matching private key.", &DecryptCommand{})
+	parser.AddCommand("analyze", "Look for known problems in a report", "Look for the symptoms of known problems, such as full disks, OOM kills and hung tasks, in a report and list them most severe first.", &AnalyzeCommand{})
+	parser.AddCommand("diff", "Compare two reports from the same cell", "Compare two reports from the same cell, showing new and removed processes, containers and mounts, changes in open files, GrootFS, slab and memory usage and IP tables rules, and new kernel log lines.", &DiffCommand{})
+	parser.AddCommand("verify", "Check a report against its checksums", "Check that no file in a report was modified, removed or added since it was created, and optionally that its checksums were signed with the key matching --public-key.", &VerifyCommand{})
+	parser.AddCommand("watch", "Keep taking snapshots in a ring buffer", "Periodically take a snapshot with a lightweight profile, keeping the last snapshots in a ring buffer directory. On SIGUSR1, or when the bundle command is run, a full report is created that includes the snapshots.", &WatchCommand{options: &opts})
+	parser.AddCommand("serve", "Serve an API to create and download reports", "Serve an HTTP API on a unix socket only root can access, to list collectors and profiles, create reports (POST /reports with an optional JSON body selecting a profile and collectors), follow the progress of each collector (GET /reports/ID) and download the archive (GET /reports/ID/archive).", &ServeCommand{options: &opts})
+	parser.AddCommand("monitor", "Create a report when something goes wrong", "Keep checking for conditions such as the Garden API not answering, memory or disk running out, hung tasks or OOM kills in the kernel log and gdn restarting, and create a report, including any watch snapshots, as soon as one is met. Triggers can be configured and are rate limited.", &MonitorCommand{options: &opts})
+	parser.AddCommand("bundle", "Create a report including the watch snapshots", "Create a full report, as selected by the global options, that includes the snapshots kept by the watch command.", &BundleCommand{options: &opts})
+
+	args, err := parser.ParseArgs(os.Args[1:])
+	removeCgroup()
+	handleFlagErrors(args, err)
+	if parser.Active != nil {
+		return
+	}
+
+	collection := newCollection(opts)
+	selection, err := collection.selection(opts.Profile, opts.Include, opts.Only)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+		os.Exit(1)
+	}
+	if opts.List {
+		listCollectors(collection.collectors)
+		os.Exit(0)
 	}
 
-	handleFlagErrors(flags.ParseArgs(&opts, os.Args))
+	var progress io.Writer = os.Stdout
+	if opts.Output == "-" {
+		checkStdoutIsNotTerminal()
+		progress = os.Stderr
+	}
 
 	checkIsRoot()
 	checkIsNotBpm()
 	checkGardenLogLevel()
 
-	reportDir := createReportDir("/var/vcap/data/tmp")
-	osReporter := osreporter.New(reportDir, os.Stdout)
-
-	if opts.SigQUIT {
-		osReporter.RegisterCollector("Dump gdn goroutines", command.NewDiscardCollector("pkill -QUIT gdn"))
-	}
-
-	osReporter.RegisterNoisyCollector("Date", command.NewCollector("date", "date.log"))
-	osReporter.RegisterNoisyCollector("Uptime", command.NewCollector("uptime", "uptime.log"))
-	osReporter.RegisterNoisyCollector("Garden Version", command.NewCollector("/var/vcap/packages/guardian/bin/gdn -v", "gdn-version.log"))
-	osReporter.RegisterNoisyCollector("Hostname", command.NewCollector("hostname", "hostname.log"))
-	osReporter.RegisterNoisyCollector("Memory Usage", command.NewCollector("free -mt", "free.log"))
-	osReporter.RegisterNoisyCollector("Kernel Details", command.NewCollector("uname -a", "uname.log"))
-	osReporter.RegisterNoisyCollector("Monit Summary", command.NewCollector("/var/vcap/bosh/bin/monit summary", "monit-summary.log"))
-	osReporter.RegisterNoisyCollector("Number of Open Files", command.NewCollector("lsof 2>/dev/null | wc -l", "num-open-files.log"))
-	osReporter.RegisterNoisyCollector("Max Number of Open Files", command.NewCollector("cat /proc/sys/fs/file-max", "file-max.log"))
-
-	osReporter.RegisterCollector("Disk Usage", command.NewCollector("df -h", "df.log"))
-	osReporter.RegisterCollector("GrootFS Unprivileged Usage", grootfs.NewUsageCollector("/var/vcap/jobs/garden/config/grootfs_config.yml", commandrunner.CommandRunner{}))
-	osReporter.RegisterCollector("GrootFS Privileged Usage", grootfs.NewUsageCollector("/var/vcap/jobs/garden/config/privileged_grootfs_config.yml", commandrunner.CommandRunner{}))
-	osReporter.RegisterCollector("List of Open Files", command.NewCollector("lsof", "lsof.log"))
-	osReporter.RegisterCollector("Map of Inodes to Paths", command.NewCollector(`find / -fprintf inodes '%i %p\n'; lsof -Fi | grep '^i' | cut -c2- | sort | uniq | xargs -i grep -w ^{} inodes; rm inodes`, "inodes.log"), time.Second*60)
-	osReporter.RegisterCollector("Process Information", command.NewCollector("ps -eLo pid,tid,ppid,user:11,comm,state,wchan:35,lstart", "ps-info.log"))
-	osReporter.RegisterCollector("Process Tree", command.NewCollector("ps aux --forest", "ps-forest.log"))
-	osReporter.RegisterCollector("Kernel Messages", command.NewCollector("dmesg -T", "dmesg.log"))
-	osReporter.RegisterCollector("Network Interfaces", command.NewCollector("ifconfig", "ifconfig.log"))
-	osReporter.RegisterCollector("IP Tables", command.NewCollector("iptables -L -w", "iptables-L.log"))
-	osReporter.RegisterCollector("NAT IP Tables", command.NewCollector("iptables -tnat -L -w", "iptables-tnat.log"))
-	osReporter.RegisterCollector("Mount Table", command.NewCollector("cat /proc/$(pidof gdn)/mountinfo", "mountinfo.log"))
-	osReporter.RegisterCollector("Garden Depot Contents", command.NewCollector("find /var/vcap/data/garden/depot | sed 's|[^/]*/|- |g'", "depot-contents.log"))
-	osReporter.RegisterCollector("XFS Fragmentation", command.NewCollector("xfs_db -r -c frag /var/vcap/data/grootfs/store/unprivileged.backing-store", "xfs-frag.log"))
-	osReporter.RegisterCollector("XFS Info", command.NewCollector("xfs_info /var/vcap/data/grootfs/store/unprivileged", "xfs-info.log"))
-	osReporter.RegisterCollector("Slabinfo", command.NewCollector("cat /proc/slabinfo", "slabinfo.log"))
-	osReporter.RegisterCollector("Meminfo", command.NewCollector("cat /proc/meminfo", "meminfo.log"))
-	osReporter.RegisterCollector("IOSTAT -xdm (slow)", command.NewCollector("iostat -x -d -m 5 3", "iostat.log"), time.Second*16)
-	osReporter.RegisterCollector("VMSTAT -s", command.NewCollector("vmstat -s", "vmstat-s.log"))
-	osReporter.RegisterCollector("VMSTAT -d (slow)", command.NewCollector("vmstat -d 5 3", "vmstat-d.log"), time.Second*16)
-	osReporter.RegisterCollector("VMSTAT -a (slow)", command.NewCollector("vmstat -a 5 3", "vmstat-a.log"), time.Second*16)
-	osReporter.RegisterCollector("Mass Process Data", process.NewCollector("process-data"))
-
-	osReporter.RegisterCollector("Kernel Log", file.NewCollector("/var/log/kern.log*", "kernel-logs/"))
-	osReporter.RegisterCollector("Monit Log", file.NewCollector("/var/vcap/monit/monit.log", "monit.log"))
-	osReporter.RegisterCollector("Syslog", file.NewCollector("/var/log/syslog*", "syslogs/"))
-	osReporter.RegisterCollector("Garden Config", file.NewDirCollector("/var/vcap/jobs/garden/config", ""))
-	osReporter.RegisterCollector("Garden Logs", file.NewDirCollector("/var/vcap/sys/log/garden", ""))
-	osReporter.RegisterCollector("Sysstat", file.NewDirCollector("/var/log/sysstat", ""))
-
-	osReporter.RegisterCollector("Garden Containers", command.NewCollector("(curl localhost:7777/containers || curl --no-buffer -XGET --unix-socket /var/vcap/data/garden/garden.sock http://localhost/containers) 2> /dev/null", "garden-containers.log"))
-	if isContainerd() {
-		osReporter.RegisterCollector("Containerd Init Containers", command.NewCollector(`/var/vcap/packages/containerd/bin/ctr -a /var/vcap/sys/run/containerd/containerd.sock -n garden containers ls 'labels."container-type"==garden-init'`, "containerd/init-containers"))
-		osReporter.RegisterCollector("Containerd Pea Containers", command.NewCollector(`/var/vcap/packages/containerd/bin/ctr -a /var/vcap/sys/run/containerd/containerd.sock -n garden containers ls 'labels."container-type"==pea'`, "containerd/pea-containers"))
-		osReporter.RegisterCollector("Containerd Tasks", command.NewCollector(`/var/vcap/packages/containerd/bin/ctr -a /var/vcap/sys/run/containerd/containerd.sock -n garden tasks ls`, "containerd/tasks"))
-	}
-
-	if err := osReporter.Run(); err != nil {
+	location := chooseOutputDir(progress, append([]string{opts.OutputDir}, opts.FallbackDir...), collection.selected(selection), reportLayout(opts))
+
+	hostname := getHostname(progress)
+
+	var anonymizer *anonymize.Anonymizer
+	if opts.Anonymize {
+		anonymizer = newAnonymizer(hostname, opts.MappingFile)
+		hostname = anonymizer.Anonymize(hostname)
+	}
+
+	reportDir := reportPath(location.Path, hostname)
+	if !opts.Stream {
+		createReportDir(reportDir)
+	}
+	collection.limits = applyLimits(opts)
+	osReporter := collection.newReporter(reportDir, progress, selection, anonymizer)
+	osReporter.SetMetadata("output_dir", location.Path)
+	if location.Fallback() {
+		osReporter.SetMetadata("output_dir_reason", location.Reason)
+	}
+
+	var archive *os.File
+	switch opts.Output {
+	case "":
+	case "-":
+		osReporter.SetArchiveWriter(os.Stdout, "stdout")
+	default:
+		archive, err = os.Create(opts.Output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(fmt.Sprintf("cannot create archive %q: %s", opts.Output, err.Error())))
+			removeCgroup()
+			os.Exit(1)
+		}
+		osReporter.SetArchiveWriter(archive, opts.Output)
+	}
+
+	ctx, interrupted := interruptible(progress)
+	err = osReporter.RunContext(ctx)
+	removeCgroup()
+
+	if archive != nil {
+		if closeErr := archive.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("cannot write archive %q: %w", opts.Output, closeErr)
+		}
+		// An incomplete archive must not pass for a report, but the output
+		// may be a device
+		if info, statErr := os.Stat(opts.Output); err != nil && statErr == nil && info.Mode().IsRegular() {
+			os.Remove(opts.Output)
+		}
+	}
+
+	if anonymizer != nil {
+		saveMapping(progress, anonymizer, opts.MappingFile, reportDir)
+	}
+
+	if err != nil {
 		fmt.Fprint(os.Stderr, err)
 		os.Exit(1)
 	}
+	if sig, ok := interrupted(); ok {
+		os.Exit(128 + int(sig))
+	}
+}
+
+// collection holds what the options say about how to create reports.
+type collection struct {
+	opts       Options
+	collectors []collectorspec.Spec
+	redactor   *redact.Redactor
+	recipient  *ecdh.PublicKey
+	signingKey ed25519.PrivateKey
+	// limits are the limits dontpanic runs with, once applied.
+	limits map[string]string
+}
+
+func newCollection(opts Options) collection {
+	config, err := collectorspec.Load(opts.Config...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+		os.Exit(1)
+	}
+
+	c := collection{opts: opts, collectors: config.Enabled(map[string]bool{"sigquit": opts.SigQUIT})}
+
+	if opts.EncryptTo != "" {
+		c.recipient, err = encrypt.LoadPublicKey(opts.EncryptTo)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	if opts.SignKey != "" {
+		c.signingKey, err = report.LoadSigningKey(opts.SignKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	c.redactor, err = newRedactor(opts.Redact, opts.NoRedact)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+		os.Exit(1)
+	}
+
+	return c
+}
+
+// selection returns the collectors of the named profile, adjusted by the
+// patterns given and the --skip option.
+func (c collection) selection(profileName string, include, only []string) (collectorspec.Selection, error) {
+	profile, err := collectorspec.FindProfile(profileName)
+	if err != nil {
+		return collectorspec.Selection{}, err
+	}
+
+	selection := collectorspec.Selection{Profile: profile, Include: include, Only: only, Skip: c.opts.Skip}
+	return selection, selection.Validate()
+}
+
+func (c collection) selected(selection collectorspec.Selection) []collectorspec.Spec {
+	specs := []collectorspec.Spec{}
+	for _, spec := range c.collectors {
+		if selection.SkipReason(spec) == "" {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// newReporter returns a reporter for the selected collectors, set up as the
+// options say.
+func (c collection) newReporter(reportDir string, progress io.Writer, selection collectorspec.Selection, anonymizer *anonymize.Anonymizer) osreporter.Reporter {
+	osReporter := osreporter.New(reportDir, progress)
+	osReporter.SetParallelism(c.opts.Parallelism)
+	osReporter.SetMaxDuration(c.opts.MaxDuration)
+	osReporter.SetStreaming(c.opts.Stream)
+	osReporter.SetMetadata("profile", selection.Profile.Name)
+	for key, value := range c.limits {
+		osReporter.SetMetadata(key, value)
+	}
+	if c.redactor != nil {
+		osReporter.SetRedactor(c.redactor)
+	} else {
+		osReporter.SetMetadata("redaction", "disabled")
+	}
+	if c.recipient != nil {
+		osReporter.SetRecipient(c.recipient)
+	}
+	if c.signingKey != nil {
+		osReporter.SetSigningKey(c.signingKey)
+	}
+	if anonymizer != nil {
+		osReporter.SetAnonymizer(anonymizer)
+		osReporter.SetMetadata("anonymized", "true")
+	}
+
+	for _, spec := range c.collectors {
+		if reason := selection.SkipReason(spec); reason != "" {
+			osReporter.RegisterSkippedCollector(spec.Name, reason)
+			continue
+		}
+
+		if err := spec.Register(&osReporter); err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	return osReporter
+}
+
+// reportMaker creates reports for the commands that keep running. All
+// reports share the anonymizer, so that pseudonyms are consistent across
+// them.
+type reportMaker struct {
+	collection  collection
+	hostname    string
+	anonymizer  *anonymize.Anonymizer
+	mappingFile string
+}
+
+// newReportMaker returns a report maker keeping the anonymization mapping in
+// the file given by the options, or in defaultMappingFile.
+func newReportMaker(opts Options, defaultMappingFile string) *reportMaker {
+	m := &reportMaker{collection: newCollection(opts), hostname: getHostname(os.Stdout)}
+	m.collection.limits = applyLimits(opts)
+
+	if opts.Anonymize {
+		m.mappingFile = opts.MappingFile
+		if m.mappingFile == "" {
+			m.mappingFile = defaultMappingFile
+		}
+		m.anonymizer = newAnonymizer(m.hostname, m.mappingFile)
+		m.hostname = m.anonymizer.Anonymize(m.hostname)
+	}
+
+	return m
+}
+
+// prepare returns a reporter for the selected collectors, writing to the
+// first output directory with enough space.
+func (m *reportMaker) prepare(progress io.Writer, selection collectorspec.Selection) (osreporter.Reporter, error) {
+	opts := m.collection.opts
+
+	estimate := collectorspec.EstimateReport(m.collection.selected(selection), reportLayout(opts))
+	location, err := outputdir.Choose(append([]string{opts.OutputDir}, opts.FallbackDir...), outputdir.Requirement{Bytes: estimate.Bytes, Inodes: estimate.Files})
+	if err != nil {
+		return osreporter.Reporter{}, err
+	}
+
+	reportDir := reportPath(location.Path, m.hostname)
+	if !opts.Stream {
+		if err := os.MkdirAll(reportDir, 0755); err != nil {
+			return osreporter.Reporter{}, fmt.Errorf("cannot create report directory %q: %w", reportDir, err)
+		}
+	}
+
+	osReporter := m.collection.newReporter(reportDir, progress, selection, m.anonymizer)
+	osReporter.SetMetadata("output_dir", location.Path)
+	if location.Fallback() {
+		osReporter.SetMetadata("output_dir_reason", location.Reason)
+	}
+	return osReporter, nil
+}
+
+func (m *reportMaker) saveMapping(progress io.Writer) {
+	if m.anonymizer != nil {
+		saveMapping(progress, m.anonymizer, m.mappingFile, "")
+	}
+}
+
+func listCollectors(specs []collectorspec.Spec) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tTIMEOUT\tCATEGORIES\tDESCRIPTION")
+	for _, spec := range specs {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", spec.Name, spec.EffectiveTimeout(), strings.Join(spec.Categories, ","), spec.Description)
+	}
+	writer.Flush()
+
+	fmt.Println()
+	writer = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "PROFILE\tDESCRIPTION")
+	for _, profile := range collectorspec.Profiles {
+		fmt.Fprintf(writer, "%s\t%s\n", profile.Name, profile.Description)
+	}
+	writer.Flush()
+}
+
+func newRedactor(expressions []string, disabled bool) (*redact.Redactor, error) {
+	if disabled {
+		return nil, nil
+	}
+
+	rules := redact.DefaultRules()
+	for _, expression := range expressions {
+		rule, err := redact.ParseRule(expression)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return redact.New(rules...), nil
 }
 
 func checkIsRoot() {
@@ -135,24 +409,95 @@ func checkGardenLogLevel() {
 	}
 }
 
-func isContainerd() bool {
-	_, err := os.Stat("/var/vcap/sys/run/containerd/containerd.sock")
-	return !os.IsNotExist(err)
+func checkStdoutIsNotTerminal() {
+	if _, err := unix.IoctlGetTermios(int(os.Stdout.Fd()), unix.TCGETS); err == nil {
+		fmt.Fprintln(os.Stderr, aurora.Red("Refusing to write the archive to a terminal, please redirect stdout to a file or pipe").Bold())
+		os.Exit(1)
+	}
+}
+
+func chooseOutputDir(progress io.Writer, candidates []string, specs []collectorspec.Spec, layout collectorspec.Layout) outputdir.Location {
+	estimate := collectorspec.EstimateReport(specs, layout)
+	location, err := outputdir.Choose(candidates, outputdir.Requirement{Bytes: estimate.Bytes, Inodes: estimate.Files})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+		os.Exit(1)
+	}
+
+	if location.Fallback() {
+		fmt.Fprintln(progress, aurora.Yellow(fmt.Sprintf("Writing the report to %s: %s", location.Path, location.Reason)).Bold())
+	} else {
+		fmt.Fprintln(progress, aurora.Bold(fmt.Sprintf("Writing the report to %s (about %s needed)", location.Path, outputdir.FormatBytes(estimate.Bytes))))
+	}
+
+	return location
+}
+
+// reportLayout describes how the options make the report be written, for
+// its space estimate.
+func reportLayout(opts Options) collectorspec.Layout {
+	return collectorspec.Layout{
+		Streaming:        opts.Stream,
+		ArchiveElsewhere: opts.Output != "",
+		Parallelism:      opts.Parallelism,
+	}
 }
 
-func createReportDir(baseDir string) string {
+func newAnonymizer(hostname, mappingFile string) *anonymize.Anonymizer {
+	anonymizer := anonymize.New()
+	anonymizer.AddHostname(hostname)
+
+	if entries, err := os.ReadDir(gardenDepotDir); err == nil {
+		for _, entry := range entries {
+			anonymizer.AddContainerHandle(entry.Name())
+		}
+	}
+
+	if mappingFile != "" {
+		if err := anonymizer.LoadMapping(mappingFile); err != nil {
+			fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	return anonymizer
+}
+
+// saveMapping keeps the anonymization mapping out of the archive, so that
+// the operator can translate pseudonyms in findings back.
+func saveMapping(progress io.Writer, anonymizer *anonymize.Anonymizer, mappingFile, reportDir string) {
+	if mappingFile == "" {
+		mappingFile = reportDir + "-anonymize-mapping.json"
+	}
+
+	if err := anonymizer.SaveMapping(mappingFile); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(fmt.Sprintf("cannot save anonymization mapping %q: %s", mappingFile, err.Error())))
+		return
+	}
+
+	fmt.Fprintln(progress, aurora.Yellow(fmt.Sprintf("Anonymization mapping saved to %s, keep it to translate pseudonyms back. Do not send it along with the report!", mappingFile)).Bold())
+}
+
+func getHostname(progress io.Writer) string {
 	hostname, err := os.Hostname()
 	if err != nil {
-		fmt.Println(aurora.Magenta("could not determine hostname"))
-		hostname = "UNKNOWN-HOSTNAME"
+		fmt.Fprintln(progress, aurora.Magenta("could not determine hostname"))
+		return "UNKNOWN-HOSTNAME"
 	}
+	return hostname
+}
+
+func reportPath(baseDir, hostname string) string {
 	timestamp := time.Now().Format("2006-01-02-15-04-05.000000000")
 	reportDir := fmt.Sprintf("os-report-%s-%s", hostname, timestamp)
-	path := filepath.Join(baseDir, reportDir)
+	return filepath.Join(baseDir, reportDir)
+}
+
+func createReportDir(path string) {
 	if err := os.MkdirAll(path, 0755); err != nil {
 		fmt.Fprintln(os.Stderr, aurora.Red(fmt.Sprintf("cannot create report directory %q: %s", path, err.Error())))
+		os.Exit(1)
 	}
-	return path
 }
 
 func handleFlagErrors(_ []string, err error) {
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"code.cloudfoundry.org/dontpanic/trigger"
+)
+
+type MonitorCommand struct {
+	Triggers []string      `long:"triggers" description:"YAML file with triggers extending or overriding the defaults (can be repeated)"`
+	Interval time.Duration `long:"interval" default:"10s" description:"Time between checks of the trigger conditions"`
+	MinGap   time.Duration `long:"min-gap" default:"15m" description:"Minimum time between two triggered reports"`
+	RingDir  string        `long:"ring-dir" default:"/var/vcap/data/tmp/dontpanic-watch" description:"Directory the watch command keeps the snapshots in, which triggered reports include"`
+	List     bool          `long:"list" description:"List the triggers and exit"`
+
+	options *Options
+}
+
+func (c *MonitorCommand) Execute([]string) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("the interval must be positive")
+	}
+
+	config, err := trigger.Load(c.Triggers...)
+	if err != nil {
+		return err
+	}
+
+	if c.List {
+		listTriggers(config.Enabled())
+		return nil
+	}
+
+	checkIsRoot()
+	checkIsNotBpm()
+	checkGardenLogLevel()
+
+	w, err := newWatcher(*c.options, c.RingDir, 1)
+	if err != nil {
+		return err
+	}
+
+	specs := config.Enabled()
+	monitor := trigger.NewMonitor(specs, c.MinGap)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	fmt.Println(aurora.Bold(fmt.Sprintf("Checking %d trigger(s) every %s, creating a report at most every %s", len(specs), c.Interval, c.MinGap)))
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.check(w, monitor)
+
+		select {
+		case <-ticker.C:
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+// check creates a report if any trigger fires. Conditions are not checked
+// while the report is being created.
+func (c *MonitorCommand) check(w *watcher, monitor *trigger.Monitor) {
+	firings, errs := monitor.Check(time.Now())
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, aurora.Yellow(err.Error()))
+	}
+
+	for _, firing := range firings {
+		if firing.Suppressed != "" {
+			fmt.Println(aurora.Yellow(fmt.Sprintf("Trigger %s fired, but no report is created as %s: %s", firing.Trigger, firing.Suppressed, firing.Reason)))
+			continue
+		}
+		fmt.Println(aurora.Red(fmt.Sprintf("Trigger %s fired: %s", firing.Trigger, firing.Reason)).Bold())
+	}
+
+	active := trigger.Active(firings)
+	if len(active) == 0 {
+		return
+	}
+
+	metadata := map[string]string{"trigger": trigger.Names(active), "trigger_reason": trigger.Reasons(active)}
+	if err := w.bundle(os.Stdout, metadata); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+	}
+}
+
+func listTriggers(specs []trigger.Spec) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tTYPE\tCOOLDOWN\tDESCRIPTION")
+	for _, spec := range specs {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", spec.Name, spec.Type, spec.EffectiveCooldown(), spec.Description)
+	}
+	writer.Flush()
+}
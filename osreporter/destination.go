@@ -0,0 +1,193 @@
+package osreporter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/archiver"
+	"code.cloudfoundry.org/dontpanic/encrypt"
+)
+
+// destination is where a report is assembled until it has been turned into
+// the final archive.
+type destination interface {
+	Sink
+	finish() error
+	abort()
+}
+
+func (r Reporter) tarballPath() string {
+	if r.recipient != nil {
+		return r.reportPath + ".tar.gz" + encrypt.Extension
+	}
+	return r.reportPath + ".tar.gz"
+}
+
+// ArchivePath returns where the archive is written, unless an archive
+// writer is set.
+func (r Reporter) ArchivePath() string {
+	return r.tarballPath()
+}
+
+// archiveName describes where the archive is written in the reporter's
+// output.
+func (r Reporter) archiveName() string {
+	if r.archiveWriter != nil {
+		return r.archiveWriterName
+	}
+	return r.tarballPath()
+}
+
+func (r Reporter) openDestination() (destination, error) {
+	if !r.streaming {
+		return dirDestination{DirSink: NewDirSink(r.reportPath), reportPath: r.reportPath, openArchive: r.openArchive}, nil
+	}
+
+	// Artifacts larger than archiver.MaxBufferedEntry are spooled here
+	// until they are complete
+	spoolDir := r.reportPath + ".spool"
+
+	out, err := r.openArchive()
+	if err != nil {
+		return nil, err
+	}
+
+	writer := archiver.NewWriter(out, filepath.Base(r.reportPath))
+	writer.SetSpoolDir(spoolDir)
+
+	return streamDestination{Writer: writer, out: out, spoolDir: spoolDir}, nil
+}
+
+// archiveOutput is where the compressed archive goes: a file next to the
+// report directory or a writer set by the caller, encrypted when a
+// recipient is set.
+type archiveOutput struct {
+	io.Writer
+	name      string
+	file      *os.File
+	encrypter io.WriteCloser
+}
+
+func (r Reporter) openArchive() (*archiveOutput, error) {
+	out := &archiveOutput{Writer: r.archiveWriter, name: r.archiveName()}
+
+	if r.archiveWriter == nil {
+		file, err := os.OpenFile(r.tarballPath(), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out.file = file
+		out.Writer = file
+	}
+
+	if r.recipient != nil {
+		encrypter, err := encrypt.NewWriter(out.Writer, r.recipient)
+		if err != nil {
+			out.discard()
+			return nil, fmt.Errorf("failed to encrypt archive: %w", err)
+		}
+		out.encrypter = encrypter
+		out.Writer = encrypter
+	}
+
+	return out, nil
+}
+
+// close completes the archive once everything has been written to it.
+func (o *archiveOutput) close() error {
+	if o.encrypter != nil {
+		if err := o.encrypter.Close(); err != nil {
+			return err
+		}
+	}
+
+	if o.file != nil {
+		return o.file.Close()
+	}
+	return nil
+}
+
+// discard removes an archive file that could not be completed.
+func (o *archiveOutput) discard() {
+	if o.file != nil {
+		o.file.Close()
+		os.Remove(o.file.Name())
+	}
+}
+
+// dirDestination stages the report uncompressed in the report directory and
+// archives it once all collectors are done.
+type dirDestination struct {
+	DirSink
+	reportPath  string
+	openArchive func() (*archiveOutput, error)
+}
+
+func (d dirDestination) finish() error {
+	if err := d.archive(); err != nil {
+		return fmt.Errorf("failed to create archive, the uncompressed report was left in %s: %w", d.reportPath, err)
+	}
+
+	return os.RemoveAll(d.reportPath)
+}
+
+func (d dirDestination) archive() error {
+	out, err := d.openArchive()
+	if err != nil {
+		return err
+	}
+
+	writer := archiver.NewWriter(out, filepath.Base(d.reportPath))
+	err = writer.ArchiveDir(d.reportPath)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = out.close()
+	}
+
+	if err != nil {
+		out.discard()
+	}
+	return err
+}
+
+func (d dirDestination) abort() {}
+
+// streamDestination compresses each artifact into the archive as soon as it
+// is complete.
+type streamDestination struct {
+	*archiver.Writer
+	out      *archiveOutput
+	spoolDir string
+}
+
+func (d streamDestination) Create(name string) (io.WriteCloser, error) {
+	cleanName, err := cleanArtifactName(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.Writer.Create(cleanName)
+}
+
+func (d streamDestination) finish() error {
+	defer os.RemoveAll(d.spoolDir)
+
+	err := d.Writer.Close()
+	if err == nil {
+		err = d.out.close()
+	}
+
+	if err != nil {
+		d.out.discard()
+		return fmt.Errorf("failed to finish archive %s: %w", d.out.name, err)
+	}
+	return nil
+}
+
+func (d streamDestination) abort() {
+	d.out.discard()
+	os.RemoveAll(d.spoolDir)
+}
@@ -0,0 +1,120 @@
+package osreporter
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const manifestFilename = "manifest.json"
+
+type Outcome string
+
+const (
+	OutcomeOK       Outcome = "ok"
+	OutcomeFailed   Outcome = "failed"
+	OutcomeTimedOut Outcome = "timed_out"
+	OutcomeSkipped  Outcome = "skipped"
+	// OutcomeCancelled is the outcome of collectors that were still running
+	// when the report was cancelled.
+	OutcomeCancelled Outcome = "cancelled"
+)
+
+// Describer is implemented by collectors that can tell where their data comes
+// from, e.g. the command they run or the path they copy.
+type Describer interface {
+	Source() string
+}
+
+// ArgvDescriber is implemented by collectors running commands, to record the
+// exact argv of each command they run in the manifest.
+type ArgvDescriber interface {
+	Argv() [][]string
+}
+
+type Manifest struct {
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Cancelled is why the report was cancelled before all collectors
+	// finished, if it was.
+	Cancelled  string            `json:"cancelled,omitempty"`
+	Collectors []CollectorResult `json:"collectors"`
+}
+
+type CollectorResult struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	// Argv is the argv of each stage of the pipeline a command collector
+	// runs.
+	Argv      [][]string   `json:"argv,omitempty"`
+	StartTime time.Time    `json:"start_time,omitzero"`
+	EndTime   time.Time    `json:"end_time,omitzero"`
+	Duration  float64      `json:"duration_seconds"`
+	Outcome   Outcome      `json:"outcome"`
+	Error     string       `json:"error,omitempty"`
+	Reason    string       `json:"reason,omitempty"`
+	Files     []FileResult `json:"files"`
+	Bytes     int64        `json:"bytes"`
+	// Redactions is the number of secrets removed from the collector's
+	// output.
+	Redactions int `json:"redactions,omitempty"`
+	// Exit is how the command of a collector that failed ended.
+	Exit *Exit `json:"exit,omitempty"`
+}
+
+type Exit struct {
+	// Code is -1 if the command was killed by a signal.
+	Code   int    `json:"code"`
+	Signal string `json:"signal,omitempty"`
+	// Truncated is whether the output of the command was cut short because
+	// it timed out, was cancelled or went over its output limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// CommandError is returned by collectors whose command failed, to record how
+// it ended in the manifest.
+type CommandError struct {
+	Err  error
+	Exit Exit
+}
+
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+type FileResult struct {
+	Path       string `json:"path"`
+	Bytes      int64  `json:"bytes"`
+	Redactions int    `json:"redactions,omitempty"`
+	// Truncated is whether the artifact was cut short at the output limit
+	// of its collector, leaving DroppedBytes out.
+	Truncated    bool  `json:"truncated,omitempty"`
+	DroppedBytes int64 `json:"dropped_bytes,omitempty"`
+	// Binary is what was done with an artifact whose content looked
+	// binary, which cannot be rewritten line by line.
+	Binary BinaryHandling `json:"binary,omitempty"`
+}
+
+type BinaryHandling string
+
+const (
+	// BinaryDropped is for binary artifacts whose content was dropped as
+	// it could not be anonymized.
+	BinaryDropped BinaryHandling = "dropped"
+	// BinaryNotRedacted is for binary artifacts stored as they were, as
+	// they could not be redacted.
+	BinaryNotRedacted BinaryHandling = "not redacted"
+)
+
+func writeManifest(sink Sink, manifest Manifest) error {
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeArtifact(sink, manifestFilename, append(contents, '\n'))
+}
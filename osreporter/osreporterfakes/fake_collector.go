@@ -10,11 +10,11 @@ import (
 )
 
 type FakeCollector struct {
-	RunStub        func(context.Context, string, io.Writer) error
+	RunStub        func(context.Context, osreporter.Sink, io.Writer) error
 	runMutex       sync.RWMutex
 	runArgsForCall []struct {
 		arg1 context.Context
-		arg2 string
+		arg2 osreporter.Sink
 		arg3 io.Writer
 	}
 	runReturns struct {
@@ -27,12 +27,12 @@ type FakeCollector struct {
 	invocationsMutex sync.RWMutex
 }
 
-func (fake *FakeCollector) Run(arg1 context.Context, arg2 string, arg3 io.Writer) error {
+func (fake *FakeCollector) Run(arg1 context.Context, arg2 osreporter.Sink, arg3 io.Writer) error {
 	fake.runMutex.Lock()
 	ret, specificReturn := fake.runReturnsOnCall[len(fake.runArgsForCall)]
 	fake.runArgsForCall = append(fake.runArgsForCall, struct {
 		arg1 context.Context
-		arg2 string
+		arg2 osreporter.Sink
 		arg3 io.Writer
 	}{arg1, arg2, arg3})
 	fake.recordInvocation("Run", []interface{}{arg1, arg2, arg3})
@@ -53,13 +53,13 @@ func (fake *FakeCollector) RunCallCount() int {
 	return len(fake.runArgsForCall)
 }
 
-func (fake *FakeCollector) RunCalls(stub func(context.Context, string, io.Writer) error) {
+func (fake *FakeCollector) RunCalls(stub func(context.Context, osreporter.Sink, io.Writer) error) {
 	fake.runMutex.Lock()
 	defer fake.runMutex.Unlock()
 	fake.RunStub = stub
 }
 
-func (fake *FakeCollector) RunArgsForCall(i int) (context.Context, string, io.Writer) {
+func (fake *FakeCollector) RunArgsForCall(i int) (context.Context, osreporter.Sink, io.Writer) {
 	fake.runMutex.RLock()
 	defer fake.runMutex.RUnlock()
 	argsForCall := fake.runArgsForCall[i]
@@ -1,87 +1,355 @@
 package osreporter
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/logrusorgru/aurora"
+
+	"code.cloudfoundry.org/dontpanic/anonymize"
+	"code.cloudfoundry.org/dontpanic/redact"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+	logFilename    = "dontpanic.log"
+)
+
+var (
+	ErrTimedOut = errors.New("timed out")
+	// ErrCancelled is returned by collectors that were still running when
+	// the report was cancelled.
+	ErrCancelled = errors.New("cancelled")
+	// ErrMaxDuration is the cause of reports that ran out of time.
+	ErrMaxDuration = errors.New("the maximum duration was exceeded")
 )
 
 type Reporter struct {
-	stdout     io.Writer
-	reportPath string
-	collectors []RegisteredCollector
+	stdout            io.Writer
+	reportPath        string
+	parallelism       int
+	maxDuration       time.Duration
+	streaming         bool
+	archiveWriter     io.Writer
+	archiveWriterName string
+	redactor          *redact.Redactor
+	anonymizer        *anonymize.Anonymizer
+	recipient         *ecdh.PublicKey
+	signingKey        ed25519.PrivateKey
+	metadata          map[string]string
+	observer          Observer
+	collectors        []RegisteredCollector
 }
 
 //go:generate counterfeiter . Collector
 type Collector interface {
-	Run(context.Context, string, io.Writer) error
+	Run(context.Context, Sink, io.Writer) error
+}
+
+// Observer is told about the progress of a report. Collectors run in
+// parallel, so its methods may be called from several goroutines at once.
+type Observer interface {
+	CollectorStarted(name string)
+	// CollectorFinished is called for every collector, including skipped
+	// ones, with the result recorded in the manifest.
+	CollectorFinished(result CollectorResult)
 }
 
 func New(reportPath string, stdout io.Writer) Reporter {
 	return Reporter{
-		reportPath: reportPath,
-		stdout:     stdout,
+		reportPath:  reportPath,
+		stdout:      stdout,
+		parallelism: 1,
+	}
+}
+
+// SetParallelism sets the maximum number of collectors that may run at the
+// same time. Values lower than 1 are treated as 1.
+func (r *Reporter) SetParallelism(parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
 	}
+	r.parallelism = parallelism
+}
+
+// SetMaxDuration makes the reporter cancel the collectors that are still
+// running, and skip the ones not started yet, once the report has been
+// running for the given duration. Zero means no limit.
+func (r *Reporter) SetMaxDuration(maxDuration time.Duration) {
+	r.maxDuration = maxDuration
+}
+
+// SetStreaming makes the reporter compress collector output into the
+// archive as it is produced, instead of staging the whole report in the
+// report directory first.
+func (r *Reporter) SetStreaming(streaming bool) {
+	r.streaming = streaming
+}
+
+// SetRedactor makes the reporter remove secrets from every artifact, and
+// from the collector output it prints, using the given redactor.
+func (r *Reporter) SetRedactor(redactor *redact.Redactor) {
+	r.redactor = redactor
+}
+
+// SetAnonymizer makes the reporter replace addresses, host names and other
+// identifiers in every artifact, including the log and manifest, and in the
+// collector output it prints.
+func (r *Reporter) SetAnonymizer(anonymizer *anonymize.Anonymizer) {
+	r.anonymizer = anonymizer
+}
+
+// SetRecipient makes the reporter encrypt the archive to the given public
+// key. The unencrypted report is removed as soon as the encrypted archive
+// is complete.
+func (r *Reporter) SetRecipient(recipient *ecdh.PublicKey) {
+	r.recipient = recipient
+}
+
+// SetSigningKey makes the reporter sign the checksums of the report with
+// the given key.
+func (r *Reporter) SetSigningKey(key ed25519.PrivateKey) {
+	r.signingKey = key
+}
+
+// SetArchiveWriter makes the reporter write the archive to w, referred to
+// as name in its output, instead of to a file next to the report
+// directory.
+func (r *Reporter) SetArchiveWriter(w io.Writer, name string) {
+	r.archiveWriter = w
+	r.archiveWriterName = name
+}
+
+// SetMetadata records a fact about how the report was produced, such as the
+// selected profile. Metadata is written to the manifest and to the top of
+// dontpanic.log.
+func (r *Reporter) SetMetadata(key, value string) {
+	if r.metadata == nil {
+		r.metadata = map[string]string{}
+	}
+	r.metadata[key] = value
+}
+
+// SetObserver makes the reporter tell observer about collectors starting
+// and finishing.
+func (r *Reporter) SetObserver(observer Observer) {
+	r.observer = observer
+}
+
+// CollectorNames returns the names of the registered collectors, including
+// skipped ones, in registration order.
+func (r Reporter) CollectorNames() []string {
+	names := []string{}
+	for _, collector := range r.collectors {
+		names = append(names, collector.name)
+	}
+	return names
 }
 
 func (r *Reporter) RegisterCollector(name string, collector Collector, timeout ...time.Duration) {
-	r.registerCollector(name, collector, false, timeout...)
+	r.registerCollector(RegisteredCollector{collector: collector, name: name}, timeout...)
 }
 
 func (r *Reporter) RegisterNoisyCollector(name string, collector Collector, timeout ...time.Duration) {
-	r.registerCollector(name, collector, true, timeout...)
+	r.registerCollector(RegisteredCollector{collector: collector, name: name, echoOutput: true}, timeout...)
+}
+
+// RegisterExclusiveCollector registers a collector that never runs alongside
+// other collectors: it waits for all previously registered collectors to
+// finish and holds back later ones until it is done.
+func (r *Reporter) RegisterExclusiveCollector(name string, collector Collector, timeout ...time.Duration) {
+	r.registerCollector(RegisteredCollector{collector: collector, name: name, exclusive: true}, timeout...)
+}
+
+// RegisterSkippedCollector records a collector that was deliberately left out
+// of the report, so that readers know its data is missing on purpose.
+func (r *Reporter) RegisterSkippedCollector(name, reason string) {
+	r.collectors = append(r.collectors, RegisteredCollector{name: name, skipReason: reason})
 }
 
-func (r *Reporter) registerCollector(name string, collector Collector, echoOutput bool, timeout ...time.Duration) {
-	maxDuration := 10 * time.Second
+func (r *Reporter) registerCollector(registeredCollector RegisteredCollector, timeout ...time.Duration) {
+	registeredCollector.timeout = DefaultTimeout
 	if len(timeout) > 0 {
-		maxDuration = timeout[0]
+		registeredCollector.timeout = timeout[0]
 	}
 
-	registeredCollector := RegisteredCollector{
-		collector:  collector,
-		name:       name,
-		timeout:    maxDuration,
-		echoOutput: echoOutput,
-	}
 	r.collectors = append(r.collectors, registeredCollector)
 }
 
 func (r Reporter) Run() error {
+	return r.RunContext(context.Background())
+}
+
+// RunContext creates the report until ctx is done. The collectors that are
+// still running are then cancelled and the ones not started yet skipped,
+// and the archive is created from what was collected.
+func (r Reporter) RunContext(ctx context.Context) error {
+	if r.maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, r.maxDuration, fmt.Errorf("%w (%s)", ErrMaxDuration, r.maxDuration))
+		defer cancel()
+	}
+
 	fmt.Fprintln(r.stdout, aurora.Green("<Useful information below, please copy-paste from here>").Bold())
 
-	logFile, err := os.Create(filepath.Join(r.reportPath, "dontpanic.log"))
+	destination, err := r.openDestination()
 	if err != nil {
 		return err
 	}
 
-	for _, collector := range r.collectors {
+	checksums := newChecksummingSink(destination)
+
+	var sink Sink = checksums
+	if r.anonymizer != nil {
+		sink = anonymizingSink{sink: checksums, anonymizer: r.anonymizer}
+	}
+
+	if err := r.collect(ctx, sink); err != nil {
+		destination.abort()
+		return err
+	}
+
+	if err := checksums.write(r.signingKey); err != nil {
+		destination.abort()
+		return err
+	}
+
+	if err := destination.finish(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(r.stdout, aurora.Green(fmt.Sprintf("<Report Complete. Archive Created: %s>", r.archiveName())).Bold())
+
+	return nil
+}
+
+func (r Reporter) collect(ctx context.Context, sink Sink) error {
+	manifest := Manifest{StartTime: time.Now(), Metadata: r.metadata}
+
+	logFile, err := sink.Create(logFilename)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	r.logMetadata(logFile)
+
+	runs := make([]*collectorRun, len(r.collectors))
+	for i := range runs {
+		runs[i] = &collectorRun{done: make(chan struct{})}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go r.schedule(ctx, runs, sink)
+
+	// Collectors may finish in any order, but their sections are always
+	// written in registration order to keep the output readable.
+	for i, collector := range r.collectors {
 		r.logHeader(logFile, collector.name)
 
-		out := io.Discard
-		if collector.echoOutput {
-			out = r.stdout
+		run := runs[i]
+		<-run.done
+
+		output := run.output.Bytes()
+		if r.redactor != nil {
+			output, _ = r.redactor.Redact(output)
+		}
+		if r.anonymizer != nil {
+			output = r.anonymizer.AnonymizeBytes(output)
 		}
 
-		err := collector.Run(r.reportPath, out)
-		if err != nil {
-			r.logError(logFile, collector.name, err)
+		if _, err := r.stdout.Write(output); err != nil {
+			// The collectors still running must not write to the sink once
+			// the report is aborted
+			cancel(err)
+			for _, run := range runs[i+1:] {
+				<-run.done
+			}
+			return err
 		}
+
+		if run.result.Outcome == OutcomeSkipped {
+			r.logSkipped(logFile, collector.name, run.result.Reason)
+		}
+
+		if run.err != nil {
+			r.logError(logFile, collector.name, run.err)
+		}
+
+		r.logRedactions(logFile, collector.name, run.result.Files)
+		r.logBinaries(logFile, collector.name, run.result.Files)
+
+		manifest.Collectors = append(manifest.Collectors, run.result)
+	}
+
+	if ctx.Err() != nil {
+		manifest.Cancelled = context.Cause(ctx).Error()
+		r.logCancelled(logFile, manifest.Cancelled)
 	}
 
-	if err := r.createTarball(); err != nil {
+	manifest.EndTime = time.Now()
+	if err := writeManifest(sink, manifest); err != nil {
 		return err
 	}
 
-	fmt.Fprintln(r.stdout, aurora.Green(fmt.Sprintf("<Report Complete. Archive Created: %s.tar.gz>", r.reportPath)).Bold())
+	return logFile.Close()
+}
+
+// schedule runs the registered collectors on at most r.parallelism
+// goroutines, starting them in registration order. Once ctx is done, the
+// collectors not started yet are skipped.
+func (r Reporter) schedule(ctx context.Context, runs []*collectorRun, sink Sink) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, r.parallelism)
 
-	return os.RemoveAll(r.reportPath)
+	for i, collector := range r.collectors {
+		if collector.skipped() {
+			runs[i].skip(collector, r.observer)
+			continue
+		}
+
+		if collector.exclusive {
+			wg.Wait()
+			if ctx.Err() != nil {
+				runs[i].skip(collector.cancelled(ctx), r.observer)
+				continue
+			}
+			runs[i].execute(ctx, collector, sink, r.redactor, r.observer)
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			runs[i].skip(collector.cancelled(ctx), r.observer)
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			runs[i].execute(ctx, collector, sink, r.redactor, r.observer)
+		}()
+	}
+}
+
+func (r Reporter) logMetadata(writer io.Writer) {
+	for _, key := range slices.Sorted(maps.Keys(r.metadata)) {
+		fmt.Fprintf(writer, "# %s: %s\n", key, r.metadata[key])
+	}
 }
 
 func (r Reporter) logHeader(writer io.Writer, value string) {
@@ -96,25 +364,194 @@ func (r Reporter) logError(writer io.Writer, subject string, err error) {
 	fmt.Fprintln(writer, errorMessage)
 }
 
-func (r Reporter) createTarball() error {
-	return exec.Command("tar", "czf", r.reportPath+".tar.gz", "-C", filepath.Dir(r.reportPath), filepath.Base(r.reportPath)).Run()
+func (r Reporter) logSkipped(writer io.Writer, subject, reason string) {
+	message := fmt.Sprintf(">> %s skipped: %s", subject, reason)
+	fmt.Fprintln(r.stdout, aurora.Yellow(message))
+	fmt.Fprintln(writer, message)
+}
+
+func (r Reporter) logCancelled(writer io.Writer, reason string) {
+	message := fmt.Sprintf(">> Report cancelled, collectors that had not finished were skipped: %s", reason)
+	fmt.Fprintln(r.stdout, aurora.Yellow(message).Bold())
+	fmt.Fprintln(writer, message)
+}
+
+func (r Reporter) logRedactions(writer io.Writer, subject string, files []FileResult) {
+	for _, file := range files {
+		if file.Redactions == 0 {
+			continue
+		}
+		message := fmt.Sprintf(">> %s: redacted %d secret(s) from %s", subject, file.Redactions, file.Path)
+		fmt.Fprintln(r.stdout, aurora.Magenta(message))
+		fmt.Fprintln(writer, message)
+	}
+}
+
+// logBinaries lists the artifacts whose content was not redacted or
+// anonymized because it looked binary.
+func (r Reporter) logBinaries(writer io.Writer, subject string, files []FileResult) {
+	for _, file := range files {
+		var message string
+		switch file.Binary {
+		case BinaryDropped:
+			message = fmt.Sprintf(">> %s: dropped the content of %s, it is binary and cannot be anonymized", subject, file.Path)
+		case BinaryNotRedacted:
+			message = fmt.Sprintf(">> %s: did not redact %s, it is binary", subject, file.Path)
+		default:
+			continue
+		}
+		fmt.Fprintln(r.stdout, aurora.Yellow(message))
+		fmt.Fprintln(writer, message)
+	}
 }
 
 type RegisteredCollector struct {
 	collector  Collector
 	name       string
 	echoOutput bool
+	exclusive  bool
+	skipReason string
 	timeout    time.Duration
 }
 
-func (p RegisteredCollector) Run(dstPath string, out io.Writer) error {
-	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+func (p RegisteredCollector) skipped() bool {
+	return p.skipReason != ""
+}
+
+// cancelled returns the collector marked as skipped because the report was
+// cancelled before it started.
+func (p RegisteredCollector) cancelled(ctx context.Context) RegisteredCollector {
+	p.skipReason = fmt.Sprintf("not started, the report was cancelled: %s", context.Cause(ctx))
+	return p
+}
+
+func (p RegisteredCollector) Run(parent context.Context, sink Sink, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(parent, p.timeout)
 	defer cancel()
 
-	err := p.collector.Run(ctx, dstPath, out)
-	if err == context.DeadlineExceeded {
-		return fmt.Errorf("timed out after %s", p.timeout)
+	err := p.collector.Run(ctx, sink, out)
+	if err != nil && parent.Err() != nil {
+		return withDetails(fmt.Errorf("%w: %w", ErrCancelled, context.Cause(parent)), err)
+	}
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || ctx.Err() == context.DeadlineExceeded) {
+		return withDetails(fmt.Errorf("%w after %s", ErrTimedOut, p.timeout), err)
 	}
 
 	return err
 }
+
+// withDetails adds to err what the error of a collector that was cancelled
+// or timed out says beyond that, such as processes it could not kill, and
+// makes it wrap the collector's error too.
+func withDetails(err, collectorErr error) error {
+	stopped := stoppedError{message: err.Error(), errs: []error{err, collectorErr}}
+
+	details := collectorErr.Error()
+	if details != context.Canceled.Error() && details != context.DeadlineExceeded.Error() &&
+		(errors.Is(collectorErr, context.Canceled) || errors.Is(collectorErr, context.DeadlineExceeded)) {
+		stopped.message += ": " + details
+	}
+	return stopped
+}
+
+type stoppedError struct {
+	message string
+	errs    []error
+}
+
+func (e stoppedError) Error() string {
+	return e.message
+}
+
+func (e stoppedError) Unwrap() []error {
+	return e.errs
+}
+
+func (p RegisteredCollector) source() string {
+	if describer, ok := p.collector.(Describer); ok {
+		return describer.Source()
+	}
+	return ""
+}
+
+func (p RegisteredCollector) argv() [][]string {
+	if describer, ok := p.collector.(ArgvDescriber); ok {
+		return describer.Argv()
+	}
+	return nil
+}
+
+// collectorRun holds the outcome of a single collector execution until the
+// reporter is ready to write it out.
+type collectorRun struct {
+	output bytes.Buffer
+	err    error
+	result CollectorResult
+	done   chan struct{}
+}
+
+func (c *collectorRun) skip(collector RegisteredCollector, observer Observer) {
+	defer close(c.done)
+
+	c.result = CollectorResult{
+		Name:    collector.name,
+		Outcome: OutcomeSkipped,
+		Reason:  collector.skipReason,
+		Files:   []FileResult{},
+	}
+
+	if observer != nil {
+		observer.CollectorFinished(c.result)
+	}
+}
+
+func (c *collectorRun) execute(ctx context.Context, collector RegisteredCollector, sink Sink, redactor *redact.Redactor, observer Observer) {
+	defer close(c.done)
+
+	if observer != nil {
+		observer.CollectorStarted(collector.name)
+	}
+
+	var out io.Writer = io.Discard
+	if collector.echoOutput {
+		out = &c.output
+	}
+
+	c.result = CollectorResult{
+		Name:      collector.name,
+		Source:    collector.source(),
+		Argv:      collector.argv(),
+		StartTime: time.Now(),
+		Outcome:   OutcomeOK,
+	}
+
+	trackingSink := &trackingSink{sink: sink, redactor: redactor}
+	c.err = collector.Run(ctx, trackingSink, out)
+
+	c.result.EndTime = time.Now()
+	c.result.Duration = c.result.EndTime.Sub(c.result.StartTime).Seconds()
+	c.result.Files, c.result.Bytes = trackingSink.results()
+	for _, file := range c.result.Files {
+		c.result.Redactions += file.Redactions
+	}
+
+	if c.err != nil {
+		c.result.Outcome = OutcomeFailed
+		switch {
+		case errors.Is(c.err, ErrTimedOut):
+			c.result.Outcome = OutcomeTimedOut
+		case errors.Is(c.err, ErrCancelled):
+			c.result.Outcome = OutcomeCancelled
+		}
+		c.result.Error = c.err.Error()
+
+		var commandErr *CommandError
+		if errors.As(c.err, &commandErr) {
+			c.result.Exit = &commandErr.Exit
+		}
+	}
+
+	if observer != nil {
+		observer.CollectorFinished(c.result)
+	}
+}
@@ -1,16 +1,31 @@
 package osreporter_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"code.cloudfoundry.org/dontpanic/anonymize"
+	"code.cloudfoundry.org/dontpanic/encrypt"
+	"code.cloudfoundry.org/dontpanic/linewriter"
 	"code.cloudfoundry.org/dontpanic/osreporter"
 	"code.cloudfoundry.org/dontpanic/osreporter/osreporterfakes"
+	"code.cloudfoundry.org/dontpanic/redact"
+	"code.cloudfoundry.org/dontpanic/report"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
@@ -60,6 +75,217 @@ var _ = Describe("Reporter", func() {
 		Expect(fileType(reportDir + ".tar.gz")).To(ContainSubstring("gzip"))
 	})
 
+	When("streaming into the archive", func() {
+		var streamReportDir string
+
+		BeforeEach(func() {
+			streamReportDir = filepath.Join(reportDir, "os-report-streamed")
+
+			runner = osreporter.New(streamReportDir, outputWriter)
+			runner.SetStreaming(true)
+			runner.RegisterCollector("file-collector", fileWritingCollector{path: "sub/file.log", contents: "12345"})
+		})
+
+		It("writes the artifacts, log and manifest straight into the archive", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			tarballPath := streamReportDir + ".tar.gz"
+			Expect(tarballFileContents(tarballPath, "sub/file.log")).To(Equal([]byte("12345")))
+			Expect(string(tarballFileContents(tarballPath, "dontpanic.log"))).To(ContainSubstring("## file-collector"))
+			Expect(string(tarballFileContents(tarballPath, "manifest.json"))).To(ContainSubstring(`"path": "sub/file.log"`))
+		})
+
+		It("does not stage the report in a directory", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(streamReportDir).NotTo(BeADirectory())
+			Expect(streamReportDir + ".spool").NotTo(BeADirectory())
+		})
+
+		It("reports the archive location", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(outputWriter).To(gbytes.Say("Archive Created: " + streamReportDir + ".tar.gz"))
+		})
+
+		It("rejects artifacts that would end up outside the report", func() {
+			runner.RegisterCollector("escaping-collector", fileWritingCollector{path: "../../etc/x", contents: "12345"})
+			Expect(runner.Run()).To(Succeed())
+			Expect(outputWriter).To(gbytes.Say(`escaping-collector failed: invalid artifact name "../../etc/x"`))
+
+			entries, err := exec.Command("tar", "tzf", streamReportDir+".tar.gz").Output()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(entries)).NotTo(ContainSubstring(".."))
+		})
+	})
+
+	When("an archive writer is set", func() {
+		var archive *bytes.Buffer
+
+		BeforeEach(func() {
+			archive = new(bytes.Buffer)
+			runner.SetArchiveWriter(archive, "stdout")
+			runner.RegisterCollector("file-collector", fileWritingCollector{path: "file.log", contents: "12345"})
+		})
+
+		// saveArchive stores the written archive under the name the report
+		// would otherwise have been given, so it can be inspected like one.
+		saveArchive := func() string {
+			tarballPath := reportDir + ".tar.gz"
+			Expect(os.WriteFile(tarballPath, archive.Bytes(), 0644)).To(Succeed())
+			return tarballPath
+		}
+
+		It("writes the archive to it", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(tarballFileContents(saveArchive(), "file.log")).To(Equal([]byte("12345")))
+		})
+
+		It("refers to the archive by the given name", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(outputWriter).To(gbytes.Say("Archive Created: stdout"))
+		})
+
+		It("removes the report dir", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(reportDir).NotTo(BeADirectory())
+		})
+
+		When("streaming into the archive", func() {
+			BeforeEach(func() {
+				runner.SetStreaming(true)
+			})
+
+			It("writes the archive to it", func() {
+				Expect(runner.Run()).To(Succeed())
+				Expect(tarballFileContents(saveArchive(), "file.log")).To(Equal([]byte("12345")))
+			})
+		})
+	})
+
+	When("a recipient is set", func() {
+		var privateKey *ecdh.PrivateKey
+
+		BeforeEach(func() {
+			var err error
+			privateKey, err = ecdh.X25519().GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			runner.SetRecipient(privateKey.PublicKey())
+			runner.RegisterCollector("file-collector", fileWritingCollector{path: "file.log", contents: "12345"})
+		})
+
+		decryptArchive := func() string {
+			encrypted, err := os.Open(reportDir + ".tar.gz.enc")
+			Expect(err).NotTo(HaveOccurred())
+			defer encrypted.Close()
+
+			decrypted, err := encrypt.NewReader(encrypted, privateKey)
+			Expect(err).NotTo(HaveOccurred())
+			contents, err := io.ReadAll(decrypted)
+			Expect(err).NotTo(HaveOccurred())
+
+			tarballPath := reportDir + ".tar.gz"
+			Expect(os.WriteFile(tarballPath, contents, 0644)).To(Succeed())
+			return tarballPath
+		}
+
+		It("encrypts the archive", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(outputWriter).To(gbytes.Say("Archive Created: " + reportDir + ".tar.gz.enc"))
+			Expect(reportDir + ".tar.gz").NotTo(BeAnExistingFile())
+			Expect(tarballFileContents(decryptArchive(), "file.log")).To(Equal([]byte("12345")))
+		})
+
+		It("removes the unencrypted report", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(reportDir).NotTo(BeADirectory())
+		})
+
+		When("streaming into the archive", func() {
+			BeforeEach(func() {
+				runner.SetStreaming(true)
+			})
+
+			It("encrypts the archive", func() {
+				Expect(runner.Run()).To(Succeed())
+				Expect(tarballFileContents(decryptArchive(), "file.log")).To(Equal([]byte("12345")))
+			})
+		})
+	})
+
+	Describe("checksums", func() {
+		BeforeEach(func() {
+			Expect(os.Remove(filepath.Join(reportDir, "hello"))).To(Succeed())
+			runner.RegisterCollector("file-collector", fileWritingCollector{path: "sub/file.log", contents: "12345"})
+		})
+
+		verifyArchive := func(publicKey ed25519.PublicKey) report.Verification {
+			archive, err := report.Open(reportDir+".tar.gz", "")
+			Expect(err).NotTo(HaveOccurred())
+			defer archive.Close()
+
+			verification, err := report.Verify(archive, publicKey)
+			Expect(err).NotTo(HaveOccurred())
+			return verification
+		}
+
+		It("records the checksum of every file in the report", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			sums := string(tarballFileContents(reportDir+".tar.gz", report.ChecksumsFilename))
+			Expect(sums).To(ContainSubstring("5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5  sub/file.log\n"))
+			Expect(sums).To(ContainSubstring("  manifest.json\n"))
+			Expect(sums).To(ContainSubstring("  dontpanic.log\n"))
+
+			verification := verifyArchive(nil)
+			Expect(verification.OK()).To(BeTrue())
+			Expect(verification.Signed).To(BeFalse())
+		})
+
+		It("records checksums when streaming into the archive", func() {
+			runner.SetStreaming(true)
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(verifyArchive(nil).Verified).To(ContainElement("sub/file.log"))
+		})
+
+		When("a signing key is set", func() {
+			var publicKey ed25519.PublicKey
+
+			BeforeEach(func() {
+				var (
+					privateKey ed25519.PrivateKey
+					err        error
+				)
+				publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				runner.SetSigningKey(privateKey)
+			})
+
+			It("signs the checksums", func() {
+				Expect(runner.Run()).To(Succeed())
+
+				verification := verifyArchive(publicKey)
+				Expect(verification.OK()).To(BeTrue())
+				Expect(verification.SignatureValid).To(BeTrue())
+			})
+		})
+	})
+
+	When("the archive cannot be created", func() {
+		BeforeEach(func() {
+			Expect(os.Mkdir(reportDir+".tar.gz", 0755)).To(Succeed())
+			DeferCleanup(os.RemoveAll, reportDir+".tar.gz")
+		})
+
+		It("returns an error and keeps the uncompressed report", func() {
+			Expect(runner.Run()).To(MatchError(ContainSubstring("the uncompressed report was left in " + reportDir)))
+			Expect(filepath.Join(reportDir, "hello")).To(BeAnExistingFile())
+			Expect(filepath.Join(reportDir, "manifest.json")).To(BeAnExistingFile())
+		})
+	})
+
 	It("runs all collectors in sequence", func() {
 		Expect(runner.Run()).To(Succeed())
 
@@ -69,17 +295,359 @@ var _ = Describe("Reporter", func() {
 		Expect(collectorOne.RunCallCount()).To(Equal(1))
 		Expect(collectorTwo.RunCallCount()).To(Equal(1))
 
-		_, actualDstPath, actualStdout := collectorOne.RunArgsForCall(0)
-		Expect(actualDstPath).To(Equal(reportDir))
+		_, _, actualStdout := collectorOne.RunArgsForCall(0)
 		Expect(actualStdout).To(Equal(io.Discard))
 	})
 
+	It("stores the artifacts collectors write to the sink in the report", func() {
+		collectorOne.RunStub = fileWritingCollector{path: "sub/one.log", contents: "one"}.Run
+
+		Expect(runner.Run()).To(Succeed())
+		Expect(tarballFileContents(reportDir+".tar.gz", "sub/one.log")).To(Equal([]byte("one")))
+	})
+
 	When("registering a collector with stdout printing", func() {
-		It("provides stdout as the output writer", func() {
+		BeforeEach(func() {
+			collectorTwo.RunStub = func(_ context.Context, _ osreporter.Sink, stdout io.Writer) error {
+				_, err := io.WriteString(stdout, "collector-two-output")
+				return err
+			}
+		})
+
+		It("echoes the collector output to stdout", func() {
 			Expect(runner.Run()).To(Succeed())
 
-			_, _, actualStdout := collectorTwo.RunArgsForCall(0)
-			Expect(actualStdout).To(Equal(outputWriter))
+			Expect(outputWriter).To(gbytes.Say("## collector-two"))
+			Expect(outputWriter).To(gbytes.Say("collector-two-output"))
+		})
+	})
+
+	When("metadata is set", func() {
+		BeforeEach(func() {
+			runner.SetMetadata("profile", "quick")
+		})
+
+		It("records it in the log and in the manifest", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			logContents := string(tarballFileContents(reportDir+".tar.gz", "dontpanic.log"))
+			Expect(logContents).To(HavePrefix("# profile: quick\n"))
+
+			var manifest osreporter.Manifest
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+			Expect(manifest.Metadata).To(HaveKeyWithValue("profile", "quick"))
+		})
+	})
+
+	When("a redactor is set", func() {
+		BeforeEach(func() {
+			runner.SetRedactor(redact.New(redact.DefaultRules()...))
+			runner.RegisterCollector("config-collector", fileWritingCollector{path: "config.yml", contents: "user: admin\npassword: hunter2\ntoken: abc\n"})
+			collectorTwo.RunStub = func(_ context.Context, _ osreporter.Sink, stdout io.Writer) error {
+				_, err := io.WriteString(stdout, "password=hunter2\n")
+				return err
+			}
+		})
+
+		It("redacts the artifacts", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(string(tarballFileContents(reportDir+".tar.gz", "config.yml"))).To(Equal("user: admin\npassword: [REDACTED]\ntoken: [REDACTED]\n"))
+		})
+
+		It("redacts the collector output it prints", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(outputWriter).NotTo(gbytes.Say("hunter2"))
+			Expect(outputWriter).To(gbytes.Say("password=\\[REDACTED\\]"))
+		})
+
+		It("counts the redactions per file", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			logContents := string(tarballFileContents(reportDir+".tar.gz", "dontpanic.log"))
+			Expect(logContents).To(ContainSubstring(">> config-collector: redacted 2 secret(s) from config.yml"))
+
+			var manifest osreporter.Manifest
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+			redacted := "user: admin\npassword: [REDACTED]\ntoken: [REDACTED]\n"
+			Expect(manifest.Collectors[2].Files).To(ConsistOf(osreporter.FileResult{Path: "config.yml", Bytes: int64(len(redacted)), Redactions: 2}))
+			Expect(manifest.Collectors[2].Redactions).To(Equal(2))
+		})
+
+		When("an artifact is binary", func() {
+			BeforeEach(func() {
+				runner.RegisterCollector("binary-collector", fileWritingCollector{path: "core.bin", contents: "\x00password: hunter2\n"})
+			})
+
+			It("records that it was not redacted", func() {
+				Expect(runner.Run()).To(Succeed())
+				Expect(outputWriter).To(gbytes.Say(">> binary-collector: did not redact core.bin, it is binary"))
+
+				var manifest osreporter.Manifest
+				Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+				Expect(manifest.Collectors[3].Files).To(ConsistOf(osreporter.FileResult{Path: "core.bin", Bytes: 19, Binary: osreporter.BinaryNotRedacted}))
+			})
+		})
+	})
+
+	When("an anonymizer is set", func() {
+		BeforeEach(func() {
+			anonymizer := anonymize.New()
+			anonymizer.AddContainerHandle("handle-1")
+			runner.SetAnonymizer(anonymizer)
+			runner.SetMetadata("output_dir", "/10.0.0.9")
+			runner.RegisterCollector("container-collector", fileWritingCollector{path: "depot/handle-1/ip", contents: "10.0.0.1\n"})
+			collectorTwo.RunStub = func(_ context.Context, _ osreporter.Sink, stdout io.Writer) error {
+				_, err := io.WriteString(stdout, "peer 10.0.0.1\n")
+				return err
+			}
+		})
+
+		It("anonymizes the names and contents of the artifacts", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(string(tarballFileContents(reportDir+".tar.gz", "depot/container-1/ip"))).To(MatchRegexp(`^ipv4-\d+\n$`))
+		})
+
+		It("anonymizes the log and manifest", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(string(tarballFileContents(reportDir+".tar.gz", "dontpanic.log"))).To(MatchRegexp(`# output_dir: /ipv4-\d+\n`))
+			Expect(string(tarballFileContents(reportDir+".tar.gz", "manifest.json"))).To(ContainSubstring(`"path": "depot/container-1/ip"`))
+		})
+
+		It("anonymizes the collector output it prints", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(outputWriter).To(gbytes.Say(`peer ipv4-\d+`))
+		})
+
+		When("an artifact is binary", func() {
+			BeforeEach(func() {
+				runner.RegisterCollector("binary-collector", fileWritingCollector{path: "core.bin", contents: "\x00 10.0.0.1\n"})
+			})
+
+			It("drops its content and records it", func() {
+				Expect(runner.Run()).To(Succeed())
+
+				Expect(string(tarballFileContents(reportDir+".tar.gz", "core.bin"))).To(Equal(linewriter.DroppedMarker))
+				Expect(string(tarballFileContents(reportDir+".tar.gz", "manifest.json"))).To(ContainSubstring(`"binary": "dropped"`))
+				Expect(outputWriter).To(gbytes.Say(">> binary-collector: dropped the content of core.bin, it is binary and cannot be anonymized"))
+			})
+		})
+	})
+
+	When("a collector is skipped", func() {
+		BeforeEach(func() {
+			runner.RegisterSkippedCollector("collector-three", "excluded by --skip")
+		})
+
+		It("does not run it but records why it was skipped", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(outputWriter).To(gbytes.Say("## collector-three"))
+			Expect(outputWriter).To(gbytes.Say(">> collector-three skipped: excluded by --skip"))
+
+			logContents := string(tarballFileContents(reportDir+".tar.gz", "dontpanic.log"))
+			Expect(logContents).To(ContainSubstring("## collector-three\n>> collector-three skipped: excluded by --skip"))
+
+			var manifest osreporter.Manifest
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+			Expect(manifest.Collectors[2].Outcome).To(Equal(osreporter.OutcomeSkipped))
+			Expect(manifest.Collectors[2].Reason).To(Equal("excluded by --skip"))
+		})
+	})
+
+	When("an observer is set", func() {
+		var observer *recordingObserver
+
+		BeforeEach(func() {
+			observer = &recordingObserver{}
+			collectorTwo.RunReturns(errors.New("boom"))
+			runner.RegisterSkippedCollector("collector-three", "excluded by --skip")
+			runner.SetObserver(observer)
+		})
+
+		It("tells it about every collector starting and finishing", func() {
+			Expect(runner.CollectorNames()).To(Equal([]string{"collector-one", "collector-two", "collector-three"}))
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(observer.events).To(ConsistOf(
+				"started collector-one", "finished collector-one ok",
+				"started collector-two", "finished collector-two failed",
+				"finished collector-three skipped",
+			))
+			Expect(slices.Index(observer.events, "started collector-two")).To(BeNumerically("<", slices.Index(observer.events, "finished collector-two failed")))
+		})
+	})
+
+	Describe("the manifest", func() {
+		var manifest osreporter.Manifest
+
+		BeforeEach(func() {
+			runner.RegisterCollector("file-collector", fileWritingCollector{path: "sub/file.log", contents: "12345", argv: [][]string{{"cat", "file.log"}}})
+			collectorOne.RunReturns(errors.New("collector-one-error"))
+			collectorTwo.RunReturns(context.DeadlineExceeded)
+		})
+
+		JustBeforeEach(func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+		})
+
+		It("lists every collector in registration order", func() {
+			Expect(manifest.Collectors).To(HaveLen(3))
+			Expect(manifest.Collectors[0].Name).To(Equal("collector-one"))
+			Expect(manifest.Collectors[1].Name).To(Equal("collector-two"))
+			Expect(manifest.Collectors[2].Name).To(Equal("file-collector"))
+		})
+
+		It("records the outcome of each collector", func() {
+			Expect(manifest.Collectors[0].Outcome).To(Equal(osreporter.OutcomeFailed))
+			Expect(manifest.Collectors[0].Error).To(Equal("collector-one-error"))
+			Expect(manifest.Collectors[1].Outcome).To(Equal(osreporter.OutcomeTimedOut))
+			Expect(manifest.Collectors[1].Error).To(Equal("timed out after 10s"))
+			Expect(manifest.Collectors[2].Outcome).To(Equal(osreporter.OutcomeOK))
+			Expect(manifest.Collectors[2].Error).To(BeEmpty())
+		})
+
+		It("records timings", func() {
+			result := manifest.Collectors[2]
+			Expect(result.StartTime).NotTo(BeZero())
+			Expect(result.EndTime).NotTo(BeTemporally("<", result.StartTime))
+			Expect(manifest.EndTime).NotTo(BeTemporally("<", manifest.StartTime))
+		})
+
+		It("records the source and the produced files", func() {
+			result := manifest.Collectors[2]
+			Expect(result.Source).To(Equal("sub/file.log"))
+			Expect(result.Files).To(ConsistOf(osreporter.FileResult{Path: "sub/file.log", Bytes: 5}))
+			Expect(result.Bytes).To(BeEquivalentTo(5))
+		})
+
+		It("records the argv of the commands run", func() {
+			Expect(manifest.Collectors[2].Argv).To(Equal([][]string{{"cat", "file.log"}}))
+			Expect(manifest.Collectors[0].Argv).To(BeNil())
+		})
+
+		When("a collector closes its artifact more than once", func() {
+			BeforeEach(func() {
+				runner.RegisterCollector("closing-twice", fileWritingCollector{path: "twice.log", contents: "123456", closeTwice: true})
+			})
+
+			It("records the artifact once", func() {
+				Expect(manifest.Collectors[3].Files).To(ConsistOf(osreporter.FileResult{Path: "twice.log", Bytes: 6}))
+				Expect(manifest.Collectors[3].Bytes).To(BeEquivalentTo(6))
+			})
+		})
+
+		When("a collector truncates its artifact", func() {
+			BeforeEach(func() {
+				runner.RegisterCollector("truncating", fileWritingCollector{path: "cut.log", contents: "123", dropped: 42})
+			})
+
+			It("records how much was dropped", func() {
+				Expect(manifest.Collectors[3].Files).To(ConsistOf(osreporter.FileResult{Path: "cut.log", Bytes: 3, Truncated: true, DroppedBytes: 42}))
+			})
+		})
+	})
+
+	When("running collectors in parallel", func() {
+		var (
+			started   chan string
+			release   chan struct{}
+			completed atomic.Int32
+		)
+
+		BeforeEach(func() {
+			started = make(chan string, 2)
+			release = make(chan struct{})
+			completed.Store(0)
+
+			blockUntilReleased := func(name string) func(context.Context, osreporter.Sink, io.Writer) error {
+				return func(_ context.Context, _ osreporter.Sink, stdout io.Writer) error {
+					started <- name
+					<-release
+					defer completed.Add(1)
+					_, err := io.WriteString(stdout, name+"-output\n")
+					return err
+				}
+			}
+
+			collectorOne.RunStub = blockUntilReleased("collector-one")
+			collectorTwo.RunStub = blockUntilReleased("collector-two")
+
+			runner.SetParallelism(2)
+		})
+
+		It("runs up to the configured number of collectors at once", func() {
+			errs := make(chan error)
+			go func() { errs <- runner.Run() }()
+
+			Eventually(started).Should(Receive())
+			Eventually(started).Should(Receive())
+			close(release)
+
+			Eventually(errs).Should(Receive(BeNil()))
+		})
+
+		It("writes the sections in registration order", func() {
+			close(release)
+			Expect(runner.Run()).To(Succeed())
+
+			Expect(outputWriter).To(gbytes.Say("## collector-one"))
+			Expect(outputWriter).To(gbytes.Say("## collector-two"))
+			Expect(outputWriter).To(gbytes.Say("collector-two-output"))
+		})
+
+		When("an exclusive collector is registered", func() {
+			var (
+				exclusiveCollector *osreporterfakes.FakeCollector
+				finishedBefore     int32
+			)
+
+			BeforeEach(func() {
+				exclusiveCollector = new(osreporterfakes.FakeCollector)
+				exclusiveCollector.RunStub = func(context.Context, osreporter.Sink, io.Writer) error {
+					finishedBefore = completed.Load()
+					return nil
+				}
+				close(release)
+
+				runner.RegisterExclusiveCollector("exclusive-collector", exclusiveCollector)
+			})
+
+			It("waits for the previously started collectors to finish", func() {
+				Expect(runner.Run()).To(Succeed())
+				Expect(exclusiveCollector.RunCallCount()).To(Equal(1))
+				Expect(finishedBefore).To(BeEquivalentTo(2))
+				Expect(outputWriter).To(gbytes.Say("## exclusive-collector"))
+			})
+		})
+	})
+
+	When("the output cannot be written", func() {
+		var collectorTwoReturned atomic.Bool
+
+		BeforeEach(func() {
+			outputWriter = &failingWriter{failOn: "collector-one-output"}
+			runner = osreporter.New(reportDir, outputWriter)
+			runner.RegisterNoisyCollector("collector-one", collectorOne)
+			runner.RegisterCollector("collector-two", collectorTwo)
+			runner.SetParallelism(2)
+
+			collectorOne.RunStub = func(_ context.Context, _ osreporter.Sink, stdout io.Writer) error {
+				_, err := io.WriteString(stdout, "collector-one-output\n")
+				return err
+			}
+			collectorTwoReturned.Store(false)
+			collectorTwo.RunStub = func(ctx context.Context, _ osreporter.Sink, _ io.Writer) error {
+				defer collectorTwoReturned.Store(true)
+				<-ctx.Done()
+				return ctx.Err()
+			}
+		})
+
+		It("cancels the collectors still running and waits for them", func() {
+			Expect(runner.Run()).To(MatchError("cannot write"))
+			Expect(collectorTwoReturned.Load()).To(BeTrue())
 		})
 	})
 
@@ -104,8 +672,155 @@ var _ = Describe("Reporter", func() {
 			Expect(outputWriter).To(gbytes.Say("timed out after 10s"))
 		})
 	})
+
+	When("a collector that timed out says more about it", func() {
+		BeforeEach(func() {
+			collectorOne.RunReturns(fmt.Errorf("%w: processes still running", context.DeadlineExceeded))
+		})
+
+		It("records what it says", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(outputWriter).To(gbytes.Say(">> collector-one failed: timed out after 10s: context deadline exceeded: processes still running"))
+		})
+	})
+
+	When("a collector's command times out", func() {
+		BeforeEach(func() {
+			collectorOne.RunReturns(&osreporter.CommandError{
+				Err:  context.DeadlineExceeded,
+				Exit: osreporter.Exit{Code: -1, Signal: "SIGTERM", Truncated: true},
+			})
+		})
+
+		It("records how the command ended in the manifest", func() {
+			Expect(runner.Run()).To(Succeed())
+
+			var manifest osreporter.Manifest
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+			Expect(manifest.Collectors[0].Outcome).To(Equal(osreporter.OutcomeTimedOut))
+			Expect(manifest.Collectors[0].Error).To(Equal("timed out after 10s"))
+			Expect(manifest.Collectors[0].Exit).To(Equal(&osreporter.Exit{Code: -1, Signal: "SIGTERM", Truncated: true}))
+			Expect(manifest.Collectors[1].Exit).To(BeNil())
+		})
+	})
+
+	When("the report is cancelled", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelCauseFunc
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancelCause(context.Background())
+			collectorOne.RunStub = func(ctx context.Context, _ osreporter.Sink, _ io.Writer) error {
+				cancel(errors.New("interrupted by SIGINT"))
+				<-ctx.Done()
+				return ctx.Err()
+			}
+		})
+
+		It("cancels the running collectors, skips the others and still creates the archive", func() {
+			Expect(runner.RunContext(ctx)).To(Succeed())
+			Expect(collectorTwo.RunCallCount()).To(Equal(0))
+			Expect(outputWriter).To(gbytes.Say(">> collector-one failed: cancelled: interrupted by SIGINT"))
+			Expect(outputWriter).To(gbytes.Say(">> collector-two skipped: not started, the report was cancelled: interrupted by SIGINT"))
+			Expect(outputWriter).To(gbytes.Say(">> Report cancelled, collectors that had not finished were skipped: interrupted by SIGINT"))
+
+			var manifest osreporter.Manifest
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+			Expect(manifest.Cancelled).To(Equal("interrupted by SIGINT"))
+			Expect(manifest.Collectors[0].Outcome).To(Equal(osreporter.OutcomeCancelled))
+			Expect(manifest.Collectors[1].Outcome).To(Equal(osreporter.OutcomeSkipped))
+		})
+	})
+
+	When("the report runs for longer than the maximum duration", func() {
+		BeforeEach(func() {
+			runner.SetMaxDuration(50 * time.Millisecond)
+			collectorOne.RunStub = func(ctx context.Context, _ osreporter.Sink, _ io.Writer) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+		})
+
+		It("cancels the collectors that have not finished", func() {
+			Expect(runner.Run()).To(Succeed())
+			Expect(collectorTwo.RunCallCount()).To(Equal(0))
+
+			var manifest osreporter.Manifest
+			Expect(json.Unmarshal(tarballFileContents(reportDir+".tar.gz", "manifest.json"), &manifest)).To(Succeed())
+			Expect(manifest.Cancelled).To(Equal("the maximum duration was exceeded (50ms)"))
+			Expect(manifest.Collectors[0].Outcome).To(Equal(osreporter.OutcomeCancelled))
+			Expect(manifest.Collectors[1].Reason).To(Equal("not started, the report was cancelled: the maximum duration was exceeded (50ms)"))
+		})
+	})
 })
 
+// failingWriter fails the writes containing failOn.
+type failingWriter struct {
+	failOn string
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), w.failOn) {
+		return 0, errors.New("cannot write")
+	}
+	return len(p), nil
+}
+
+type fileWritingCollector struct {
+	path     string
+	contents string
+	argv     [][]string
+	// closeTwice closes the artifact twice, as collectors deferring Close
+	// may do.
+	closeTwice bool
+	// dropped records that many bytes as left out of the artifact.
+	dropped int64
+}
+
+func (c fileWritingCollector) Run(_ context.Context, sink osreporter.Sink, _ io.Writer) error {
+	writer, err := sink.Create(c.path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, c.contents); err != nil {
+		return err
+	}
+	if c.closeTwice {
+		writer.Close()
+	}
+	if c.dropped > 0 {
+		sink.(osreporter.TruncationRecorder).RecordTruncated(c.path, c.dropped)
+	}
+	return writer.Close()
+}
+
+func (c fileWritingCollector) Source() string {
+	return c.path
+}
+
+func (c fileWritingCollector) Argv() [][]string {
+	return c.argv
+}
+
+type recordingObserver struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) CollectorStarted(name string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, "started "+name)
+}
+
+func (o *recordingObserver) CollectorFinished(result osreporter.CollectorResult) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.events = append(o.events, fmt.Sprintf("finished %s %s", result.Name, result.Outcome))
+}
+
 func tarballFileContents(tarballPath, filePath string) []byte {
 	extractedOsReportPath := strings.TrimSuffix(filepath.Base(tarballPath), ".tar.gz")
 	osDir := filepath.Base(extractedOsReportPath)
@@ -0,0 +1,287 @@
+package osreporter
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/dontpanic/anonymize"
+	"code.cloudfoundry.org/dontpanic/linewriter"
+	"code.cloudfoundry.org/dontpanic/redact"
+	"code.cloudfoundry.org/dontpanic/report"
+)
+
+// Sink stores the artifacts produced by collectors.
+type Sink interface {
+	// Create returns a writer for a new artifact, where name is a slash
+	// separated path relative to the root of the report. The artifact is
+	// complete once the writer has been closed.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// TruncationRecorder is implemented by the sinks given to collectors, so
+// that collectors which cut their output short at a byte limit can record it
+// in the manifest.
+type TruncationRecorder interface {
+	// RecordTruncated records that dropped bytes of the named artifact were
+	// left out.
+	RecordTruncated(name string, dropped int64)
+}
+
+// DirSink stores artifacts as files under a directory.
+type DirSink struct {
+	dir string
+}
+
+func NewDirSink(dir string) DirSink {
+	return DirSink{dir: dir}
+}
+
+func (s DirSink) Create(name string) (io.WriteCloser, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	return os.Create(path)
+}
+
+func (s DirSink) path(name string) (string, error) {
+	cleanName, err := cleanArtifactName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(cleanName)), nil
+}
+
+// cleanArtifactName returns the name of an artifact cleaned, failing for
+// names that would end up outside the report, such as absolute ones or
+// ones going up with "..".
+func cleanArtifactName(name string) (string, error) {
+	cleanName := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(cleanName) || cleanName == "." || cleanName == ".." || strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid artifact name %q", name)
+	}
+	return filepath.ToSlash(cleanName), nil
+}
+
+// trackingSink records the artifacts written through it, so that they can
+// be listed in the manifest. When a redactor is set the artifacts are
+// redacted on their way through.
+type trackingSink struct {
+	sink     Sink
+	redactor *redact.Redactor
+	mu       sync.Mutex
+	files    []FileResult
+	// dropped is how many bytes were left out of each truncated artifact.
+	dropped map[string]int64
+}
+
+func (s *trackingSink) Create(name string) (io.WriteCloser, error) {
+	writer, err := s.sink.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := &trackingWriter{WriteCloser: writer, name: name, sink: s}
+	if anonymizing, ok := writer.(anonymizingWriter); ok {
+		tracker.dropped = anonymizing.Binary
+	}
+	if s.redactor == nil {
+		return tracker, nil
+	}
+
+	redactor := s.redactor.NewWriter(tracker)
+	tracker.redactions = redactor.Redactions
+	tracker.notRedacted = redactor.Binary
+	return redactor, nil
+}
+
+func (s *trackingSink) record(file FileResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, file)
+}
+
+func (s *trackingSink) RecordTruncated(name string, dropped int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped == nil {
+		s.dropped = map[string]int64{}
+	}
+	s.dropped[name] += dropped
+}
+
+func (s *trackingSink) results() ([]FileResult, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := append([]FileResult{}, s.files...)
+	var total int64
+	for i, file := range files {
+		total += file.Bytes
+		if dropped, ok := s.dropped[file.Path]; ok {
+			files[i].Truncated = true
+			files[i].DroppedBytes = dropped
+		}
+	}
+	return files, total
+}
+
+type trackingWriter struct {
+	io.WriteCloser
+	name   string
+	bytes  int64
+	sink   *trackingSink
+	closed bool
+	// redactions reports how many secrets were removed from the artifact.
+	redactions func() int
+	// dropped reports whether the content of the artifact was dropped as it
+	// could not be anonymized.
+	dropped func() bool
+	// notRedacted reports whether the artifact was stored as it was because
+	// it could not be redacted.
+	notRedacted func() bool
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Close records the artifact, once however many times it is called.
+func (w *trackingWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	// What the writers below did with the content is only known once they
+	// are closed
+	err := w.WriteCloser.Close()
+
+	file := FileResult{Path: w.name, Bytes: w.bytes}
+	if w.redactions != nil {
+		file.Redactions = w.redactions()
+	}
+	switch {
+	case w.dropped != nil && w.dropped():
+		file.Binary = BinaryDropped
+	case w.notRedacted != nil && w.notRedacted():
+		file.Binary = BinaryNotRedacted
+	}
+	w.sink.record(file)
+	return err
+}
+
+// anonymizingSink pseudonymizes the names and contents of the artifacts
+// written through it.
+type anonymizingSink struct {
+	sink       Sink
+	anonymizer *anonymize.Anonymizer
+}
+
+func (s anonymizingSink) Create(name string) (io.WriteCloser, error) {
+	writer, err := s.sink.Create(s.anonymizer.Anonymize(name))
+	if err != nil {
+		return nil, err
+	}
+	return anonymizingWriter{s.anonymizer.NewWriter(writer)}, nil
+}
+
+// anonymizingWriter anonymizes the content of an artifact, dropping it if
+// it is binary.
+type anonymizingWriter struct {
+	*linewriter.Writer
+}
+
+// checksummingSink records the SHA-256 of every artifact as it is stored,
+// so that readers of the report can tell whether it was altered.
+type checksummingSink struct {
+	sink      Sink
+	mu        sync.Mutex
+	checksums map[string]string
+}
+
+func newChecksummingSink(sink Sink) *checksummingSink {
+	return &checksummingSink{sink: sink, checksums: map[string]string{}}
+}
+
+func (s *checksummingSink) Create(name string) (io.WriteCloser, error) {
+	writer, err := s.sink.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &checksummingWriter{WriteCloser: writer, name: path.Clean(name), hash: sha256.New(), sink: s}, nil
+}
+
+// write adds the checksums file, and its signature when a key is given, to
+// the report.
+func (s *checksummingSink) write(key ed25519.PrivateKey) error {
+	s.mu.Lock()
+	checksums := report.FormatChecksums(s.checksums)
+	s.mu.Unlock()
+
+	if err := writeArtifact(s.sink, report.ChecksumsFilename, checksums); err != nil {
+		return err
+	}
+
+	if key == nil {
+		return nil
+	}
+	return writeArtifact(s.sink, report.SignatureFilename, report.Sign(key, checksums))
+}
+
+type checksummingWriter struct {
+	io.WriteCloser
+	name   string
+	hash   hash.Hash
+	sink   *checksummingSink
+	closed bool
+}
+
+func (w *checksummingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+func (w *checksummingWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	w.sink.mu.Lock()
+	w.sink.checksums[w.name] = hex.EncodeToString(w.hash.Sum(nil))
+	w.sink.mu.Unlock()
+
+	return w.WriteCloser.Close()
+}
+
+func writeArtifact(sink Sink, name string, contents []byte) error {
+	writer, err := sink.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(contents); err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,150 @@
+// Package outputdir picks the directory a report is written to, falling
+// back to other locations when the preferred one is read-only or too full
+// to hold the report.
+package outputdir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Requirement is the space a report needs on the filesystem it is written
+// to.
+type Requirement struct {
+	Bytes  uint64
+	Inodes uint64
+}
+
+// Location is the directory chosen for the report. Reason explains why the
+// preferred directory was not used and is empty when it was.
+type Location struct {
+	Path   string
+	Reason string
+}
+
+// Fallback reports whether the location is not the preferred directory.
+func (l Location) Fallback() bool {
+	return l.Reason != ""
+}
+
+type candidate struct {
+	path      string
+	available uint64
+	err       error
+}
+
+// Choose returns the first of the candidate directories that is writable
+// and has room for the report, creating it if needed. When every writable
+// candidate is short on space the one with the most free space is chosen,
+// as a report that might not fit beats no report. An error is returned
+// only when no candidate is writable.
+func Choose(candidates []string, requirement Requirement) (Location, error) {
+	if len(candidates) == 0 {
+		return Location{}, errors.New("no output directories given")
+	}
+
+	var (
+		problems []string
+		best     *candidate
+	)
+
+	for _, path := range candidates {
+		c := check(path, requirement)
+		if c.err == nil {
+			return Location{Path: path, Reason: strings.Join(problems, "; ")}, nil
+		}
+
+		problems = append(problems, c.err.Error())
+		if errors.Is(c.err, ErrNotEnoughSpace) && (best == nil || c.available > best.available) {
+			best = &c
+		}
+	}
+
+	if best == nil {
+		return Location{}, fmt.Errorf("no usable output directory: %s", strings.Join(problems, "; "))
+	}
+
+	return Location{
+		Path:   best.path,
+		Reason: fmt.Sprintf("%s; using the directory with the most free space", strings.Join(problems, "; ")),
+	}, nil
+}
+
+// ErrNotEnoughSpace is returned when a directory is writable but its
+// filesystem cannot hold the report.
+var ErrNotEnoughSpace = errors.New("not enough free space")
+
+func check(path string, requirement Requirement) candidate {
+	c := candidate{path: path}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		c.err = fmt.Errorf("%s cannot be created: %w", path, unwrapPathError(err))
+		return c
+	}
+
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		c.err = fmt.Errorf("%s cannot be inspected: %w", path, err)
+		return c
+	}
+
+	if stat.Flags&unix.ST_RDONLY != 0 {
+		c.err = fmt.Errorf("%s is on a read-only filesystem", path)
+		return c
+	}
+
+	if err := probe(path); err != nil {
+		c.err = fmt.Errorf("%s is not writable: %w", path, unwrapPathError(err))
+		return c
+	}
+
+	c.available = stat.Bavail * uint64(stat.Bsize)
+	if c.available < requirement.Bytes {
+		c.err = fmt.Errorf("%s has %s free, %s needed: %w", path, FormatBytes(c.available), FormatBytes(requirement.Bytes), ErrNotEnoughSpace)
+		return c
+	}
+
+	// Filesystems that allocate inodes dynamically report no inodes at all
+	if stat.Files > 0 && stat.Ffree < requirement.Inodes {
+		c.err = fmt.Errorf("%s has %d free inodes, %d needed: %w", path, stat.Ffree, requirement.Inodes, ErrNotEnoughSpace)
+		return c
+	}
+
+	return c
+}
+
+func probe(path string) error {
+	file, err := os.CreateTemp(path, ".dontpanic-probe-")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+func unwrapPathError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// FormatBytes renders a byte count in binary units, e.g. 1.5 GiB.
+func FormatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
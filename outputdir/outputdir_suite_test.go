@@ -0,0 +1,13 @@
+package outputdir_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOutputdir(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Outputdir Suite")
+}
@@ -0,0 +1,108 @@
+package outputdir_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/outputdir"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Choose", func() {
+	var (
+		tmpDir      string
+		primary     string
+		fallback    string
+		unwritable  string
+		requirement outputdir.Requirement
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		primary = filepath.Join(tmpDir, "primary")
+		fallback = filepath.Join(tmpDir, "fallback")
+
+		blocker := filepath.Join(tmpDir, "blocker")
+		Expect(os.WriteFile(blocker, nil, 0644)).To(Succeed())
+		unwritable = filepath.Join(blocker, "tmp")
+
+		requirement = outputdir.Requirement{Bytes: 1024, Inodes: 10}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("chooses the first directory when it is usable", func() {
+		location, err := outputdir.Choose([]string{primary, fallback}, requirement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(location.Path).To(Equal(primary))
+		Expect(location.Fallback()).To(BeFalse())
+	})
+
+	It("creates the chosen directory", func() {
+		_, err := outputdir.Choose([]string{primary}, requirement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(primary).To(BeADirectory())
+	})
+
+	It("leaves no probe files behind", func() {
+		_, err := outputdir.Choose([]string{primary}, requirement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadDir(primary)).To(BeEmpty())
+	})
+
+	When("the first directory cannot be written to", func() {
+		It("falls back to the next directory and explains why", func() {
+			location, err := outputdir.Choose([]string{unwritable, fallback}, requirement)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(location.Path).To(Equal(fallback))
+			Expect(location.Fallback()).To(BeTrue())
+			Expect(location.Reason).To(Equal(unwritable + " cannot be created: not a directory"))
+		})
+	})
+
+	When("no directory can be written to", func() {
+		It("returns an error listing every directory", func() {
+			_, err := outputdir.Choose([]string{unwritable, filepath.Join(unwritable, "other")}, requirement)
+			Expect(err).To(MatchError(ContainSubstring("no usable output directory")))
+			Expect(err).To(MatchError(ContainSubstring(unwritable + " cannot be created")))
+			Expect(err).To(MatchError(ContainSubstring(unwritable + "/other cannot be created")))
+		})
+	})
+
+	When("no directory has enough free space", func() {
+		BeforeEach(func() {
+			requirement.Bytes = math.MaxUint64
+		})
+
+		It("chooses a writable directory anyway", func() {
+			location, err := outputdir.Choose([]string{unwritable, primary}, requirement)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(location.Path).To(Equal(primary))
+			Expect(location.Reason).To(ContainSubstring(primary + " has "))
+			Expect(location.Reason).To(ContainSubstring("using the directory with the most free space"))
+		})
+	})
+
+	When("no directories are given", func() {
+		It("returns an error", func() {
+			_, err := outputdir.Choose(nil, requirement)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("FormatBytes", func() {
+	It("renders bytes in binary units", func() {
+		Expect(outputdir.FormatBytes(512)).To(Equal("512 B"))
+		Expect(outputdir.FormatBytes(1536)).To(Equal("1.5 KiB"))
+		Expect(outputdir.FormatBytes(256 << 20)).To(Equal("256.0 MiB"))
+		Expect(outputdir.FormatBytes(3 << 30)).To(Equal("3.0 GiB"))
+	})
+})
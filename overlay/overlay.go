@@ -0,0 +1,75 @@
+// Package overlay loads lists of named definitions, such as collectors,
+// known-issue signatures and triggers, where the definitions shipped with
+// dontpanic are extended or overridden by name by the operator's files.
+package overlay
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Load returns the config parsed from the defaults, with the configs parsed
+// from each of the files merged over it in turn. What names the config in
+// errors, e.g. "triggers".
+func Load[C any](what string, defaults []byte, paths []string, parse func([]byte) (C, error), merge func(C, C) C) (C, error) {
+	var empty C
+
+	config, err := parse(defaults)
+	if err != nil {
+		return empty, fmt.Errorf("failed to parse default %s: %v", what, err)
+	}
+
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return empty, fmt.Errorf("failed to read %s %q: %v", what, path, err)
+		}
+
+		override, err := parse(contents)
+		if err != nil {
+			return empty, fmt.Errorf("failed to parse %s %q: %v", what, path, err)
+		}
+
+		config = merge(config, override)
+	}
+
+	return config, nil
+}
+
+// Parse strictly unmarshals the YAML contents into a config and validates
+// each of the definitions it lists.
+func Parse[C, T any](contents []byte, definitions func(C) []T, validate func(T) error) (C, error) {
+	var config, empty C
+	if err := yaml.UnmarshalStrict(contents, &config); err != nil {
+		return empty, err
+	}
+
+	for _, definition := range definitions(config) {
+		if err := validate(definition); err != nil {
+			return empty, err
+		}
+	}
+
+	return config, nil
+}
+
+// Merge returns the base definitions where the definitions in override
+// replace the definitions with the same name, and any other definitions
+// are appended.
+func Merge[T any](base, override []T, name func(T) string) []T {
+	merged := append([]T{}, base...)
+
+	for _, definition := range override {
+		i := slices.IndexFunc(merged, func(existing T) bool { return name(existing) == name(definition) })
+		if i >= 0 {
+			merged[i] = definition
+		} else {
+			merged = append(merged, definition)
+		}
+	}
+
+	return merged
+}
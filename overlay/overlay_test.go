@@ -0,0 +1,105 @@
+package overlay_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/overlay"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type definition struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type config struct {
+	Definitions []definition `yaml:"definitions"`
+}
+
+func parse(contents []byte) (config, error) {
+	return overlay.Parse(contents, func(c config) []definition { return c.Definitions }, func(d definition) error {
+		if d.Name == "" {
+			return errors.New("definition has no name")
+		}
+		return nil
+	})
+}
+
+func merge(base, override config) config {
+	return config{Definitions: overlay.Merge(base.Definitions, override.Definitions, func(d definition) string { return d.Name })}
+}
+
+var _ = Describe("Overlay", func() {
+	Describe("Parse", func() {
+		It("parses the definitions", func() {
+			parsed, err := parse([]byte("definitions: [{name: one, value: uno}]"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Definitions).To(Equal([]definition{{Name: "one", Value: "uno"}}))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := parse([]byte("definitions: [{name: one, colour: red}]"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects invalid definitions", func() {
+			_, err := parse([]byte("definitions: [{value: uno}]"))
+			Expect(err).To(MatchError("definition has no name"))
+		})
+	})
+
+	Describe("Merge", func() {
+		base := []definition{{Name: "one", Value: "1"}, {Name: "two", Value: "2"}}
+		name := func(d definition) string { return d.Name }
+
+		It("replaces definitions with the same name in place and appends the others", func() {
+			merged := overlay.Merge(base, []definition{{Name: "three", Value: "3"}, {Name: "one", Value: "uno"}}, name)
+			Expect(merged).To(Equal([]definition{{Name: "one", Value: "uno"}, {Name: "two", Value: "2"}, {Name: "three", Value: "3"}}))
+		})
+
+		It("does not modify the base definitions", func() {
+			overlay.Merge(base, []definition{{Name: "one", Value: "uno"}}, name)
+			Expect(base[0].Value).To(Equal("1"))
+		})
+	})
+
+	Describe("Load", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		It("merges each file over the defaults in turn", func() {
+			first := filepath.Join(dir, "first.yml")
+			second := filepath.Join(dir, "second.yml")
+			Expect(os.WriteFile(first, []byte("definitions: [{name: one, value: first}, {name: two, value: first}]"), 0644)).To(Succeed())
+			Expect(os.WriteFile(second, []byte("definitions: [{name: two, value: second}]"), 0644)).To(Succeed())
+
+			loaded, err := overlay.Load("definitions", []byte("definitions: [{name: one, value: default}]"), []string{first, second}, parse, merge)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded.Definitions).To(Equal([]definition{{Name: "one", Value: "first"}, {Name: "two", Value: "second"}}))
+		})
+
+		It("fails when the defaults are invalid", func() {
+			_, err := overlay.Load("definitions", []byte("definitions: [{}]"), nil, parse, merge)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse default definitions")))
+		})
+
+		It("fails when a file does not exist", func() {
+			_, err := overlay.Load("definitions", nil, []string{filepath.Join(dir, "missing.yml")}, parse, merge)
+			Expect(err).To(MatchError(ContainSubstring(`failed to read definitions "` + filepath.Join(dir, "missing.yml") + `"`)))
+		})
+
+		It("fails when a file is invalid", func() {
+			path := filepath.Join(dir, "invalid.yml")
+			Expect(os.WriteFile(path, []byte("definitions: [{value: nameless}]"), 0644)).To(Succeed())
+
+			_, err := overlay.Load("definitions", nil, []string{path}, parse, merge)
+			Expect(err).To(MatchError(ContainSubstring("failed to parse definitions")))
+		})
+	})
+})
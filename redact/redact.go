@@ -0,0 +1,220 @@
+// Package redact removes secrets such as private keys, passwords and tokens
+// from collected artifacts before they end up in a report.
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/dontpanic/linewriter"
+)
+
+// Placeholder replaces every redacted secret.
+const Placeholder = "[REDACTED]"
+
+// Rule matches secrets on a single line. When the pattern has a capture
+// group named "secret" only that group is replaced, so that the
+// surrounding key or header stays readable. Otherwise the whole match is
+// replaced.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+func (r Rule) redact(line []byte) ([]byte, int) {
+	secret := r.Pattern.SubexpIndex("secret")
+	count := 0
+
+	redacted := replaceAllSubmatchFunc(r.Pattern, line, func(match []int) []byte {
+		start, end := match[0], match[1]
+		if secret > 0 && match[2*secret] >= 0 {
+			start, end = match[2*secret], match[2*secret+1]
+		}
+
+		// Values that are empty or were redacted by an earlier rule are
+		// left alone, so that a secret is only counted once.
+		value := line[start:end]
+		if len(value) == 0 || bytes.Contains(value, []byte(Placeholder)) {
+			return line[match[0]:match[1]]
+		}
+
+		count++
+		replaced := append([]byte{}, line[match[0]:start]...)
+		replaced = append(replaced, Placeholder...)
+		return append(replaced, line[end:match[1]]...)
+	})
+
+	return redacted, count
+}
+
+func replaceAllSubmatchFunc(pattern *regexp.Regexp, src []byte, replace func(match []int) []byte) []byte {
+	matches := pattern.FindAllSubmatchIndex(src, -1)
+	if matches == nil {
+		return src
+	}
+
+	var result []byte
+	last := 0
+	for _, match := range matches {
+		result = append(result, src[last:match[0]]...)
+		result = append(result, replace(match)...)
+		last = match[1]
+	}
+	return append(result, src[last:]...)
+}
+
+var secretKey = `[\w.-]*(?:password|passwd|passphrase|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)[\w.-]*`
+
+// DefaultRules returns the rules applied to every report. Private key
+// blocks spanning several lines are always removed in addition to these.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:    "private-key",
+			Pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----(?P<secret>.*?)-----END [A-Z0-9 ]*PRIVATE KEY-----`),
+		},
+		{
+			// "key": "value" in JSON, and quoted values in YAML and INI
+			Name:    "quoted-secret",
+			Pattern: regexp.MustCompile(`(?i)["']?` + secretKey + `["']?\s*[:=]\s*"(?P<secret>[^"]*)"`),
+		},
+		{
+			Name:    "single-quoted-secret",
+			Pattern: regexp.MustCompile(`(?i)["']?` + secretKey + `["']?\s*[:=]\s*'(?P<secret>[^']*)'`),
+		},
+		{
+			// key: value in YAML and key = value in INI files
+			Name:    "unquoted-secret",
+			Pattern: regexp.MustCompile(`(?i)^\s*(?:-\s+)?` + secretKey + `\s*[:=][ \t]*(?P<secret>[^\s"'|>].*?)\s*$`),
+		},
+		{
+			Name:    "authorization-header",
+			Pattern: regexp.MustCompile(`(?i)\bauthorization\s*:\s*(?:bearer|basic|token)\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`),
+		},
+		{
+			Name:    "bearer-token",
+			Pattern: regexp.MustCompile(`(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]{8,}=*)`),
+		},
+	}
+}
+
+// ParseRule returns a rule for a user supplied regular expression.
+func ParseRule(expression string) (Rule, error) {
+	pattern, err := regexp.Compile(expression)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid redaction rule %q: %v", expression, err)
+	}
+	return Rule{Name: expression, Pattern: pattern}, nil
+}
+
+// Redactor applies a set of rules to artifacts. It is safe for concurrent
+// use.
+type Redactor struct {
+	rules []Rule
+}
+
+func New(rules ...Rule) *Redactor {
+	return &Redactor{rules: rules}
+}
+
+// NewWriter returns a writer that redacts everything written to it before
+// passing it on to w. Redaction is line based, so output is held back
+// until a line is complete or the writer is closed. Gzip compressed content
+// is redacted decompressed. Other content that looks binary is passed
+// through untouched, which the writer reports.
+func (r *Redactor) NewWriter(w io.WriteCloser) *Writer {
+	writer := &Writer{redactor: r}
+	writer.lines = linewriter.New(w, writer.redact)
+	return writer
+}
+
+// Redact returns the contents with secrets removed and the number of
+// secrets that were found.
+func (r *Redactor) Redact(contents []byte) ([]byte, int) {
+	var buffer bytes.Buffer
+	writer := r.NewWriter(nopCloser{&buffer})
+	writer.Write(contents)
+	writer.Close()
+	return buffer.Bytes(), writer.Redactions()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+var (
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+	privateKeyEnd   = regexp.MustCompile(`-----END [A-Z0-9 ]*PRIVATE KEY-----`)
+)
+
+type Writer struct {
+	redactor *Redactor
+	lines    *linewriter.Writer
+	inKey    bool
+	// keyRedacted is set once the body of the current private key block
+	// has been replaced.
+	keyRedacted bool
+	redactions  atomic.Int64
+}
+
+// Redactions returns the number of secrets removed so far.
+func (w *Writer) Redactions() int {
+	return int(w.redactions.Load())
+}
+
+// Binary returns whether the content looked binary, and so was not
+// redacted. It is only final once the writer is closed.
+func (w *Writer) Binary() bool {
+	return w.lines.Binary()
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.lines.Write(p)
+}
+
+// Close redacts and writes any incomplete last line, then closes the
+// underlying writer.
+func (w *Writer) Close() error {
+	return w.lines.Close()
+}
+
+func (w *Writer) redact(line []byte) []byte {
+	line, count := w.redactLine(line)
+	w.redactions.Add(int64(count))
+	return line
+}
+
+// redactLine removes the body of private key blocks spanning several
+// lines, which no single line rule can match, before applying the rules.
+// The first line of the body is replaced by the placeholder with the same
+// indentation, so that keys embedded in YAML stay valid.
+func (w *Writer) redactLine(line []byte) ([]byte, int) {
+	if w.inKey {
+		if !privateKeyEnd.Match(line) {
+			if w.keyRedacted {
+				return nil, 0
+			}
+			w.keyRedacted = true
+			indented := append([]byte{}, line[:len(line)-len(bytes.TrimLeft(line, " \t"))]...)
+			return append(append(indented, Placeholder...), '\n'), 1
+		}
+		w.inKey = false
+	} else if loc := privateKeyBegin.FindIndex(line); loc != nil && !privateKeyEnd.Match(line[loc[1]:]) {
+		w.inKey = true
+		w.keyRedacted = false
+		return line, 0
+	}
+
+	total := 0
+	for _, rule := range w.redactor.rules {
+		var count int
+		line, count = rule.redact(line)
+		total += count
+	}
+	return line, total
+}
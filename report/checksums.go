@@ -0,0 +1,195 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/keyfile"
+)
+
+const (
+	// ChecksumsFilename lists the SHA-256 of every other file in a report,
+	// in the format of sha256sum.
+	ChecksumsFilename = "SHA256SUMS"
+	// SignatureFilename holds the base64 encoded ed25519 signature of the
+	// checksums file, if the report was signed.
+	SignatureFilename = "SHA256SUMS.sig"
+)
+
+// FormatChecksums renders checksums, keyed by file name, like sha256sum
+// does, sorted by name.
+func FormatChecksums(checksums map[string]string) []byte {
+	var buffer bytes.Buffer
+	for _, name := range slices.Sorted(maps.Keys(checksums)) {
+		fmt.Fprintf(&buffer, "%s  %s\n", checksums[name], name)
+	}
+	return buffer.Bytes()
+}
+
+// ParseChecksums reads a checksums file written by FormatChecksums.
+func ParseChecksums(contents []byte) (map[string]string, error) {
+	checksums := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		sum, name, found := strings.Cut(scanner.Text(), "  ")
+		if _, err := hex.DecodeString(sum); !found || err != nil || len(sum) != sha256.Size*2 || name == "" {
+			return nil, fmt.Errorf("%s line %d is malformed", ChecksumsFilename, line)
+		}
+		checksums[name] = sum
+	}
+
+	return checksums, scanner.Err()
+}
+
+// Sign returns the signature file contents for the checksums file.
+func Sign(key ed25519.PrivateKey, checksums []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, checksums)) + "\n")
+}
+
+// LoadSigningKey reads a PEM encoded ed25519 private key, as written by
+// `openssl genpkey -algorithm ed25519`.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	key, err := keyfile.LoadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an ed25519 key", path)
+	}
+
+	return privateKey, nil
+}
+
+// LoadVerifyingKey reads a PEM encoded ed25519 public key, as written by
+// `openssl pkey -pubout`.
+func LoadVerifyingKey(path string) (ed25519.PublicKey, error) {
+	key, err := keyfile.LoadPublicKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an ed25519 key", path)
+	}
+
+	return publicKey, nil
+}
+
+// Verification is the outcome of checking a report against its checksums.
+type Verification struct {
+	Verified   []string
+	Missing    []string
+	Modified   []string
+	Unexpected []string
+	// Signed is set when the report carries a signature.
+	Signed bool
+	// SignatureValid is set when the signature was checked and matches.
+	SignatureValid bool
+	// SignatureError explains why a required signature check failed.
+	SignatureError string
+}
+
+// OK reports whether every file is present and unmodified, and whether the
+// signature is valid if it had to be checked.
+func (v Verification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Modified) == 0 && len(v.Unexpected) == 0 && v.SignatureError == ""
+}
+
+// ErrNoChecksums is returned for reports that carry no checksums file.
+var ErrNoChecksums = errors.New("report has no " + ChecksumsFilename + ", it was created by an older version of dontpanic or altered")
+
+// Verify checks every file in an uncompressed report archive against the
+// report's checksums. When a public key is given, the checksums must also
+// be signed with the matching private key.
+func Verify(r io.Reader, publicKey ed25519.PublicKey) (Verification, error) {
+	var (
+		actual        = map[string]string{}
+		checksumsFile []byte
+		signature     []byte
+	)
+
+	err := Walk(r, func(name string, contents io.Reader) error {
+		switch name {
+		case ChecksumsFilename:
+			var err error
+			checksumsFile, err = io.ReadAll(contents)
+			return err
+		case SignatureFilename:
+			var err error
+			signature, err = io.ReadAll(contents)
+			return err
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, contents); err != nil {
+			return fmt.Errorf("archive is truncated or corrupt: %w", err)
+		}
+		actual[name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return Verification{}, err
+	}
+
+	if checksumsFile == nil {
+		return Verification{}, ErrNoChecksums
+	}
+
+	expected, err := ParseChecksums(checksumsFile)
+	if err != nil {
+		return Verification{}, err
+	}
+
+	verification := Verification{Signed: signature != nil}
+	for _, name := range slices.Sorted(maps.Keys(expected)) {
+		sum, found := actual[name]
+		switch {
+		case !found:
+			verification.Missing = append(verification.Missing, name)
+		case sum != expected[name]:
+			verification.Modified = append(verification.Modified, name)
+		default:
+			verification.Verified = append(verification.Verified, name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(actual)) {
+		if _, found := expected[name]; !found {
+			verification.Unexpected = append(verification.Unexpected, name)
+		}
+	}
+
+	if publicKey != nil {
+		verification.SignatureError = checkSignature(publicKey, checksumsFile, signature)
+		verification.SignatureValid = verification.SignatureError == ""
+	}
+
+	return verification, nil
+}
+
+func checkSignature(publicKey ed25519.PublicKey, checksums, signature []byte) string {
+	if signature == nil {
+		return "report is not signed"
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(publicKey, checksums, decoded) {
+		return "signature does not match the checksums or the public key"
+	}
+
+	return ""
+}
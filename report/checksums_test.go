@@ -0,0 +1,176 @@
+package report_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"code.cloudfoundry.org/dontpanic/archiver"
+	"code.cloudfoundry.org/dontpanic/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Checksums", func() {
+	It("round trips through the sha256sum format", func() {
+		checksums := map[string]string{
+			"b/file.log": sha256Hex("b"),
+			"a.log":      sha256Hex("a"),
+		}
+
+		formatted := report.FormatChecksums(checksums)
+		Expect(string(formatted)).To(Equal(sha256Hex("a") + "  a.log\n" + sha256Hex("b") + "  b/file.log\n"))
+		Expect(report.ParseChecksums(formatted)).To(Equal(checksums))
+	})
+
+	It("rejects malformed lines", func() {
+		_, err := report.ParseChecksums([]byte("nothex  a.log\n"))
+		Expect(err).To(MatchError("SHA256SUMS line 1 is malformed"))
+	})
+
+	Describe("Verify", func() {
+		var (
+			files      map[string]string
+			checksums  map[string]string
+			signature  []byte
+			privateKey ed25519.PrivateKey
+			publicKey  ed25519.PublicKey
+		)
+
+		BeforeEach(func() {
+			var err error
+			publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			files = map[string]string{"dontpanic.log": "log", "sub/date.log": "today"}
+			checksums = map[string]string{"dontpanic.log": sha256Hex("log"), "sub/date.log": sha256Hex("today")}
+			signature = nil
+		})
+
+		verify := func(key ed25519.PublicKey) (report.Verification, error) {
+			archive := map[string]string{}
+			for name, contents := range files {
+				archive[name] = contents
+			}
+			if checksums != nil {
+				archive[report.ChecksumsFilename] = string(report.FormatChecksums(checksums))
+			}
+			if signature != nil {
+				archive[report.SignatureFilename] = string(signature)
+			}
+			return report.Verify(uncompressed(buildArchive(archive)), key)
+		}
+
+		It("accepts an intact report", func() {
+			verification, err := verify(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.OK()).To(BeTrue())
+			Expect(verification.Verified).To(Equal([]string{"dontpanic.log", "sub/date.log"}))
+			Expect(verification.Signed).To(BeFalse())
+		})
+
+		It("flags modified files", func() {
+			files["sub/date.log"] = "yesterday"
+
+			verification, err := verify(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.OK()).To(BeFalse())
+			Expect(verification.Modified).To(Equal([]string{"sub/date.log"}))
+		})
+
+		It("flags missing files", func() {
+			delete(files, "dontpanic.log")
+
+			verification, err := verify(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.OK()).To(BeFalse())
+			Expect(verification.Missing).To(Equal([]string{"dontpanic.log"}))
+		})
+
+		It("flags files that were added", func() {
+			files["extra.txt"] = "surprise"
+
+			verification, err := verify(nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(verification.OK()).To(BeFalse())
+			Expect(verification.Unexpected).To(Equal([]string{"extra.txt"}))
+		})
+
+		It("fails for reports without checksums", func() {
+			checksums = nil
+
+			_, err := verify(nil)
+			Expect(err).To(MatchError(report.ErrNoChecksums))
+		})
+
+		It("fails for truncated archives", func() {
+			archive := buildArchive(map[string]string{"dontpanic.log": string(make([]byte, 10000))})
+			_, err := report.Verify(uncompressed(archive[:len(archive)/2]), nil)
+			Expect(err).To(MatchError(ContainSubstring("archive is truncated or corrupt")))
+		})
+
+		When("a public key is given", func() {
+			It("accepts a valid signature", func() {
+				signature = report.Sign(privateKey, report.FormatChecksums(checksums))
+
+				verification, err := verify(publicKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(verification.OK()).To(BeTrue())
+				Expect(verification.Signed).To(BeTrue())
+				Expect(verification.SignatureValid).To(BeTrue())
+			})
+
+			It("rejects checksums that were altered after signing", func() {
+				signature = report.Sign(privateKey, report.FormatChecksums(checksums))
+				files["sub/date.log"] = "yesterday"
+				checksums["sub/date.log"] = sha256Hex("yesterday")
+
+				verification, err := verify(publicKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(verification.OK()).To(BeFalse())
+				Expect(verification.SignatureError).To(Equal("signature does not match the checksums or the public key"))
+			})
+
+			It("rejects unsigned reports", func() {
+				verification, err := verify(publicKey)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(verification.OK()).To(BeFalse())
+				Expect(verification.SignatureError).To(Equal("report is not signed"))
+			})
+		})
+	})
+})
+
+func sha256Hex(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildArchive returns a gzip compressed report archive holding the given
+// files.
+func buildArchive(files map[string]string) []byte {
+	var buffer bytes.Buffer
+	writer := archiver.NewWriter(&buffer, "os-report")
+	writer.SetSpoolDir(GinkgoT().TempDir())
+
+	for name, contents := range files {
+		entry, err := writer.Create(name)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = io.WriteString(entry, contents)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Close()).To(Succeed())
+	}
+
+	Expect(writer.Close()).To(Succeed())
+	return buffer.Bytes()
+}
+
+func uncompressed(archive []byte) io.Reader {
+	reader, err := gzip.NewReader(bytes.NewReader(archive))
+	Expect(err).NotTo(HaveOccurred())
+	return reader
+}
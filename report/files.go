@@ -0,0 +1,116 @@
+package report
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Read reads the files matching any of the patterns, as understood by
+// path.Match, from the report archive or uncompressed report directory at
+// path. Encrypted archives are decrypted with the given private key file.
+func Read(path, keyPath string, patterns []string) (map[string][]byte, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return ReadDir(path, patterns)
+	}
+
+	archive, err := Open(path, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	return ReadFiles(archive, patterns)
+}
+
+// ReadFiles reads the files matching any of the patterns from an
+// uncompressed report archive. Rotated logs compressed with gzip are
+// decompressed.
+func ReadFiles(r io.Reader, patterns []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	err := Walk(r, func(name string, contents io.Reader) error {
+		return readFile(files, patterns, name, contents)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ReadDir reads the files matching any of the patterns from a report
+// directory that has not been archived.
+func ReadDir(dir string, patterns []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return readFile(files, patterns, filepath.ToSlash(relPath), file)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func readFile(files map[string][]byte, patterns []string, name string, contents io.Reader) error {
+	if !Matches(patterns, name) {
+		return nil
+	}
+
+	data, err := io.ReadAll(contents)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(name, ".gz") {
+		if uncompressed, err := gunzip(data); err == nil {
+			data = uncompressed
+		}
+	}
+
+	files[name] = data
+	return nil
+}
+
+// Matches returns whether name matches any of the patterns.
+func Matches(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
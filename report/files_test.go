@@ -0,0 +1,72 @@
+package report_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Files", func() {
+	Describe("ReadFiles", func() {
+		It("only reads the files matching the patterns", func() {
+			archive := buildArchive(map[string]string{
+				"df.log":           "df",
+				"syslogs/syslog":   "syslog",
+				"syslogs/syslog.2": "rotated",
+				"lsof.log":         "lsof",
+			})
+
+			files, err := report.ReadFiles(uncompressed(archive), []string{"df.log", "syslogs/*"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(Equal(map[string][]byte{
+				"df.log":           []byte("df"),
+				"syslogs/syslog":   []byte("syslog"),
+				"syslogs/syslog.2": []byte("rotated"),
+			}))
+		})
+
+		It("decompresses rotated logs", func() {
+			archive := buildArchive(map[string]string{"syslogs/syslog.2.gz": string(gzipped("rotated"))})
+
+			files, err := report.ReadFiles(uncompressed(archive), []string{"syslogs/*"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveKeyWithValue("syslogs/syslog.2.gz", []byte("rotated")))
+		})
+	})
+
+	Describe("Read", func() {
+		It("reads uncompressed report directories", func() {
+			dir := GinkgoT().TempDir()
+			Expect(os.MkdirAll(filepath.Join(dir, "garden"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "garden", "garden.log"), []byte("garden"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "lsof.log"), []byte("lsof"), 0644)).To(Succeed())
+
+			files, err := report.Read(dir, "", []string{"garden/*"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(Equal(map[string][]byte{"garden/garden.log": []byte("garden")}))
+		})
+
+		It("reads report archives", func() {
+			archivePath := filepath.Join(GinkgoT().TempDir(), "os-report.tar.gz")
+			Expect(os.WriteFile(archivePath, buildArchive(map[string]string{"a.log": "a", "b.log": "b"}), 0644)).To(Succeed())
+
+			files, err := report.Read(archivePath, "", []string{"a.log"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(Equal(map[string][]byte{"a.log": []byte("a")}))
+		})
+	})
+})
+
+func gzipped(contents string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(contents))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+	return buffer.Bytes()
+}
@@ -0,0 +1,89 @@
+// Package report reads report archives produced by dontpanic.
+package report
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/dontpanic/encrypt"
+)
+
+// Open returns a reader for the uncompressed contents of the archive at
+// path. Encrypted archives are decrypted with the given private key file.
+func Open(path, keyPath string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var compressed io.Reader = file
+	if strings.HasSuffix(path, encrypt.Extension) || keyPath != "" {
+		if keyPath == "" {
+			file.Close()
+			return nil, fmt.Errorf("%s is encrypted, please pass the private key with --key", path)
+		}
+
+		key, err := encrypt.LoadPrivateKey(keyPath)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		compressed, err = encrypt.NewReader(file, key)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	uncompressed, err := gzip.NewReader(compressed)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a gzip compressed archive: %w", path, err)
+	}
+
+	return readCloser{Reader: uncompressed, closer: file}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r readCloser) Close() error {
+	return r.closer.Close()
+}
+
+// Walk calls fn for every regular file in an uncompressed report archive,
+// with its slash separated path relative to the top-level directory of the
+// report.
+func Walk(r io.Reader, fn func(name string, contents io.Reader) error) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("archive is truncated or corrupt: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		_, name, found := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		if !found || name == "" {
+			continue
+		}
+
+		if err := fn(name, archive); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package report_test
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/encrypt"
+	"code.cloudfoundry.org/dontpanic/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+	})
+
+	walk := func(r io.Reader) map[string]string {
+		files := map[string]string{}
+		Expect(report.Walk(r, func(name string, contents io.Reader) error {
+			data, err := io.ReadAll(contents)
+			files[name] = string(data)
+			return err
+		})).To(Succeed())
+		return files
+	}
+
+	Describe("Walk", func() {
+		It("visits the files relative to the report's top-level directory", func() {
+			archive := buildArchive(map[string]string{"a.log": "a", "sub/b.log": "b"})
+			Expect(walk(uncompressed(archive))).To(Equal(map[string]string{"a.log": "a", "sub/b.log": "b"}))
+		})
+	})
+
+	Describe("Open", func() {
+		var archivePath string
+
+		BeforeEach(func() {
+			archivePath = filepath.Join(tmpDir, "os-report.tar.gz")
+			Expect(os.WriteFile(archivePath, buildArchive(map[string]string{"a.log": "a"}), 0644)).To(Succeed())
+		})
+
+		It("decompresses the archive", func() {
+			reader, err := report.Open(archivePath, "")
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			Expect(walk(reader)).To(HaveKeyWithValue("a.log", "a"))
+		})
+
+		It("fails for files that are not archives", func() {
+			Expect(os.WriteFile(archivePath, []byte("plain text"), 0644)).To(Succeed())
+
+			_, err := report.Open(archivePath, "")
+			Expect(err).To(MatchError(ContainSubstring("is not a gzip compressed archive")))
+		})
+
+		When("the archive is encrypted", func() {
+			var keyPath, encryptedPath string
+
+			BeforeEach(func() {
+				privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+				der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+				Expect(err).NotTo(HaveOccurred())
+				keyPath = filepath.Join(tmpDir, "key")
+				Expect(os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)).To(Succeed())
+
+				encryptedPath = archivePath + encrypt.Extension
+				out, err := os.Create(encryptedPath)
+				Expect(err).NotTo(HaveOccurred())
+				defer out.Close()
+				encrypter, err := encrypt.NewWriter(out, privateKey.PublicKey())
+				Expect(err).NotTo(HaveOccurred())
+				plain, err := os.ReadFile(archivePath)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = encrypter.Write(plain)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(encrypter.Close()).To(Succeed())
+			})
+
+			It("decrypts it with the given key", func() {
+				reader, err := report.Open(encryptedPath, keyPath)
+				Expect(err).NotTo(HaveOccurred())
+				defer reader.Close()
+
+				Expect(walk(reader)).To(HaveKeyWithValue("a.log", "a"))
+			})
+
+			It("asks for a key", func() {
+				_, err := report.Open(encryptedPath, "")
+				Expect(err).To(MatchError(ContainSubstring("is encrypted, please pass the private key with --key")))
+			})
+		})
+	})
+})
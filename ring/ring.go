@@ -0,0 +1,105 @@
+// Package ring keeps the most recent snapshot archives in a directory,
+// removing the oldest ones as new ones are added.
+package ring
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const stagingDir = ".staging"
+
+type Ring struct {
+	dir  string
+	keep int
+}
+
+// New returns a ring keeping up to keep snapshots in dir, creating it if
+// needed.
+func New(dir string, keep int) (Ring, error) {
+	if keep < 1 {
+		return Ring{}, errors.New("the ring buffer must keep at least one snapshot")
+	}
+
+	r := Ring{dir: dir, keep: keep}
+	if err := os.MkdirAll(r.StagingDir(), 0700); err != nil {
+		return Ring{}, err
+	}
+
+	return r, nil
+}
+
+// RemoveStaged removes snapshots left half-written in the staging
+// directory, e.g. by a process that was killed.
+func (r Ring) RemoveStaged() error {
+	entries, err := os.ReadDir(r.StagingDir())
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(r.StagingDir(), entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Ring) Dir() string {
+	return r.dir
+}
+
+// StagingDir is where snapshots are created until they are complete, so
+// that the ring never holds a partial snapshot.
+func (r Ring) StagingDir() string {
+	return filepath.Join(r.dir, stagingDir)
+}
+
+// Pattern is a glob matching the snapshots in the ring.
+func (r Ring) Pattern() string {
+	return filepath.Join(r.dir, "*.tar.gz*")
+}
+
+// Add moves a complete snapshot archive into the ring and removes the
+// oldest snapshots beyond the limit.
+func (r Ring) Add(archivePath string) error {
+	if err := os.Rename(archivePath, filepath.Join(r.dir, filepath.Base(archivePath))); err != nil {
+		return err
+	}
+
+	snapshots, err := r.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots[:max(len(snapshots)-r.keep, 0)] {
+		if err := os.Remove(snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshots returns the paths of the snapshots in the ring, oldest first.
+// Snapshot names end in the time they were taken, so the oldest sort
+// first.
+func (r Ring) Snapshots() ([]string, error) {
+	matches, err := filepath.Glob(r.Pattern())
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []string{}
+	for _, match := range matches {
+		if !strings.HasPrefix(filepath.Base(match), ".") {
+			snapshots = append(snapshots, match)
+		}
+	}
+
+	slices.Sort(snapshots)
+	return snapshots, nil
+}
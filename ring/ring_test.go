@@ -0,0 +1,80 @@
+package ring_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dontpanic/ring"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Ring", func() {
+	var (
+		dir    string
+		buffer ring.Ring
+	)
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "ring")
+
+		var err error
+		buffer, err = ring.New(dir, 2)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	stage := func(name string) string {
+		path := filepath.Join(buffer.StagingDir(), name)
+		Expect(os.WriteFile(path, []byte(name), 0644)).To(Succeed())
+		return path
+	}
+
+	It("creates the directory", func() {
+		Expect(buffer.StagingDir()).To(BeADirectory())
+		Expect(buffer.Dir()).To(Equal(dir))
+	})
+
+	It("moves complete snapshots into the ring", func() {
+		staged := stage("os-report-host-2026-10-01-10-00-00.000000000.tar.gz")
+		Expect(buffer.Add(staged)).To(Succeed())
+
+		Expect(staged).NotTo(BeAnExistingFile())
+		Expect(buffer.Snapshots()).To(Equal([]string{filepath.Join(dir, "os-report-host-2026-10-01-10-00-00.000000000.tar.gz")}))
+	})
+
+	It("keeps only the most recent snapshots", func() {
+		for _, name := range []string{
+			"os-report-host-2026-10-01-10-00-00.000000000.tar.gz",
+			"os-report-host-2026-10-01-10-01-00.000000000.tar.gz",
+			"os-report-host-2026-10-01-10-02-00.000000000.tar.gz.enc",
+		} {
+			Expect(buffer.Add(stage(name))).To(Succeed())
+		}
+
+		Expect(buffer.Snapshots()).To(Equal([]string{
+			filepath.Join(dir, "os-report-host-2026-10-01-10-01-00.000000000.tar.gz"),
+			filepath.Join(dir, "os-report-host-2026-10-01-10-02-00.000000000.tar.gz.enc"),
+		}))
+	})
+
+	It("does not count other files as snapshots", func() {
+		Expect(os.WriteFile(filepath.Join(dir, "anonymize-mapping.json"), []byte("{}"), 0600)).To(Succeed())
+		stage("os-report-host-2026-10-01-10-00-00.000000000.tar.gz")
+
+		Expect(buffer.Snapshots()).To(BeEmpty())
+	})
+
+	It("removes half-written snapshots on request", func() {
+		staged := stage("os-report-host-2026-10-01-10-00-00.000000000.tar.gz")
+		Expect(os.Mkdir(filepath.Join(buffer.StagingDir(), "os-report-host-2026-10-01-10-00-00.000000000"), 0755)).To(Succeed())
+
+		Expect(buffer.RemoveStaged()).To(Succeed())
+		Expect(staged).NotTo(BeAnExistingFile())
+		Expect(buffer.StagingDir()).To(BeADirectory())
+	})
+
+	It("must keep at least one snapshot", func() {
+		_, err := ring.New(dir, 0)
+		Expect(err).To(MatchError("the ring buffer must keep at least one snapshot"))
+	})
+})
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/logrusorgru/aurora"
+	"golang.org/x/sys/unix"
+
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	"code.cloudfoundry.org/dontpanic/osreporter"
+	"code.cloudfoundry.org/dontpanic/server"
+)
+
+type ServeCommand struct {
+	Socket  string `long:"socket" default:"/var/vcap/sys/run/dontpanic/dontpanic.sock" description:"Unix socket to listen on, accessible to root only"`
+	Address string `long:"address" description:"Loopback address and port to listen on instead of the socket, e.g. 127.0.0.1:7780 (any local user can then create reports)"`
+
+	options *Options
+}
+
+func (c *ServeCommand) Execute([]string) error {
+	checkIsRoot()
+	checkIsNotBpm()
+	checkGardenLogLevel()
+
+	listener, err := c.listen()
+	if err != nil {
+		return err
+	}
+
+	s := server.New(serveBackend{newReportMaker(*c.options, filepath.Join(c.options.OutputDir, "anonymize-mapping.json"))})
+	httpServer := &http.Server{Handler: s.Handler()}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		<-signals
+		httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Println(aurora.Bold(fmt.Sprintf("Serving the dontpanic API on %s", listener.Addr())))
+
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	fmt.Println(aurora.Bold("Waiting for the report being created to complete"))
+	s.Wait()
+	return nil
+}
+
+func (c *ServeCommand) listen() (net.Listener, error) {
+	if c.Address != "" {
+		host, _, err := net.SplitHostPort(c.Address)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("refusing to listen on %s: the API has no authentication, use a loopback address", c.Address)
+		}
+		return net.Listen("tcp", c.Address)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Socket), 0755); err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(c.Socket); err == nil && info.Mode().Type() == os.ModeSocket {
+		os.Remove(c.Socket)
+	}
+
+	// Create the socket accessible to root only, as access to it is all it
+	// takes to use the API
+	umask := unix.Umask(0177)
+	defer unix.Umask(umask)
+	return net.Listen("unix", c.Socket)
+}
+
+// serveBackend creates the reports requested through the API as the global
+// options say, writing no progress.
+type serveBackend struct {
+	maker *reportMaker
+}
+
+func (b serveBackend) Collectors() []collectorspec.Spec {
+	return b.maker.collection.collectors
+}
+
+func (b serveBackend) Prepare(request server.Request) (osreporter.Reporter, error) {
+	opts := b.maker.collection.opts
+	if request.Profile == "" {
+		request.Profile = opts.Profile
+	}
+
+	selection, err := b.maker.collection.selection(request.Profile, request.Include, request.Only)
+	if err != nil {
+		return osreporter.Reporter{}, err
+	}
+
+	osReporter, err := b.maker.prepare(io.Discard, selection)
+	if err != nil {
+		return osreporter.Reporter{}, err
+	}
+	osReporter.SetMetadata("requested_via", "api")
+	return osReporter, nil
+}
+
+func (b serveBackend) Finish() {
+	b.maker.saveMapping(io.Discard)
+}
@@ -0,0 +1,377 @@
+// Package server provides an HTTP API to list collectors, create reports
+// and download them, for automation that cannot run dontpanic as root on
+// every cell itself. It does no authentication: it is meant to be served on
+// a unix socket only root can access.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	"code.cloudfoundry.org/dontpanic/osreporter"
+)
+
+// DefaultMaxReports is the number of reports the server remembers. Older
+// reports are forgotten and their archives removed.
+const DefaultMaxReports = 50
+
+const (
+	StateRunning  = "running"
+	StateComplete = "complete"
+	StateFailed   = "failed"
+
+	// CollectorPending and CollectorRunning are the states of collectors
+	// that have not finished. Finished collectors are in the state of their
+	// outcome.
+	CollectorPending = "pending"
+	CollectorRunning = "running"
+)
+
+// Backend creates the reports the server is asked for.
+type Backend interface {
+	Collectors() []collectorspec.Spec
+	// Prepare returns a reporter for the requested report, with all its
+	// collectors registered.
+	Prepare(request Request) (osreporter.Reporter, error)
+	// Finish is called after each report has run, whether it succeeded or
+	// not.
+	Finish()
+}
+
+// Request selects the collectors of a report as the command line options
+// of the same names do. An empty profile selects the default one.
+type Request struct {
+	Profile string   `json:"profile"`
+	Include []string `json:"include"`
+	Only    []string `json:"only"`
+}
+
+// Status describes a report and the progress of each of its collectors.
+type Status struct {
+	ID         string            `json:"id"`
+	Request    Request           `json:"request"`
+	State      string            `json:"state"`
+	Error      string            `json:"error,omitempty"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time,omitzero"`
+	Archive    string            `json:"archive"`
+	Collectors []CollectorStatus `json:"collectors"`
+}
+
+type CollectorStatus struct {
+	Name     string  `json:"name"`
+	State    string  `json:"state"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+}
+
+// Collector describes a collector reports can include.
+type Collector struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Categories  []string `json:"categories"`
+	Timeout     string   `json:"timeout"`
+}
+
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Server creates one report at a time.
+type Server struct {
+	backend    Backend
+	maxReports int
+	mutex      sync.Mutex
+	reports    []*report
+	nextID     int
+	running    bool
+	runs       sync.WaitGroup
+}
+
+func New(backend Backend) *Server {
+	return &Server{backend: backend, maxReports: DefaultMaxReports, nextID: 1}
+}
+
+// SetMaxReports sets how many reports are remembered, and so how many
+// archives are kept.
+func (s *Server) SetMaxReports(maxReports int) {
+	s.maxReports = maxReports
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collectors", s.listCollectors)
+	mux.HandleFunc("GET /profiles", s.listProfiles)
+	mux.HandleFunc("GET /reports", s.listReports)
+	mux.HandleFunc("POST /reports", s.createReport)
+	mux.HandleFunc("GET /reports/{id}", s.getReport)
+	mux.HandleFunc("GET /reports/{id}/archive", s.downloadArchive)
+	return mux
+}
+
+// Wait blocks until no report is being created.
+func (s *Server) Wait() {
+	s.runs.Wait()
+}
+
+func (s *Server) listCollectors(w http.ResponseWriter, _ *http.Request) {
+	collectors := []Collector{}
+	for _, spec := range s.backend.Collectors() {
+		collectors = append(collectors, Collector{
+			Name:        spec.Name,
+			Description: spec.Description,
+			Type:        spec.Type,
+			Categories:  spec.Categories,
+			Timeout:     spec.EffectiveTimeout().String(),
+		})
+	}
+	writeJSON(w, http.StatusOK, collectors)
+}
+
+func (s *Server) listProfiles(w http.ResponseWriter, _ *http.Request) {
+	profiles := []Profile{}
+	for _, profile := range collectorspec.Profiles {
+		profiles = append(profiles, Profile{Name: profile.Name, Description: profile.Description})
+	}
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+func (s *Server) listReports(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	reports := append([]*report{}, s.reports...)
+	s.mutex.Unlock()
+
+	statuses := []Status{}
+	for _, report := range reports {
+		statuses = append(statuses, report.status())
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *Server) createReport(w http.ResponseWriter, r *http.Request) {
+	var request Request
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+			return
+		}
+	}
+
+	if !s.reserve() {
+		writeError(w, http.StatusConflict, errors.New("a report is already being created"))
+		return
+	}
+
+	// Preparing measures the collected files for the space estimate, so it
+	// is done without holding the lock the other requests need
+	reporter, err := s.backend.Prepare(request)
+	if err != nil {
+		s.release()
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	report := s.add(request, reporter)
+	go s.run(report, reporter)
+
+	w.Header().Set("Location", "/reports/"+report.id)
+	writeJSON(w, http.StatusAccepted, report.status())
+}
+
+// reserve takes the slot of the report being created, if it is free.
+func (s *Server) reserve() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.running {
+		return false
+	}
+	s.running = true
+	s.runs.Add(1)
+	return true
+}
+
+func (s *Server) release() {
+	s.mutex.Lock()
+	s.running = false
+	s.mutex.Unlock()
+	s.runs.Done()
+}
+
+// add records a new report, forgetting the oldest reports and removing
+// their archives when there are too many.
+func (s *Server) add(request Request, reporter osreporter.Reporter) *report {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := newReport(strconv.Itoa(s.nextID), request, reporter)
+	s.nextID++
+	s.reports = append(s.reports, report)
+
+	if excess := len(s.reports) - s.maxReports; excess > 0 {
+		for _, forgotten := range s.reports[:excess] {
+			os.Remove(forgotten.archivePath)
+		}
+		s.reports = s.reports[excess:]
+	}
+	return report
+}
+
+func (s *Server) run(report *report, reporter osreporter.Reporter) {
+	defer s.release()
+
+	reporter.SetObserver(report)
+	err := reporter.Run()
+	s.backend.Finish()
+	report.finish(err)
+}
+
+func (s *Server) find(w http.ResponseWriter, r *http.Request) (*report, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, report := range s.reports {
+		if report.id == r.PathValue("id") {
+			return report, true
+		}
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Errorf("no report %q", r.PathValue("id")))
+	return nil, false
+}
+
+func (s *Server) getReport(w http.ResponseWriter, r *http.Request) {
+	if report, found := s.find(w, r); found {
+		writeJSON(w, http.StatusOK, report.status())
+	}
+}
+
+func (s *Server) downloadArchive(w http.ResponseWriter, r *http.Request) {
+	report, found := s.find(w, r)
+	if !found {
+		return
+	}
+
+	status := report.status()
+	if status.State != StateComplete {
+		writeError(w, http.StatusConflict, fmt.Errorf("report %s is %s", status.ID, status.State))
+		return
+	}
+
+	archive, err := os.Open(report.archivePath)
+	if err != nil {
+		writeError(w, http.StatusGone, fmt.Errorf("cannot open the archive of report %s: %w", status.ID, err))
+		return
+	}
+	defer archive.Close()
+
+	contentType := "application/gzip"
+	if !strings.HasSuffix(status.Archive, ".gz") {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", status.Archive))
+	io.Copy(w, archive)
+}
+
+// report follows the progress of a report being created.
+type report struct {
+	id          string
+	archivePath string
+	mutex       sync.Mutex
+	current     Status
+}
+
+func newReport(id string, request Request, reporter osreporter.Reporter) *report {
+	r := &report{
+		id:          id,
+		archivePath: reporter.ArchivePath(),
+		current: Status{
+			ID:         id,
+			Request:    request,
+			State:      StateRunning,
+			StartTime:  time.Now(),
+			Archive:    filepath.Base(reporter.ArchivePath()),
+			Collectors: []CollectorStatus{},
+		},
+	}
+
+	for _, name := range reporter.CollectorNames() {
+		r.current.Collectors = append(r.current.Collectors, CollectorStatus{Name: name, State: CollectorPending})
+	}
+	return r
+}
+
+func (r *report) status() Status {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	status := r.current
+	status.Collectors = append([]CollectorStatus{}, r.current.Collectors...)
+	return status
+}
+
+func (r *report) CollectorStarted(name string) {
+	r.update(name, func(collector *CollectorStatus) {
+		collector.State = CollectorRunning
+	})
+}
+
+func (r *report) CollectorFinished(result osreporter.CollectorResult) {
+	r.update(result.Name, func(collector *CollectorStatus) {
+		collector.State = string(result.Outcome)
+		collector.Error = strings.TrimSpace(result.Error)
+		collector.Duration = result.Duration
+	})
+}
+
+func (r *report) update(name string, change func(*CollectorStatus)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i := range r.current.Collectors {
+		if r.current.Collectors[i].Name == name {
+			change(&r.current.Collectors[i])
+			return
+		}
+	}
+}
+
+func (r *report) finish(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.current.EndTime = time.Now()
+	r.current.State = StateComplete
+	if err != nil {
+		r.current.State = StateFailed
+		r.current.Error = err.Error()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,304 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	"code.cloudfoundry.org/dontpanic/osreporter"
+	"code.cloudfoundry.org/dontpanic/osreporter/osreporterfakes"
+	"code.cloudfoundry.org/dontpanic/server"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeBackend struct {
+	mutex      sync.Mutex
+	reportDir  string
+	collectors []*osreporterfakes.FakeCollector
+	prepareErr error
+	// preparing, when set, is sent to when Prepare is called, which then
+	// blocks until it is closed.
+	preparing chan struct{}
+	requests  []server.Request
+	finished  int
+}
+
+func (b *fakeBackend) Collectors() []collectorspec.Spec {
+	return []collectorspec.Spec{{Name: "Date", Description: "The date", Type: collectorspec.TypeCommand, Categories: []string{"basic"}, Timeout: time.Minute}}
+}
+
+func (b *fakeBackend) Prepare(request server.Request) (osreporter.Reporter, error) {
+	if b.preparing != nil {
+		b.preparing <- struct{}{}
+		<-b.preparing
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.requests = append(b.requests, request)
+	if b.prepareErr != nil {
+		return osreporter.Reporter{}, b.prepareErr
+	}
+
+	reporter := osreporter.New(b.reportDir, io.Discard)
+	reporter.SetStreaming(true)
+	reporter.RegisterCollector("collector-one", b.collectors[0])
+	reporter.RegisterCollector("collector-two", b.collectors[1])
+	reporter.RegisterSkippedCollector("collector-three", "excluded by --skip")
+	return reporter, nil
+}
+
+func (b *fakeBackend) Finish() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.finished++
+}
+
+var _ = Describe("Server", func() {
+	var (
+		backend *fakeBackend
+		s       *server.Server
+		api     *httptest.Server
+		release chan struct{}
+	)
+
+	get := func(path string) (*http.Response, []byte) {
+		response, err := http.Get(api.URL + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return response, body
+	}
+
+	post := func(body string) (*http.Response, server.Status) {
+		response, err := http.Post(api.URL+"/reports", "application/json", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+
+		var status server.Status
+		contents, err := io.ReadAll(response.Body)
+		Expect(err).NotTo(HaveOccurred())
+		json.Unmarshal(contents, &status)
+		return response, status
+	}
+
+	status := func(id string) server.Status {
+		_, body := get("/reports/" + id)
+		var status server.Status
+		Expect(json.Unmarshal(body, &status)).To(Succeed())
+		return status
+	}
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+
+		collectorOne := new(osreporterfakes.FakeCollector)
+		collectorOne.RunCalls(func(_ context.Context, sink osreporter.Sink, _ io.Writer) error {
+			<-release
+			file, err := sink.Create("one.log")
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = file.Write([]byte("one"))
+			return err
+		})
+		collectorTwo := new(osreporterfakes.FakeCollector)
+		collectorTwo.RunReturns(errors.New("boom\n"))
+
+		backend = &fakeBackend{
+			reportDir:  filepath.Join(GinkgoT().TempDir(), "os-report-cell"),
+			collectors: []*osreporterfakes.FakeCollector{collectorOne, collectorTwo},
+		}
+		s = server.New(backend)
+		api = httptest.NewServer(s.Handler())
+	})
+
+	AfterEach(func() {
+		api.Close()
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		s.Wait()
+	})
+
+	It("lists the collectors", func() {
+		response, body := get("/collectors")
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`[{"name": "Date", "description": "The date", "type": "command", "categories": ["basic"], "timeout": "1m0s"}]`))
+	})
+
+	It("lists the profiles", func() {
+		_, body := get("/profiles")
+
+		var profiles []server.Profile
+		Expect(json.Unmarshal(body, &profiles)).To(Succeed())
+		Expect(profiles).To(ContainElement(HaveField("Name", "quick")))
+	})
+
+	It("creates a report, following the progress of each collector", func() {
+		response, created := post(`{"profile": "quick", "only": ["Date"]}`)
+		Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(response.Header.Get("Location")).To(Equal("/reports/1"))
+		Expect(created.State).To(Equal(server.StateRunning))
+		Expect(created.Archive).To(Equal("os-report-cell.tar.gz"))
+		Expect(backend.requests).To(Equal([]server.Request{{Profile: "quick", Only: []string{"Date"}}}))
+
+		Eventually(func() server.Status { return status("1") }).Should(HaveField("Collectors", Equal([]server.CollectorStatus{
+			{Name: "collector-one", State: server.CollectorRunning},
+			{Name: "collector-two", State: server.CollectorPending},
+			{Name: "collector-three", State: server.CollectorPending},
+		})))
+
+		response, body := get("/reports/1/archive")
+		Expect(response.StatusCode).To(Equal(http.StatusConflict))
+		Expect(body).To(MatchJSON(`{"error": "report 1 is running"}`))
+
+		close(release)
+		Eventually(func() string { return status("1").State }).Should(Equal(server.StateComplete))
+
+		finished := status("1")
+		Expect(finished.EndTime).NotTo(BeZero())
+		Expect(finished.Collectors[0].State).To(Equal("ok"))
+		Expect(finished.Collectors[1]).To(HaveField("State", "failed"))
+		Expect(finished.Collectors[1]).To(HaveField("Error", "boom"))
+		Expect(finished.Collectors[2].State).To(Equal("skipped"))
+		Expect(backend.finished).To(Equal(1))
+
+		response, body = get("/reports/1/archive")
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(response.Header.Get("Content-Type")).To(Equal("application/gzip"))
+		Expect(response.Header.Get("Content-Disposition")).To(Equal(`attachment; filename="os-report-cell.tar.gz"`))
+
+		archive := filepath.Join(GinkgoT().TempDir(), "downloaded.tar.gz")
+		Expect(writeFile(archive, body)).To(Succeed())
+		contents, err := exec.Command("tar", "xzf", archive, "os-report-cell/one.log", "-O").Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("one"))
+
+		_, body = get("/reports")
+		var reports []server.Status
+		Expect(json.Unmarshal(body, &reports)).To(Succeed())
+		Expect(reports).To(HaveLen(1))
+	})
+
+	It("creates a report with the default selection when given no body", func() {
+		response, err := http.Post(api.URL+"/reports", "", nil)
+		Expect(err).NotTo(HaveOccurred())
+		response.Body.Close()
+
+		Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(backend.requests).To(Equal([]server.Request{{}}))
+	})
+
+	It("creates one report at a time", func() {
+		response, _ := post(`{}`)
+		Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+
+		response, _ = post(`{}`)
+		Expect(response.StatusCode).To(Equal(http.StatusConflict))
+
+		close(release)
+		s.Wait()
+
+		response, created := post(`{}`)
+		Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+		Expect(created.ID).To(Equal("2"))
+	})
+
+	It("records reports that fail", func() {
+		notADir := filepath.Join(GinkgoT().TempDir(), "file")
+		Expect(writeFile(notADir, nil)).To(Succeed())
+		backend.reportDir = filepath.Join(notADir, "os-report-cell")
+		close(release)
+
+		post(`{}`)
+		s.Wait()
+
+		failed := status("1")
+		Expect(failed.State).To(Equal(server.StateFailed))
+		Expect(failed.Error).NotTo(BeEmpty())
+	})
+
+	It("rejects invalid requests", func() {
+		response, _ := post(`{"profile": "quick", "colour": "blue"}`)
+		Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+
+		backend.prepareErr = errors.New(`unknown profile "slow"`)
+		response, _ = post(`{"profile": "slow"}`)
+		Expect(response.StatusCode).To(Equal(http.StatusBadRequest))
+
+		_, body := get("/reports")
+		Expect(body).To(MatchJSON(`[]`))
+	})
+
+	It("answers other requests while a report is being prepared", func() {
+		backend.preparing = make(chan struct{})
+		close(release)
+
+		posted := make(chan int)
+		go func() {
+			defer GinkgoRecover()
+			response, _ := post(`{}`)
+			posted <- response.StatusCode
+		}()
+		Eventually(backend.preparing).Should(Receive())
+
+		response, body := get("/reports")
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`[]`))
+
+		response, _ = post(`{}`)
+		Expect(response.StatusCode).To(Equal(http.StatusConflict))
+
+		close(backend.preparing)
+		Eventually(posted).Should(Receive(Equal(http.StatusAccepted)))
+	})
+
+	It("removes the archives of the reports it forgets", func() {
+		s.SetMaxReports(2)
+		close(release)
+
+		var archives []string
+		for i := range 3 {
+			backend.reportDir = filepath.Join(GinkgoT().TempDir(), fmt.Sprintf("os-report-%d", i))
+			archives = append(archives, backend.reportDir+".tar.gz")
+			response, _ := post(`{}`)
+			Expect(response.StatusCode).To(Equal(http.StatusAccepted))
+			s.Wait()
+		}
+
+		Expect(archives[0]).NotTo(BeAnExistingFile())
+		Expect(archives[1]).To(BeAnExistingFile())
+		Expect(archives[2]).To(BeAnExistingFile())
+
+		response, _ := get("/reports/1")
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("does not find unknown reports", func() {
+		response, body := get("/reports/42")
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(body).To(MatchJSON(`{"error": "no report \"42\""}`))
+	})
+})
+
+func writeFile(path string, contents []byte) error {
+	return os.WriteFile(path, contents, 0644)
+}
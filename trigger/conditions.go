@@ -0,0 +1,336 @@
+package trigger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Condition is checked periodically for a problem on the cell.
+type Condition interface {
+	// Check returns a description of the problem, or "" if there is none.
+	Check() (string, error)
+}
+
+// gardenCondition fires when the Garden API fails to answer a number of
+// pings in a row.
+type gardenCondition struct {
+	address  string
+	socket   string
+	failures int
+	failed   int
+	client   *http.Client
+	// socketClient talks HTTP over the unix socket.
+	socketClient *http.Client
+}
+
+func newGardenCondition(address, socket string, timeout time.Duration, failures int) *gardenCondition {
+	var dialer net.Dialer
+	return &gardenCondition{
+		address:  address,
+		socket:   socket,
+		failures: failures,
+		client:   &http.Client{Timeout: timeout},
+		socketClient: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+func (c *gardenCondition) Check() (string, error) {
+	err := c.ping()
+	if err == nil {
+		c.failed = 0
+		return "", nil
+	}
+
+	c.failed++
+	if c.failed < c.failures {
+		return "", nil
+	}
+	return fmt.Sprintf("the Garden API did not answer %d ping(s) in a row: %s", c.failed, err), nil
+}
+
+// ping succeeds if Garden answers on the address or on the socket.
+func (c *gardenCondition) ping() error {
+	var errs []error
+	if c.address != "" {
+		if err := ping(c.client, "http://"+c.address+"/ping"); err != nil {
+			errs = append(errs, err)
+		} else {
+			return nil
+		}
+	}
+	if c.socket != "" {
+		if err := ping(c.socketClient, "http://garden/ping"); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.socket, err))
+		} else {
+			return nil
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func ping(client *http.Client, url string) error {
+	response, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, response.Status)
+	}
+	return nil
+}
+
+// memoryCondition fires when the memory in use, that is not available
+// without swapping, is above a percentage of the total.
+type memoryCondition struct {
+	path  string
+	above float64
+}
+
+func (c *memoryCondition) Check() (string, error) {
+	contents, err := os.ReadFile(c.path)
+	if err != nil {
+		return "", err
+	}
+
+	values := map[string]float64{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found {
+			values[key], _ = strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "kB")), 64)
+		}
+	}
+
+	total, available := values["MemTotal"], values["MemAvailable"]
+	if total == 0 {
+		return "", fmt.Errorf("no MemTotal in %s", c.path)
+	}
+	// Without MemAvailable all of the memory would look in use
+	if _, ok := values["MemAvailable"]; !ok {
+		return "", fmt.Errorf("no MemAvailable in %s", c.path)
+	}
+
+	used := (total - available) * 100 / total
+	if used <= c.above {
+		return "", nil
+	}
+	return fmt.Sprintf("%.0f%% of the memory is in use (above %g%%)", used, c.above), nil
+}
+
+// diskCondition fires when the file system of a path is fuller than a
+// percentage, counting the space reserved for root as df does.
+type diskCondition struct {
+	path  string
+	above float64
+}
+
+func (c *diskCondition) Check() (string, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(c.path, &stat); err != nil {
+		return "", fmt.Errorf("cannot check disk usage of %s: %w", c.path, err)
+	}
+
+	used := float64(stat.Blocks - stat.Bfree)
+	if used+float64(stat.Bavail) == 0 {
+		return "", nil
+	}
+
+	percent := used * 100 / (used + float64(stat.Bavail))
+	if percent <= c.above {
+		return "", nil
+	}
+	return fmt.Sprintf("%s is %.0f%% full (above %g%%)", c.path, percent, c.above), nil
+}
+
+// kmsgPrefix is the priority, sequence number, timestamp and flags that
+// start each record of /dev/kmsg.
+var kmsgPrefix = regexp.MustCompile(`^\d+,\d+,\d+,[^;]*;`)
+
+// logCondition fires when lines written to a file since the previous check
+// match a pattern. It starts following the file at its end, and handles
+// /dev/kmsg as well as log files that are truncated when rotated.
+type logCondition struct {
+	path    string
+	pattern *regexp.Regexp
+	fd      int
+	opened  bool
+	// partial is the start of a line whose end was not written yet.
+	partial []byte
+}
+
+func (c *logCondition) Check() (string, error) {
+	if !c.opened {
+		if err := c.open(); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := c.readNew()
+	if err != nil {
+		return "", err
+	}
+
+	data = append(c.partial, data...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	c.partial = slices.Clone(data[end:])
+
+	matches := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data[:end]))
+	for scanner.Scan() {
+		line := kmsgPrefix.ReplaceAllString(scanner.Text(), "")
+		if c.pattern.MatchString(line) {
+			matches = append(matches, strings.TrimSpace(line))
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", nil
+	case 1:
+		return fmt.Sprintf("%s logged %q", c.path, matches[0]), nil
+	default:
+		return fmt.Sprintf("%s logged %q and %d more matching line(s)", c.path, matches[0], len(matches)-1), nil
+	}
+}
+
+// open uses the file descriptor directly rather than an os.File, as the
+// runtime would otherwise wait for /dev/kmsg to become readable.
+func (c *logCondition) open() error {
+	fd, err := unix.Open(c.path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("cannot follow %s: %w", c.path, err)
+	}
+
+	if _, err := unix.Seek(fd, 0, unix.SEEK_END); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("cannot follow %s: %w", c.path, err)
+	}
+
+	c.fd, c.opened = fd, true
+	return nil
+}
+
+func (c *logCondition) readNew() ([]byte, error) {
+	if err := c.rewindIfTruncated(); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	buffer := make([]byte, 8192)
+	for {
+		n, err := unix.Read(c.fd, buffer)
+		switch {
+		case err == unix.EAGAIN:
+			return data, nil
+		case err == unix.EPIPE:
+			// Records of /dev/kmsg were overwritten before being read
+			continue
+		case err != nil:
+			return data, fmt.Errorf("cannot read %s: %w", c.path, err)
+		case n == 0:
+			return data, nil
+		}
+		data = append(data, buffer[:n]...)
+	}
+}
+
+func (c *logCondition) rewindIfTruncated() error {
+	var stat unix.Stat_t
+	if err := unix.Fstat(c.fd, &stat); err != nil || stat.Mode&unix.S_IFMT != unix.S_IFREG {
+		return nil
+	}
+
+	offset, err := unix.Seek(c.fd, 0, unix.SEEK_CUR)
+	if err != nil || offset <= stat.Size {
+		return nil
+	}
+
+	c.partial = nil
+	_, err = unix.Seek(c.fd, 0, unix.SEEK_SET)
+	return err
+}
+
+// restartCondition fires when a process of the given name appears that was
+// not running when the process was last seen.
+type restartCondition struct {
+	procDir string
+	process string
+	// seen holds the processes found by the last check that found any.
+	seen []int
+}
+
+func (c *restartCondition) Check() (string, error) {
+	pids, err := c.find()
+	if err != nil {
+		return "", err
+	}
+	if len(pids) == 0 {
+		return "", nil
+	}
+
+	previous := c.seen
+	c.seen = pids
+	if previous == nil {
+		return "", nil
+	}
+
+	for _, pid := range pids {
+		if !slices.Contains(previous, pid) {
+			return fmt.Sprintf("%s restarted, it was pid %s and is now pid %d", c.process, joinPids(previous), pid), nil
+		}
+	}
+	return "", nil
+}
+
+func (c *restartCondition) find() ([]int, error) {
+	entries, err := os.ReadDir(c.procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pids := []int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		comm, err := os.ReadFile(filepath.Join(c.procDir, entry.Name(), "comm"))
+		if err == nil && strings.TrimSpace(string(comm)) == c.process {
+			pids = append(pids, pid)
+		}
+	}
+
+	slices.Sort(pids)
+	return pids, nil
+}
+
+func joinPids(pids []int) string {
+	strs := []string{}
+	for _, pid := range pids {
+		strs = append(strs, strconv.Itoa(pid))
+	}
+	return strings.Join(strs, ", ")
+}
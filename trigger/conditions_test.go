@@ -0,0 +1,222 @@
+package trigger_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/trigger"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Conditions", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		tempDir = GinkgoT().TempDir()
+	})
+
+	check := func(condition trigger.Condition) string {
+		reason, err := condition.Check()
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return reason
+	}
+
+	Describe("garden", func() {
+		var (
+			healthy bool
+			server  *httptest.Server
+		)
+
+		BeforeEach(func() {
+			healthy = true
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/ping" || !healthy {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			DeferCleanup(server.Close)
+		})
+
+		It("fires once the API fails enough pings in a row", func() {
+			condition := trigger.Spec{Type: trigger.TypeGarden, Address: server.Listener.Addr().String(), Failures: 2, Timeout: time.Second}.Condition()
+			Expect(check(condition)).To(BeEmpty())
+
+			healthy = false
+			Expect(check(condition)).To(BeEmpty())
+			Expect(check(condition)).To(ContainSubstring("the Garden API did not answer 2 ping(s) in a row"))
+			Expect(check(condition)).To(ContainSubstring("500 Internal Server Error"))
+
+			healthy = true
+			Expect(check(condition)).To(BeEmpty())
+			healthy = false
+			Expect(check(condition)).To(BeEmpty())
+		})
+
+		It("counts the API as up when it answers on the socket", func() {
+			socket := filepath.Join(tempDir, "garden.sock")
+			listener, err := net.Listen("unix", socket)
+			Expect(err).NotTo(HaveOccurred())
+			go http.Serve(listener, server.Config.Handler)
+			DeferCleanup(listener.Close)
+
+			condition := trigger.Spec{Type: trigger.TypeGarden, Address: "127.0.0.1:1", Socket: socket}.Condition()
+			Expect(check(condition)).To(BeEmpty())
+
+			healthy = false
+			Expect(check(condition)).To(ContainSubstring(socket))
+		})
+	})
+
+	Describe("memory", func() {
+		meminfo := func(total, available int) string {
+			path := filepath.Join(tempDir, "meminfo")
+			Expect(os.WriteFile(path, []byte(fmt.Sprintf("MemTotal:       %d kB\nMemFree:          10 kB\nMemAvailable:   %d kB\n", total, available)), 0644)).To(Succeed())
+			return path
+		}
+
+		It("fires when more than the given percentage is in use", func() {
+			Expect(check(trigger.Spec{Type: trigger.TypeMemory, Path: meminfo(1000, 100), Above: 90}.Condition())).To(BeEmpty())
+			Expect(check(trigger.Spec{Type: trigger.TypeMemory, Path: meminfo(1000, 40), Above: 90}.Condition())).
+				To(Equal("96% of the memory is in use (above 90%)"))
+		})
+
+		It("fails without the total", func() {
+			path := filepath.Join(tempDir, "meminfo")
+			Expect(os.WriteFile(path, []byte("MemFree: 10 kB\n"), 0644)).To(Succeed())
+
+			_, err := trigger.Spec{Type: trigger.TypeMemory, Path: path, Above: 90}.Condition().Check()
+			Expect(err).To(MatchError(ContainSubstring("no MemTotal")))
+		})
+
+		It("fails without the available memory", func() {
+			path := filepath.Join(tempDir, "meminfo")
+			Expect(os.WriteFile(path, []byte("MemTotal: 1000 kB\nMemFree: 10 kB\n"), 0644)).To(Succeed())
+
+			_, err := trigger.Spec{Type: trigger.TypeMemory, Path: path, Above: 90}.Condition().Check()
+			Expect(err).To(MatchError(ContainSubstring("no MemAvailable")))
+		})
+	})
+
+	Describe("disk", func() {
+		It("fires when the file system is fuller than the given percentage", func() {
+			Expect(check(trigger.Spec{Type: trigger.TypeDisk, Path: tempDir, Above: 99.999}.Condition())).To(BeEmpty())
+			Expect(check(trigger.Spec{Type: trigger.TypeDisk, Path: tempDir, Above: 0.0001}.Condition())).
+				To(MatchRegexp(`^.* is \d+% full \(above 0.0001%\)$`))
+		})
+
+		It("fails for missing paths", func() {
+			_, err := trigger.Spec{Type: trigger.TypeDisk, Path: "/does/not/exist", Above: 90}.Condition().Check()
+			Expect(err).To(MatchError(ContainSubstring("cannot check disk usage of /does/not/exist")))
+		})
+	})
+
+	Describe("log", func() {
+		var (
+			path      string
+			condition trigger.Condition
+		)
+
+		appendLog := func(text string) {
+			file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+			_, err = file.WriteString(text)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			path = filepath.Join(tempDir, "kern.log")
+			Expect(os.WriteFile(path, []byte("task gdn:123 blocked for more than 120 seconds\n"), 0644)).To(Succeed())
+			condition = trigger.Spec{Type: trigger.TypeLog, Path: path, Pattern: `blocked for more than \d+ seconds`}.Condition()
+		})
+
+		It("only matches lines written after it started following the file", func() {
+			Expect(check(condition)).To(BeEmpty())
+
+			appendLog("all is well\ntask runc:456 blocked for more than 120 seconds\n")
+			Expect(check(condition)).To(Equal(path + ` logged "task runc:456 blocked for more than 120 seconds"`))
+			Expect(check(condition)).To(BeEmpty())
+		})
+
+		It("counts further matching lines", func() {
+			Expect(check(condition)).To(BeEmpty())
+
+			appendLog(strings.Repeat("task runc:456 blocked for more than 120 seconds\n", 3))
+			Expect(check(condition)).To(HaveSuffix("and 2 more matching line(s)"))
+		})
+
+		It("waits for lines to be complete", func() {
+			Expect(check(condition)).To(BeEmpty())
+
+			appendLog("task runc:456 blocked for more")
+			Expect(check(condition)).To(BeEmpty())
+			appendLog(" than 120 seconds\n")
+			Expect(check(condition)).To(ContainSubstring("runc:456"))
+		})
+
+		It("starts over when the file is truncated", func() {
+			Expect(check(condition)).To(BeEmpty())
+
+			Expect(os.WriteFile(path, []byte("task sh:7 blocked for more than 120 seconds\n"), 0644)).To(Succeed())
+			Expect(check(condition)).To(ContainSubstring("sh:7"))
+		})
+
+		It("strips the record prefix of /dev/kmsg", func() {
+			Expect(check(condition)).To(BeEmpty())
+
+			appendLog("3,1042,5543210,-;INFO: task runc:456 blocked for more than 120 seconds.\n")
+			Expect(check(condition)).To(HaveSuffix(`"INFO: task runc:456 blocked for more than 120 seconds."`))
+		})
+
+		It("fails for missing files", func() {
+			_, err := trigger.Spec{Type: trigger.TypeLog, Path: "/does/not/exist", Pattern: "x"}.Condition().Check()
+			Expect(err).To(MatchError(ContainSubstring("cannot follow /does/not/exist")))
+		})
+	})
+
+	Describe("restart", func() {
+		var (
+			procDir   string
+			condition trigger.Condition
+		)
+
+		process := func(pid, name string) {
+			Expect(os.MkdirAll(filepath.Join(procDir, pid), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(procDir, pid, "comm"), []byte(name+"\n"), 0644)).To(Succeed())
+		}
+
+		BeforeEach(func() {
+			procDir = filepath.Join(tempDir, "proc")
+			process("100", "gdn")
+			process("101", "containerd")
+			Expect(os.WriteFile(filepath.Join(procDir, "uptime"), nil, 0644)).To(Succeed())
+			condition = trigger.Spec{Type: trigger.TypeRestart, Process: "gdn", Path: procDir}.Condition()
+		})
+
+		It("fires when the process is replaced by a new one", func() {
+			Expect(check(condition)).To(BeEmpty())
+			Expect(check(condition)).To(BeEmpty())
+
+			Expect(os.RemoveAll(filepath.Join(procDir, "100"))).To(Succeed())
+			Expect(check(condition)).To(BeEmpty())
+
+			process("200", "gdn")
+			Expect(check(condition)).To(Equal("gdn restarted, it was pid 100 and is now pid 200"))
+			Expect(check(condition)).To(BeEmpty())
+		})
+
+		It("does not fire when other processes start", func() {
+			Expect(check(condition)).To(BeEmpty())
+
+			process("300", "runc")
+			Expect(check(condition)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package trigger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Firing is a trigger whose condition was met.
+type Firing struct {
+	Trigger string
+	Reason  string
+	// Suppressed explains why the firing does not call for a report, if it
+	// does not.
+	Suppressed string
+}
+
+// Monitor checks the conditions of a set of triggers and rate limits them:
+// a trigger does not fire again within its cooldown, and no trigger fires
+// within the minimum gap after a report.
+type Monitor struct {
+	triggers   []*armedTrigger
+	minGap     time.Duration
+	lastReport time.Time
+}
+
+type armedTrigger struct {
+	spec      Spec
+	condition Condition
+	lastFired time.Time
+	// lastError is only reported again once it changes.
+	lastError string
+}
+
+func NewMonitor(specs []Spec, minGap time.Duration) *Monitor {
+	m := &Monitor{minGap: minGap}
+	for _, spec := range specs {
+		m.triggers = append(m.triggers, &armedTrigger{spec: spec, condition: spec.Condition()})
+	}
+	return m
+}
+
+// Check checks every condition, returning the triggers that fired and
+// errors checking conditions that are new since the previous check. If any
+// firing is not suppressed, the caller is expected to create a report.
+func (m *Monitor) Check(now time.Time) ([]Firing, []error) {
+	firings := []Firing{}
+	errs := []error{}
+
+	for _, armed := range m.triggers {
+		reason, err := armed.condition.Check()
+		if err != nil {
+			if err.Error() != armed.lastError {
+				errs = append(errs, fmt.Errorf("trigger %q: %w", armed.spec.Name, err))
+			}
+			armed.lastError = err.Error()
+			continue
+		}
+		armed.lastError = ""
+
+		if reason == "" {
+			continue
+		}
+
+		firing := Firing{Trigger: armed.spec.Name, Reason: reason}
+		switch {
+		case !armed.lastFired.IsZero() && now.Sub(armed.lastFired) < armed.spec.EffectiveCooldown():
+			firing.Suppressed = fmt.Sprintf("it fired %s ago, within its cooldown of %s", now.Sub(armed.lastFired).Round(time.Second), armed.spec.EffectiveCooldown())
+		case !m.lastReport.IsZero() && now.Sub(m.lastReport) < m.minGap:
+			firing.Suppressed = fmt.Sprintf("a report was created %s ago, within the minimum gap of %s", now.Sub(m.lastReport).Round(time.Second), m.minGap)
+		default:
+			armed.lastFired = now
+		}
+		firings = append(firings, firing)
+	}
+
+	if len(Active(firings)) > 0 {
+		m.lastReport = now
+	}
+
+	return firings, errs
+}
+
+// Active returns the firings that are not suppressed.
+func Active(firings []Firing) []Firing {
+	active := []Firing{}
+	for _, firing := range firings {
+		if firing.Suppressed == "" {
+			active = append(active, firing)
+		}
+	}
+	return active
+}
+
+// Names returns the names of the triggers that fired, separated by commas.
+func Names(firings []Firing) string {
+	names := []string{}
+	for _, firing := range firings {
+		names = append(names, firing.Trigger)
+	}
+	return strings.Join(names, ",")
+}
+
+// Reasons describes why each of the triggers fired.
+func Reasons(firings []Firing) string {
+	reasons := []string{}
+	for _, firing := range firings {
+		reasons = append(reasons, firing.Trigger+": "+firing.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
@@ -0,0 +1,97 @@
+package trigger_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/trigger"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Monitor", func() {
+	var (
+		tempDir string
+		monitor *trigger.Monitor
+		start   time.Time
+	)
+
+	logTrigger := func(name string, cooldown time.Duration) trigger.Spec {
+		path := filepath.Join(tempDir, name+".log")
+		Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+		return trigger.Spec{Name: name, Type: trigger.TypeLog, Path: path, Pattern: "PANIC", Cooldown: cooldown}
+	}
+
+	fire := func(name string) {
+		file, err := os.OpenFile(filepath.Join(tempDir, name+".log"), os.O_APPEND|os.O_WRONLY, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+		_, err = file.WriteString("PANIC\n")
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	check := func(at time.Duration) []trigger.Firing {
+		firings, errs := monitor.Check(start.Add(at))
+		ExpectWithOffset(1, errs).To(BeEmpty())
+		return firings
+	}
+
+	BeforeEach(func() {
+		tempDir = GinkgoT().TempDir()
+		start = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+		monitor = trigger.NewMonitor([]trigger.Spec{
+			logTrigger("rep", time.Hour),
+			logTrigger("gdn", 10*time.Minute),
+		}, 5*time.Minute)
+
+		Expect(check(0)).To(BeEmpty())
+	})
+
+	It("returns the triggers that fired with their reasons", func() {
+		fire("rep")
+		fire("gdn")
+
+		firings := check(time.Minute)
+		Expect(trigger.Active(firings)).To(HaveLen(2))
+		Expect(trigger.Names(firings)).To(Equal("rep,gdn"))
+		Expect(trigger.Reasons(firings)).To(MatchRegexp(`^rep: .*rep.log logged "PANIC"; gdn: .*gdn.log logged "PANIC"$`))
+	})
+
+	It("suppresses triggers within their cooldown", func() {
+		fire("gdn")
+		Expect(trigger.Active(check(time.Minute))).To(HaveLen(1))
+
+		fire("gdn")
+		firings := check(9 * time.Minute)
+		Expect(firings).To(HaveLen(1))
+		Expect(trigger.Active(firings)).To(BeEmpty())
+		Expect(firings[0].Suppressed).To(Equal("it fired 8m0s ago, within its cooldown of 10m0s"))
+
+		fire("gdn")
+		Expect(trigger.Active(check(12 * time.Minute))).To(HaveLen(1))
+	})
+
+	It("suppresses all triggers within the minimum gap after a report", func() {
+		fire("gdn")
+		Expect(trigger.Active(check(time.Minute))).To(HaveLen(1))
+
+		fire("rep")
+		firings := check(3 * time.Minute)
+		Expect(trigger.Active(firings)).To(BeEmpty())
+		Expect(firings[0].Suppressed).To(Equal("a report was created 2m0s ago, within the minimum gap of 5m0s"))
+
+		fire("rep")
+		Expect(trigger.Names(trigger.Active(check(7 * time.Minute)))).To(Equal("rep"))
+	})
+
+	It("only returns an error again when it changes", func() {
+		monitor = trigger.NewMonitor([]trigger.Spec{{Name: "missing", Type: trigger.TypeLog, Path: filepath.Join(tempDir, "missing.log"), Pattern: "x"}}, 0)
+
+		_, errs := monitor.Check(start)
+		Expect(errs).To(ConsistOf(MatchError(ContainSubstring(`trigger "missing": cannot follow`))))
+
+		_, errs = monitor.Check(start.Add(time.Minute))
+		Expect(errs).To(BeEmpty())
+	})
+})
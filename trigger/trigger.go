@@ -0,0 +1,193 @@
+// Package trigger watches the cell for conditions that call for a report,
+// such as Garden no longer answering or the kernel reporting hung tasks, so
+// that the state is captured at the moment of failure.
+package trigger
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/overlay"
+)
+
+//go:embed triggers.yml
+var defaultTriggers []byte
+
+const (
+	TypeGarden  = "garden"
+	TypeMemory  = "memory"
+	TypeDisk    = "disk"
+	TypeLog     = "log"
+	TypeRestart = "restart"
+)
+
+// DefaultCooldown is how long a trigger stays quiet after firing, unless it
+// sets its own cooldown.
+const DefaultCooldown = 30 * time.Minute
+
+const (
+	defaultMeminfo      = "/proc/meminfo"
+	defaultProcDir      = "/proc"
+	defaultPingTimeout  = 5 * time.Second
+	defaultPingFailures = 1
+)
+
+type Config struct {
+	Triggers []Spec `yaml:"triggers"`
+}
+
+// Spec describes a condition and how often it may cause a report. Which
+// fields apply depends on the type.
+type Spec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Type        string `yaml:"type"`
+	// Address is the host and port of the Garden API, for garden triggers.
+	Address string `yaml:"address"`
+	// Socket is the unix socket of the Garden API, for garden triggers. The
+	// API is up if it answers on either the address or the socket.
+	Socket string `yaml:"socket"`
+	// Path is the mount point to check for disk triggers, the file to follow
+	// for log triggers, the meminfo file for memory triggers and the proc
+	// file system for restart triggers.
+	Path string `yaml:"path"`
+	// Pattern is the regular expression new lines are matched against, for
+	// log triggers.
+	Pattern string `yaml:"pattern"`
+	// Process is the name of the process to watch, for restart triggers.
+	Process string `yaml:"process"`
+	// Above is the percentage of use to exceed, for memory and disk
+	// triggers.
+	Above float64 `yaml:"above"`
+	// Failures is the number of pings in a row that must fail, for garden
+	// triggers.
+	Failures int `yaml:"failures"`
+	// Timeout is how long to wait for a ping, for garden triggers.
+	Timeout  time.Duration `yaml:"timeout"`
+	Cooldown time.Duration `yaml:"cooldown"`
+	Disabled bool          `yaml:"disabled"`
+}
+
+// Default returns the triggers shipped with dontpanic.
+func Default() (Config, error) {
+	return Parse(defaultTriggers)
+}
+
+// Load returns the default triggers, extended or overridden by the triggers
+// defined in each of the given files.
+func Load(paths ...string) (Config, error) {
+	return overlay.Load("triggers", defaultTriggers, paths, Parse, Config.Merge)
+}
+
+func Parse(contents []byte) (Config, error) {
+	return overlay.Parse(contents, func(c Config) []Spec { return c.Triggers }, Spec.Validate)
+}
+
+// Merge returns a config where triggers in override replace the triggers
+// with the same name, and any other triggers are appended.
+func (c Config) Merge(override Config) Config {
+	return Config{Triggers: overlay.Merge(c.Triggers, override.Triggers, func(s Spec) string { return s.Name })}
+}
+
+// Enabled returns the triggers that are not disabled.
+func (c Config) Enabled() []Spec {
+	specs := []Spec{}
+	for _, spec := range c.Triggers {
+		if !spec.Disabled {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+func (s Spec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("trigger has no name")
+	}
+
+	if s.Disabled {
+		return nil
+	}
+
+	if s.Cooldown < 0 {
+		return fmt.Errorf("trigger %q has a negative cooldown", s.Name)
+	}
+
+	switch s.Type {
+	case TypeGarden:
+		if s.Address == "" && s.Socket == "" {
+			return fmt.Errorf("trigger %q of type %q needs an address or a socket", s.Name, s.Type)
+		}
+		if s.Failures < 0 || s.Timeout < 0 {
+			return fmt.Errorf("trigger %q has negative failures or timeout", s.Name)
+		}
+	case TypeMemory:
+		return s.validateAbove()
+	case TypeDisk:
+		if s.Path == "" {
+			return fmt.Errorf("trigger %q of type %q has no path", s.Name, s.Type)
+		}
+		return s.validateAbove()
+	case TypeLog:
+		if s.Path == "" {
+			return fmt.Errorf("trigger %q of type %q has no path", s.Name, s.Type)
+		}
+		if s.Pattern == "" {
+			return fmt.Errorf("trigger %q of type %q has no pattern", s.Name, s.Type)
+		}
+		if _, err := regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("trigger %q has invalid pattern: %v", s.Name, err)
+		}
+	case TypeRestart:
+		if s.Process == "" {
+			return fmt.Errorf("trigger %q of type %q has no process", s.Name, s.Type)
+		}
+	default:
+		return fmt.Errorf("trigger %q has unknown type %q", s.Name, s.Type)
+	}
+
+	return nil
+}
+
+func (s Spec) validateAbove() error {
+	if s.Above <= 0 || s.Above >= 100 {
+		return fmt.Errorf("trigger %q of type %q needs a percentage between 0 and 100 to be above", s.Name, s.Type)
+	}
+	return nil
+}
+
+// EffectiveCooldown returns the cooldown of the trigger, or the default if
+// it does not set one.
+func (s Spec) EffectiveCooldown() time.Duration {
+	if s.Cooldown == 0 {
+		return DefaultCooldown
+	}
+	return s.Cooldown
+}
+
+// Condition returns the condition the trigger checks. The trigger must be
+// valid.
+func (s Spec) Condition() Condition {
+	switch s.Type {
+	case TypeGarden:
+		return newGardenCondition(s.Address, s.Socket, withDefault(s.Timeout, defaultPingTimeout), withDefault(s.Failures, defaultPingFailures))
+	case TypeMemory:
+		return &memoryCondition{path: withDefault(s.Path, defaultMeminfo), above: s.Above}
+	case TypeDisk:
+		return &diskCondition{path: s.Path, above: s.Above}
+	case TypeLog:
+		return &logCondition{path: s.Path, pattern: regexp.MustCompile(s.Pattern)}
+	default:
+		return &restartCondition{procDir: withDefault(s.Path, defaultProcDir), process: s.Process}
+	}
+}
+
+func withDefault[T comparable](value, fallback T) T {
+	var zero T
+	if value == zero {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,13 @@
+package trigger_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTrigger(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Trigger Suite")
+}
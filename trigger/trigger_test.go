@@ -0,0 +1,81 @@
+package trigger_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/dontpanic/trigger"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	It("ships valid default triggers", func() {
+		config, err := trigger.Default()
+		Expect(err).NotTo(HaveOccurred())
+
+		names := []string{}
+		for _, spec := range config.Enabled() {
+			names = append(names, spec.Name)
+		}
+		Expect(names).To(ConsistOf("garden-unresponsive", "gdn-restart", "memory-pressure", "data-disk-full", "hung-task", "oom-kill"))
+	})
+
+	It("overrides, disables and adds triggers from files", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "triggers.yml")
+		Expect(os.WriteFile(path, []byte(`triggers:
+  - name: memory-pressure
+    type: memory
+    above: 80
+    cooldown: 1h
+  - name: garden-unresponsive
+    disabled: true
+  - name: rep-panic
+    type: log
+    path: /var/vcap/sys/log/rep/rep.stdout.log
+    pattern: panic
+`), 0644)).To(Succeed())
+
+		config, err := trigger.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		enabled := map[string]trigger.Spec{}
+		for _, spec := range config.Enabled() {
+			enabled[spec.Name] = spec
+		}
+		Expect(enabled).NotTo(HaveKey("garden-unresponsive"))
+		Expect(enabled).To(HaveKey("rep-panic"))
+		Expect(enabled["memory-pressure"].Above).To(Equal(80.0))
+		Expect(enabled["memory-pressure"].EffectiveCooldown()).To(Equal(time.Hour))
+		Expect(enabled["oom-kill"].EffectiveCooldown()).To(Equal(trigger.DefaultCooldown))
+	})
+
+	It("fails to load missing files", func() {
+		_, err := trigger.Load("/does/not/exist.yml")
+		Expect(err).To(MatchError(ContainSubstring(`failed to read triggers "/does/not/exist.yml"`)))
+	})
+
+	DescribeTable("rejects invalid triggers",
+		func(yaml, message string) {
+			_, err := trigger.Parse([]byte(yaml))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("no name", "triggers: [{type: memory, above: 90}]", "trigger has no name"),
+		Entry("unknown type", "triggers: [{name: t, type: cpu}]", `trigger "t" has unknown type "cpu"`),
+		Entry("unknown field", "triggers: [{name: t, type: memory, above: 90, below: 10}]", "field below not found"),
+		Entry("garden without address", "triggers: [{name: t, type: garden}]", "needs an address or a socket"),
+		Entry("memory without threshold", "triggers: [{name: t, type: memory}]", "needs a percentage between 0 and 100"),
+		Entry("disk above 100", "triggers: [{name: t, type: disk, path: /, above: 120}]", "needs a percentage between 0 and 100"),
+		Entry("disk without path", "triggers: [{name: t, type: disk, above: 90}]", `trigger "t" of type "disk" has no path`),
+		Entry("log without pattern", "triggers: [{name: t, type: log, path: /dev/kmsg}]", "has no pattern"),
+		Entry("log with invalid pattern", "triggers: [{name: t, type: log, path: /dev/kmsg, pattern: '('}]", "has invalid pattern"),
+		Entry("restart without process", "triggers: [{name: t, type: restart}]", "has no process"),
+		Entry("negative cooldown", "triggers: [{name: t, type: memory, above: 90, cooldown: -1m}]", "negative cooldown"),
+	)
+
+	It("does not validate disabled triggers beyond their name", func() {
+		_, err := trigger.Parse([]byte("triggers: [{name: t, disabled: true}]"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
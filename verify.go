@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+
+	"github.com/logrusorgru/aurora"
+
+	"code.cloudfoundry.org/dontpanic/report"
+)
+
+type VerifyCommand struct {
+	PublicKey string `long:"public-key" description:"PEM encoded ed25519 public key the checksums must be signed with"`
+	Key       string `long:"key" description:"PEM encoded X25519 private key to decrypt an encrypted report with"`
+	Args      struct {
+		Report string `positional-arg-name:"REPORT" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *VerifyCommand) Execute([]string) error {
+	var publicKey ed25519.PublicKey
+	if c.PublicKey != "" {
+		var err error
+		publicKey, err = report.LoadVerifyingKey(c.PublicKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	archive, err := report.Open(c.Args.Report, c.Key)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	verification, err := report.Verify(archive, publicKey)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range verification.Missing {
+		fmt.Println(aurora.Red("MISSING    " + name))
+	}
+	for _, name := range verification.Modified {
+		fmt.Println(aurora.Red("MODIFIED   " + name))
+	}
+	for _, name := range verification.Unexpected {
+		fmt.Println(aurora.Red("UNEXPECTED " + name))
+	}
+
+	switch {
+	case verification.SignatureError != "":
+		fmt.Println(aurora.Red("Signature: " + verification.SignatureError))
+	case verification.SignatureValid:
+		fmt.Println(aurora.Green("Signature: valid"))
+	case verification.Signed:
+		fmt.Println("Signature: present but not checked, pass --public-key to check it")
+	default:
+		fmt.Println("Signature: none")
+	}
+
+	if !verification.OK() {
+		return errors.New("report verification failed")
+	}
+
+	fmt.Println(aurora.Green(fmt.Sprintf("Verified %d file(s)", len(verification.Verified))))
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/logrusorgru/aurora"
+
+	"code.cloudfoundry.org/dontpanic/collectors/file"
+	"code.cloudfoundry.org/dontpanic/collectorspec"
+	"code.cloudfoundry.org/dontpanic/ring"
+)
+
+type WatchCommand struct {
+	Interval        time.Duration `long:"interval" default:"1m" description:"Time between snapshots"`
+	Keep            int           `long:"keep" default:"10" description:"Number of snapshots to keep"`
+	SnapshotProfile string        `long:"snapshot-profile" default:"quick" description:"Collection profile to take snapshots with"`
+	RingDir         string        `long:"ring-dir" default:"/var/vcap/data/tmp/dontpanic-watch" description:"Directory to keep the snapshots in"`
+
+	options *Options
+}
+
+func (c *WatchCommand) Execute([]string) error {
+	if c.Interval <= 0 {
+		return fmt.Errorf("the interval must be positive")
+	}
+
+	checkIsRoot()
+	checkIsNotBpm()
+
+	w, err := newWatcher(*c.options, c.RingDir, c.Keep)
+	if err != nil {
+		return err
+	}
+	selection, err := w.collection.selection(c.SnapshotProfile, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := w.ring.RemoveStaged(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	fmt.Println(aurora.Bold(fmt.Sprintf("Taking a %s snapshot every %s, keeping the last %d in %s", c.SnapshotProfile, c.Interval, c.Keep, c.RingDir)))
+	fmt.Println(aurora.Bold("Send SIGUSR1 or run the bundle command to create a full report including the snapshots"))
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	w.snapshot(selection)
+	for {
+		select {
+		case <-ticker.C:
+			w.snapshot(selection)
+		case sig := <-signals:
+			if sig != syscall.SIGUSR1 {
+				return nil
+			}
+			if err := w.bundle(os.Stdout, nil); err != nil {
+				fmt.Fprintln(os.Stderr, aurora.Red(err.Error()))
+			}
+		}
+	}
+}
+
+type BundleCommand struct {
+	RingDir string `long:"ring-dir" default:"/var/vcap/data/tmp/dontpanic-watch" description:"Directory the watch command keeps the snapshots in"`
+
+	options *Options
+}
+
+func (c *BundleCommand) Execute([]string) error {
+	checkIsRoot()
+	checkIsNotBpm()
+	checkGardenLogLevel()
+
+	// The bundle command never adds snapshots, so how many the ring keeps
+	// does not matter
+	w, err := newWatcher(*c.options, c.RingDir, 1)
+	if err != nil {
+		return err
+	}
+
+	return w.bundle(os.Stdout, nil)
+}
+
+// watcher takes snapshots into a ring buffer and bundles them with a full
+// report.
+type watcher struct {
+	*reportMaker
+	ring ring.Ring
+}
+
+func newWatcher(opts Options, ringDir string, keep int) (*watcher, error) {
+	if err := os.MkdirAll(ringDir, 0700); err != nil {
+		return nil, err
+	}
+
+	ring, err := ring.New(ringDir, keep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &watcher{reportMaker: newReportMaker(opts, filepath.Join(ringDir, "anonymize-mapping.json")), ring: ring}, nil
+}
+
+// snapshot adds a report of the selected collectors to the ring.
+func (w *watcher) snapshot(selection collectorspec.Selection) {
+	reportDir := reportPath(w.ring.StagingDir(), w.hostname)
+	if err := w.takeSnapshot(reportDir, selection); err != nil {
+		fmt.Fprintln(os.Stderr, aurora.Red(fmt.Sprintf("failed to take snapshot: %s", err.Error())))
+		os.RemoveAll(reportDir)
+		return
+	}
+
+	fmt.Println(aurora.Green(fmt.Sprintf("Snapshot saved to %s", filepath.Join(w.ring.Dir(), filepath.Base(reportDir)))))
+}
+
+func (w *watcher) takeSnapshot(reportDir string, selection collectorspec.Selection) error {
+	if !w.collection.opts.Stream {
+		if err := os.MkdirAll(reportDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	osReporter := w.collection.newReporter(reportDir, io.Discard, selection, w.anonymizer)
+	osReporter.SetMetadata("snapshot", "true")
+	err := osReporter.Run()
+	w.saveMapping(io.Discard)
+	if err != nil {
+		os.Remove(osReporter.ArchivePath())
+		return err
+	}
+
+	return w.ring.Add(osReporter.ArchivePath())
+}
+
+// bundle creates a full report, as selected by the global options, that
+// includes the snapshots in the ring and records the metadata given.
+func (w *watcher) bundle(progress io.Writer, metadata map[string]string) error {
+	opts := w.collection.opts
+	selection, err := w.collection.selection(opts.Profile, opts.Include, opts.Only)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := w.ring.Snapshots()
+	if err != nil {
+		return err
+	}
+
+	osReporter, err := w.prepare(progress, selection)
+	if err != nil {
+		return err
+	}
+
+	osReporter.SetMetadata("snapshots", strconv.Itoa(len(snapshots)))
+	for key, value := range metadata {
+		osReporter.SetMetadata(key, value)
+	}
+	if len(snapshots) > 0 {
+		osReporter.RegisterCollector("Watch Snapshots", file.NewCollector(w.ring.Pattern(), "snapshots/"))
+	} else {
+		osReporter.RegisterSkippedCollector("Watch Snapshots", fmt.Sprintf("no snapshots in %s", w.ring.Dir()))
+	}
+
+	err = osReporter.Run()
+	w.saveMapping(progress)
+	return err
+}